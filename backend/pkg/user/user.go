@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // User represents a user in the system
@@ -21,20 +23,29 @@ type User struct {
 	UpdatedAt           time.Time `bson:"updated_at"`
 }
 
+// Filter matches a user whose _id is either the ObjectId the frontend creates
+// on sign-up or a plain string ID
+func Filter(userID string) bson.M {
+	if oid, err := primitive.ObjectIDFromHex(userID); err == nil {
+		return bson.M{"_id": bson.M{"$in": bson.A{oid, userID}}}
+	}
+	return bson.M{"_id": userID}
+}
+
 // InitializeUserBalance ensures user has a balance field
 func InitializeUserBalance(ctx context.Context, collection *mongo.Collection, userID string) error {
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+	_, err := collection.UpdateOne(ctx, Filter(userID), bson.M{
 		"$setOnInsert": bson.M{
 			"balance": 0.0,
 		},
-	}, &mongo.UpdateOptions{})
+	}, options.Update())
 	return err
 }
 
 // GetBalance retrieves a user's balance
 func GetBalance(ctx context.Context, collection *mongo.Collection, userID string) (float64, error) {
 	var user bson.M
-	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	err := collection.FindOne(ctx, Filter(userID)).Decode(&user)
 	if err != nil {
 		return 0, err
 	}
@@ -48,7 +59,7 @@ func GetBalance(ctx context.Context, collection *mongo.Collection, userID string
 
 // AddBalance adds to a user's balance
 func AddBalance(ctx context.Context, collection *mongo.Collection, userID string, amount float64) error {
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+	_, err := collection.UpdateOne(ctx, Filter(userID), bson.M{
 		"$inc": bson.M{"balance": amount},
 		"$set": bson.M{"updated_at": time.Now()},
 	})
@@ -63,7 +74,7 @@ func SubtractBalance(ctx context.Context, collection *mongo.Collection, userID s
 // GetTokens retrieves a user's token balance
 func GetTokens(ctx context.Context, collection *mongo.Collection, userID string) (float64, error) {
 	var user bson.M
-	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	err := collection.FindOne(ctx, Filter(userID)).Decode(&user)
 	if err != nil {
 		return 0, err
 	}
@@ -77,7 +88,7 @@ func GetTokens(ctx context.Context, collection *mongo.Collection, userID string)
 
 // AddTokens adds to a user's token balance
 func AddTokens(ctx context.Context, collection *mongo.Collection, userID string, amount float64) error {
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+	_, err := collection.UpdateOne(ctx, Filter(userID), bson.M{
 		"$inc": bson.M{"tokens": amount},
 		"$set": bson.M{"updated_at": time.Now()},
 	})
@@ -94,7 +105,7 @@ func ConvertSOLToTokens(ctx context.Context, collection *mongo.Collection, userI
 	tokenAmount := solAmount * 200.0
 	
 	// Atomic operation: subtract SOL, add tokens
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+	_, err := collection.UpdateOne(ctx, Filter(userID), bson.M{
 		"$inc": bson.M{
 			"balance": -solAmount,
 			"tokens": tokenAmount,
@@ -109,7 +120,7 @@ func ConvertTokensToSOL(ctx context.Context, collection *mongo.Collection, userI
 	solAmount := tokenAmount / 200.0
 	
 	// Atomic operation: subtract tokens, add SOL
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+	_, err := collection.UpdateOne(ctx, Filter(userID), bson.M{
 		"$inc": bson.M{
 			"tokens": -tokenAmount,
 			"balance": solAmount,
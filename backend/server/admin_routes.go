@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dilyxs/medMarket/auth"
+	"github.com/dilyxs/medMarket/pkg"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HandleSetRole changes a user's role
+// PUT /api/admin/users/{id}/role - body {"role": "instructor"}
+func HandleSetRole(w http.ResponseWriter, r *http.Request, roles *auth.RoleStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := mux.Vars(r)["id"]
+
+	var req struct {
+		Role auth.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		http.Error(w, `{"error": "role must be one of viewer, player, instructor, admin"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := roles.SetRole(r.Context(), userID, req.Role)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, `{"error": "user not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "failed to update role"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"role":    req.Role,
+	})
+}
+
+// HandleListQuizAlerts lists integrity alerts raised on finished quiz games
+// GET /api/admin/quiz/alerts?status=open&game_id=...
+func HandleListQuizAlerts(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if games.Alerts == nil {
+		http.Error(w, `{"error": "quiz alerts are not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", pkg.AlertOpen, pkg.AlertDismissed, pkg.AlertConfirmed:
+	default:
+		http.Error(w, `{"error": "status must be open, dismissed or confirmed"}`, http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := games.Alerts.List(r.Context(), status, r.URL.Query().Get("game_id"), 100)
+	if err != nil {
+		http.Error(w, `{"error": "failed to load quiz alerts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+	})
+}
+
+// HandleResolveQuizAlert dismisses or confirms an open alert. Dismissing
+// releases the held payouts of players with no other open alert in the game;
+// confirming forfeits them.
+// POST /api/admin/quiz/alerts/{id}/resolve - body {"resolution": "dismissed", "note": "..."}
+func HandleResolveQuizAlert(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if games.Alerts == nil || games.Ledger == nil {
+		http.Error(w, `{"error": "quiz alerts are not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"error": "quiz alert not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Resolution string `json:"resolution"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	alert, err := games.Alerts.Resolve(r.Context(), id, req.Resolution, user.UserID, req.Note)
+	var invalid *pkg.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": invalid.Error()})
+		return
+	case errors.Is(err, pkg.ErrAlertReviewed):
+		http.Error(w, `{"error": "alert has already been reviewed"}`, http.StatusConflict)
+		return
+	case errors.Is(err, mongo.ErrNoDocuments):
+		http.Error(w, `{"error": "quiz alert not found"}`, http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, `{"error": "failed to resolve quiz alert"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Payouts held by this alert, by user: released, forfeited, or still held
+	// by another open alert
+	payouts := make(map[string]interface{}, len(alert.UserIDs))
+	if alert.Held {
+		for _, userID := range alert.UserIDs {
+			var amount float64
+			if alert.Status == pkg.AlertConfirmed {
+				amount, err = games.Ledger.Forfeit(r.Context(), alert.GameID, userID)
+			} else {
+				var stillHeld bool
+				stillHeld, err = games.Alerts.OpenHolds(r.Context(), alert.GameID, userID)
+				if err == nil && stillHeld {
+					payouts[userID] = "held"
+					continue
+				}
+				if err == nil {
+					amount, err = games.Ledger.Release(r.Context(), alert.GameID, userID)
+				}
+			}
+			if err != nil {
+				http.Error(w, `{"error": "alert resolved but failed to update held payouts"}`, http.StatusInternalServerError)
+				return
+			}
+			payouts[userID] = amount
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alert":   alert,
+		"payouts": payouts,
+	})
+}
+
+// HandleListQuizHolds lists quiz payouts held for review
+// GET /api/admin/quiz/holds?game_id=...
+func HandleListQuizHolds(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if games.Ledger == nil {
+		http.Error(w, `{"error": "quiz ledger is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	holds, err := games.Ledger.Held(r.Context(), r.URL.Query().Get("game_id"))
+	if err != nil {
+		http.Error(w, `{"error": "failed to load held payouts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"holds": holds,
+	})
+}
+
+// RegisterAdminRoutes registers routes under /api/admin, all of which require
+// the admin role
+func RegisterAdminRoutes(router *mux.Router, roles *auth.RoleStore, games *pkg.QuizManager) *mux.Router {
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(roles.Middleware(auth.RoleAdmin))
+
+	admin.HandleFunc("/users/{id}/role", func(w http.ResponseWriter, r *http.Request) {
+		HandleSetRole(w, r, roles)
+	}).Methods(http.MethodPut)
+
+	admin.HandleFunc("/quiz/alerts", func(w http.ResponseWriter, r *http.Request) {
+		HandleListQuizAlerts(w, r, games)
+	}).Methods(http.MethodGet)
+
+	admin.HandleFunc("/quiz/alerts/{id}/resolve", func(w http.ResponseWriter, r *http.Request) {
+		HandleResolveQuizAlert(w, r, games)
+	}).Methods(http.MethodPost)
+
+	admin.HandleFunc("/quiz/holds", func(w http.ResponseWriter, r *http.Request) {
+		HandleListQuizHolds(w, r, games)
+	}).Methods(http.MethodGet)
+
+	return admin
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User is the identity carried in the session token. Field names match the
+// SessionUser the Next.js frontend signs in lib/auth.ts.
+type User struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+	Name   string `json:"name,omitempty"`
+	// Role is never read from the token, so a forged claim can't grant one;
+	// RoleStore.RequireRole fills it in from the users collection
+	Role Role `json:"-"`
+}
+
+// DisplayName returns the name to show for the user, falling back to email
+func (u *User) DisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Email
+}
+
+// Claims is the JWT payload: {"user": {...}, "iat": ..., "exp": ...}
+type Claims struct {
+	User User `json:"user"`
+	jwt.RegisteredClaims
+}
+
+var (
+	ErrMissingToken = errors.New("missing session token")
+	ErrInvalidToken = errors.New("invalid session token")
+)
+
+// Verifier checks HS256 session tokens signed with the shared secret
+type Verifier struct {
+	secret     []byte
+	cookieName string
+}
+
+// NewVerifier creates a verifier for tokens signed with secret. Tokens are
+// read from the Authorization header, the session cookie or ?token=.
+func NewVerifier(secret, cookieName string) *Verifier {
+	return &Verifier{
+		secret:     []byte(secret),
+		cookieName: cookieName,
+	}
+}
+
+// Verify parses and validates a token and returns the user it was issued for
+func (v *Verifier) Verify(token string) (*User, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return v.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !parsed.Valid || claims.User.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims.User, nil
+}
+
+// Sign issues a token in the same format as the frontend. Useful for tools
+// and service-to-service calls that don't go through the Next.js sign-in.
+func (v *Verifier) Sign(user User, claims jwt.RegisteredClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		User:             user,
+		RegisteredClaims: claims,
+	}).SignedString(v.secret)
+}
+
+// TokenFromRequest finds the session token on a request. Browsers can't set
+// headers on WebSocket upgrades, so the cookie and ?token= are also accepted.
+func (v *Verifier) TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie(v.cookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Authenticate verifies the token on r, if any
+func (v *Verifier) Authenticate(r *http.Request) (*User, error) {
+	token := v.TokenFromRequest(r)
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	return v.Verify(token)
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying the verified user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the verified user stored by Middleware
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// Middleware verifies the session token on every request and stores the user
+// in the request context. Requests without a token pass through anonymously;
+// requests with a bad token are rejected so a stale session is never ignored.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := v.Authenticate(r)
+		switch {
+		case errors.Is(err, ErrMissingToken):
+			next.ServeHTTP(w, r)
+		case err != nil:
+			respondUnauthorized(w, "invalid or expired session")
+		default:
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		}
+	})
+}
+
+// RequireUser rejects requests that Middleware did not authenticate
+func RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserFromContext(r.Context()); !ok {
+			respondUnauthorized(w, "authentication required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func respondUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
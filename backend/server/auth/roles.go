@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"example.com/m/backend/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Role is stored in the "role" field of the user document
+type Role string
+
+const (
+	RoleViewer     Role = "viewer"
+	RolePlayer     Role = "player"
+	RoleInstructor Role = "instructor"
+	RoleAdmin      Role = "admin"
+)
+
+// DefaultRole is assumed for users whose document has no role yet
+const DefaultRole = RolePlayer
+
+var roleRank = map[Role]int{
+	RoleViewer:     1,
+	RolePlayer:     2,
+	RoleInstructor: 3,
+	RoleAdmin:      4,
+}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// AtLeast reports whether r grants everything min does
+func (r Role) AtLeast(min Role) bool {
+	return roleRank[r] >= roleRank[min]
+}
+
+// RoleStore reads and writes roles on the users collection
+type RoleStore struct {
+	Users   *mongo.Collection
+	Timeout time.Duration
+}
+
+// NewRoleStore creates a role store backed by the users collection
+func NewRoleStore(users *mongo.Collection, timeout time.Duration) *RoleStore {
+	return &RoleStore{Users: users, Timeout: timeout}
+}
+
+// RoleFor returns the stored role for userID, or DefaultRole if none is set
+func (s *RoleStore) RoleFor(ctx context.Context, userID string) (Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var doc struct {
+		Role Role `bson:"role"`
+	}
+	err := s.Users.FindOne(ctx, user.Filter(userID), options.FindOne().SetProjection(bson.M{"role": 1})).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return DefaultRole, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !doc.Role.Valid() {
+		return DefaultRole, nil
+	}
+	return doc.Role, nil
+}
+
+// SetRole stores role on the user document
+func (s *RoleStore) SetRole(ctx context.Context, userID string, role Role) error {
+	if !role.Valid() {
+		return errors.New("unknown role")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	result, err := s.Users.UpdateOne(ctx, user.Filter(userID), bson.M{
+		"$set": bson.M{"role": role, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RequireRole rejects requests whose authenticated user has a role below min.
+// The resolved role is stored on the context user for later handlers.
+func (s *RoleStore) RequireRole(min Role, next http.HandlerFunc) http.HandlerFunc {
+	return RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		role, err := s.RoleFor(r.Context(), user.UserID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "failed to load user role"})
+			return
+		}
+
+		if !role.AtLeast(min) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "requires " + string(min) + " role"})
+			return
+		}
+
+		withRole := *user
+		withRole.Role = role
+		next(w, r.WithContext(WithUser(r.Context(), &withRole)))
+	})
+}
+
+// Middleware applies RequireRole to every route of a subrouter
+func (s *RoleStore) Middleware(min Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.RequireRole(min, next.ServeHTTP)
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/dilyxs/medMarket/auth"
+	"github.com/dilyxs/medMarket/pkg"
+	"github.com/gorilla/mux"
+)
+
+// respondBankError maps question bank errors to HTTP statuses
+func respondBankError(w http.ResponseWriter, err error) {
+	var invalid *pkg.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": invalid.Error()})
+	case errors.Is(err, pkg.ErrBankNotFound):
+		http.Error(w, `{"error": "question bank not found"}`, http.StatusNotFound)
+	case errors.Is(err, pkg.ErrQuestionNotFound):
+		http.Error(w, `{"error": "question not found"}`, http.StatusNotFound)
+	case errors.Is(err, pkg.ErrPlaylistNotFound):
+		http.Error(w, `{"error": "playlist not found"}`, http.StatusNotFound)
+	default:
+		http.Error(w, `{"error": "question bank request failed"}`, http.StatusInternalServerError)
+	}
+}
+
+// maxImportSize caps uploaded question bank files
+const maxImportSize = 5 << 20
+
+// respondImportError reports every rejected row, or falls back to the usual
+// bank error statuses
+func respondImportError(w http.ResponseWriter, err error) {
+	var importErr *pkg.ImportError
+	if errors.As(err, &importErr) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "import rejected, nothing was saved",
+			"rows":  importErr.Rows,
+		})
+		return
+	}
+	respondBankError(w, err)
+}
+
+// importFormat picks csv or json from ?format= or the Content-Type
+func importFormat(r *http.Request) (string, bool) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			format = "csv"
+		}
+	}
+	return format, format == "csv" || format == "json"
+}
+
+// parseImport reads the request body as a CSV or JSON bank file
+func parseImport(r *http.Request, format string) (*pkg.BankExport, []pkg.ImportRow, []pkg.ImportRowError, error) {
+	body := io.Reader(r.Body)
+	if format == "csv" {
+		rows, rowErrors, err := pkg.ParseBankCSV(body)
+		return nil, rows, rowErrors, err
+	}
+	return pkg.ParseBankJSON(body)
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// HandleExportBank downloads a bank as JSON or CSV. Exports leave out
+// timestamps so they diff cleanly under version control.
+// GET /api/banks/{id}/export?format=json|csv
+func HandleExportBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	format, ok := importFormat(r)
+	if !ok {
+		http.Error(w, `{"error": "format must be csv or json"}`, http.StatusBadRequest)
+		return
+	}
+
+	bank, err := banks.GetBank(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		respondBankError(w, err)
+		return
+	}
+
+	filename := strings.Trim(unsafeFilename.ReplaceAllString(bank.Name, "-"), "-")
+	if filename == "" {
+		filename = bank.ID.Hex()
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		err = pkg.WriteBankCSV(w, bank)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = pkg.WriteBankJSON(w, bank)
+	}
+	if err != nil {
+		http.Error(w, `{"error": "failed to export bank"}`, http.StatusInternalServerError)
+	}
+}
+
+// HandleImportQuestions adds questions from a CSV or JSON file to a bank. The
+// import is all or nothing; every invalid row is reported.
+// POST /api/banks/{id}/import?format=csv|json&mode=append|replace
+func HandleImportQuestions(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	format, ok := importFormat(r)
+	if !ok {
+		http.Error(w, `{"error": "format must be csv or json"}`, http.StatusBadRequest)
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "append"
+	}
+	if mode != "append" && mode != "replace" {
+		http.Error(w, `{"error": "mode must be append or replace"}`, http.StatusBadRequest)
+		return
+	}
+
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	_, rows, rowErrors, err := parseImport(r, format)
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	imported, err := banks.ImportQuestions(r.Context(), bank, rows, rowErrors, mode == "replace")
+	if err != nil {
+		respondImportError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bank_id":  bank.ID.Hex(),
+		"mode":     mode,
+		"imported": imported,
+	})
+}
+
+// HandleImportBank creates a new bank from a file. JSON files carry the bank
+// name; CSV imports take it from ?name=.
+// POST /api/banks/import?format=csv|json&name=...
+func HandleImportBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	format, ok := importFormat(r)
+	if !ok {
+		http.Error(w, `{"error": "format must be csv or json"}`, http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	export, rows, rowErrors, err := parseImport(r, format)
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	bank := &pkg.QuestionBank{OwnerID: user.UserID}
+	if export != nil {
+		bank.Name = export.Name
+		bank.Description = export.Description
+		bank.Tags = export.Tags
+	}
+	if name := r.URL.Query().Get("name"); name != "" {
+		bank.Name = name
+	}
+
+	if err := banks.CreateBankFromImport(r.Context(), bank, rows, rowErrors); err != nil {
+		respondImportError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bank)
+}
+
+// canEdit reports whether user may change something owned by ownerID
+func canEdit(user *auth.User, ownerID string) bool {
+	return user.UserID == ownerID || user.Role.AtLeast(auth.RoleAdmin)
+}
+
+// editableBank loads the bank in the route and checks the caller may change it
+func editableBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) (*pkg.QuestionBank, bool) {
+	bank, err := banks.GetBank(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondBankError(w, err)
+		return nil, false
+	}
+	user, _ := auth.UserFromContext(r.Context())
+	if !canEdit(user, bank.OwnerID) {
+		http.Error(w, `{"error": "only the owner can change this bank"}`, http.StatusForbidden)
+		return nil, false
+	}
+	return bank, true
+}
+
+// HandleListBanks lists banks, optionally filtered by ?tag=
+// GET /api/banks
+func HandleListBanks(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	list, err := banks.ListBanks(r.Context(), r.URL.Query().Get("tag"))
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"banks": list})
+}
+
+// HandleCreateBank creates a bank owned by the caller
+// POST /api/banks - body {"name", "description", "tags", "questions": [...]}
+func HandleCreateBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var bank pkg.QuestionBank
+	if err := json.NewDecoder(r.Body).Decode(&bank); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	bank.OwnerID = user.UserID
+	if err := banks.CreateBank(r.Context(), &bank); err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bank)
+}
+
+// HandleGetBank returns a bank with its questions
+// GET /api/banks/{id}
+func HandleGetBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bank, err := banks.GetBank(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(bank)
+}
+
+// HandleUpdateBank changes a bank's name, description and tags
+// PUT /api/banks/{id} - body {"name", "description", "tags"}
+func HandleUpdateBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := banks.UpdateBank(r.Context(), bank.ID, req.Name, req.Description, req.Tags); err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	updated, err := banks.GetBank(r.Context(), bank.ID.Hex())
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// HandleDeleteBank removes a bank
+// DELETE /api/banks/{id}
+func HandleDeleteBank(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+	if err := banks.DeleteBank(r.Context(), bank.ID); err != nil {
+		respondBankError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAddQuestion appends a question to a bank
+// POST /api/banks/{id}/questions
+func HandleAddQuestion(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+
+	var question pkg.BankQuestion
+	if err := json.NewDecoder(r.Body).Decode(&question); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := banks.AddQuestion(r.Context(), bank.ID, &question); err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(question)
+}
+
+// HandleUpdateQuestion replaces a question in a bank
+// PUT /api/banks/{id}/questions/{qid}
+func HandleUpdateQuestion(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+
+	questionID := mux.Vars(r)["qid"]
+	var existing *pkg.BankQuestion
+	for i := range bank.Questions {
+		if bank.Questions[i].ID == questionID {
+			existing = &bank.Questions[i]
+			break
+		}
+	}
+	if existing == nil {
+		respondBankError(w, pkg.ErrQuestionNotFound)
+		return
+	}
+
+	var question pkg.BankQuestion
+	if err := json.NewDecoder(r.Body).Decode(&question); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	question.ID = questionID
+
+	if err := banks.UpdateQuestion(r.Context(), bank.ID, &question, existing.CreatedAt); err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(question)
+}
+
+// HandleDeleteQuestion removes a question from a bank
+// DELETE /api/banks/{id}/questions/{qid}
+func HandleDeleteQuestion(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	bank, ok := editableBank(w, r, banks)
+	if !ok {
+		return
+	}
+	if err := banks.DeleteQuestion(r.Context(), bank.ID, mux.Vars(r)["qid"]); err != nil {
+		respondBankError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListPlaylists lists every playlist
+// GET /api/playlists
+func HandleListPlaylists(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	list, err := banks.ListPlaylists(r.Context())
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"playlists": list})
+}
+
+// HandleCreatePlaylist creates a playlist owned by the caller
+// POST /api/playlists - body {"name", "items": [{"bank_id", "question_id"}], "gap_seconds"}
+func HandleCreatePlaylist(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var playlist pkg.Playlist
+	if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	playlist.OwnerID = user.UserID
+	if err := banks.CreatePlaylist(r.Context(), &playlist); err != nil {
+		respondBankError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(playlist)
+}
+
+// HandleGetPlaylist returns a playlist
+// GET /api/playlists/{id}
+func HandleGetPlaylist(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	playlist, err := banks.GetPlaylist(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(playlist)
+}
+
+// HandleUpdatePlaylist replaces a playlist's name, items and gap
+// PUT /api/playlists/{id}
+func HandleUpdatePlaylist(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existing, err := banks.GetPlaylist(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	user, _ := auth.UserFromContext(r.Context())
+	if !canEdit(user, existing.OwnerID) {
+		http.Error(w, `{"error": "only the owner can change this playlist"}`, http.StatusForbidden)
+		return
+	}
+
+	var playlist pkg.Playlist
+	if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	playlist.ID = existing.ID
+	playlist.OwnerID = existing.OwnerID
+	playlist.CreatedAt = existing.CreatedAt
+
+	if err := banks.UpdatePlaylist(r.Context(), &playlist); err != nil {
+		respondBankError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(playlist)
+}
+
+// HandleDeletePlaylist removes a playlist
+// DELETE /api/playlists/{id}
+func HandleDeletePlaylist(w http.ResponseWriter, r *http.Request, banks *pkg.QuestionBankStore) {
+	playlist, err := banks.GetPlaylist(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondBankError(w, err)
+		return
+	}
+	user, _ := auth.UserFromContext(r.Context())
+	if !canEdit(user, playlist.OwnerID) {
+		http.Error(w, `{"error": "only the owner can delete this playlist"}`, http.StatusForbidden)
+		return
+	}
+	if err := banks.DeletePlaylist(r.Context(), playlist.ID); err != nil {
+		respondBankError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterBankRoutes registers question bank and playlist routes. Banks hold
+// correct answers, so every route requires the instructor role.
+func RegisterBankRoutes(router *mux.Router, banks *pkg.QuestionBankStore, roles *auth.RoleStore) {
+	handle := func(path, method string, handler func(http.ResponseWriter, *http.Request, *pkg.QuestionBankStore)) {
+		router.HandleFunc(path, roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, banks)
+		})).Methods(method)
+	}
+
+	handle("/api/banks", http.MethodGet, HandleListBanks)
+	handle("/api/banks", http.MethodPost, HandleCreateBank)
+	handle("/api/banks/import", http.MethodPost, HandleImportBank)
+	handle("/api/banks/{id}/export", http.MethodGet, HandleExportBank)
+	handle("/api/banks/{id}/import", http.MethodPost, HandleImportQuestions)
+	handle("/api/banks/{id}", http.MethodGet, HandleGetBank)
+	handle("/api/banks/{id}", http.MethodPut, HandleUpdateBank)
+	handle("/api/banks/{id}", http.MethodDelete, HandleDeleteBank)
+	handle("/api/banks/{id}/questions", http.MethodPost, HandleAddQuestion)
+	handle("/api/banks/{id}/questions/{qid}", http.MethodPut, HandleUpdateQuestion)
+	handle("/api/banks/{id}/questions/{qid}", http.MethodDelete, HandleDeleteQuestion)
+
+	handle("/api/playlists", http.MethodGet, HandleListPlaylists)
+	handle("/api/playlists", http.MethodPost, HandleCreatePlaylist)
+	handle("/api/playlists/{id}", http.MethodGet, HandleGetPlaylist)
+	handle("/api/playlists/{id}", http.MethodPut, HandleUpdatePlaylist)
+	handle("/api/playlists/{id}", http.MethodDelete, HandleDeletePlaylist)
+}
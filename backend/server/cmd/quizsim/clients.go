@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Bet strategies: how a simulated player stakes their balance
+const (
+	betRandom   = "random"   // everything on one random option
+	betSpread   = "spread"   // split evenly across every option
+	betCautious = "cautious" // a fifth of the balance on one random option
+	betOracle   = "oracle"   // everything on the correct option
+	betMixed    = "mixed"    // each player picks one of the above
+)
+
+// Timing strategies: when in the betting window a simulated player bets
+const (
+	timingEarly      = "early"       // in the first fifth of the window
+	timingUniform    = "uniform"     // anywhere in the window
+	timingLastSecond = "last-second" // in the last second before bets lock
+	timingMixed      = "mixed"       // each player picks one of the above
+)
+
+var (
+	betStrategies    = []string{betRandom, betSpread, betCautious, betOracle}
+	timingStrategies = []string{timingEarly, timingUniform, timingLastSecond}
+)
+
+// simQuestion is what a player reads from new_question
+type simQuestion struct {
+	ID        string   `json:"id"`
+	Options   []string `json:"options"`
+	StartTime int64    `json:"start_time"`
+	Deadline  int64    `json:"deadline"`
+}
+
+// simPlayer is one player connected over a real WebSocket. Its choices come
+// from its own seeded source, so a run with the same seed makes the same bets.
+type simPlayer struct {
+	id      string
+	bet     string
+	timing  string
+	change  float64 // chance of changing the bet once placed
+	lockIn  time.Duration
+	answers map[string]int // question ID -> correct option, for the oracle
+	stats   *stats
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu        sync.Mutex // guards everything below
+	rng       *rand.Rand
+	balance   float64
+	staked    float64 // on the open question
+	active    bool
+	pending   []time.Time // sent bets waiting for a reply, in order
+	deadline  time.Time   // of the open question
+	questions int
+	results   int
+	ended     bool
+	done      chan struct{}
+}
+
+func (p *simPlayer) send(msg map[string]interface{}) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.conn.WriteJSON(msg)
+}
+
+// run reads until the game ends or the connection closes
+func (p *simPlayer) run() {
+	defer close(p.done)
+	for {
+		_, data, err := p.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received := time.Now()
+		msgType := messageType(data)
+		p.stats.message(msgType)
+
+		switch msgType {
+		case "game_state":
+			var state struct {
+				Tokens   float64 `json:"tokens"`
+				IsActive bool    `json:"is_active"`
+			}
+			json.Unmarshal(data, &state)
+			p.mu.Lock()
+			p.balance, p.active = state.Tokens, state.IsActive
+			p.mu.Unlock()
+
+		case "new_question":
+			var payload struct {
+				Question simQuestion `json:"question"`
+			}
+			json.Unmarshal(data, &payload)
+			question := payload.Question
+			p.stats.sample(&p.stats.questionLag, received.Sub(time.UnixMilli(question.StartTime)))
+			p.stats.sawQuestion(question.ID)
+			p.mu.Lock()
+			p.questions++
+			p.staked = 0
+			p.deadline = time.UnixMilli(question.Deadline)
+			p.mu.Unlock()
+			p.schedule(question)
+
+		case "tick":
+			var tick struct {
+				Deadline int64 `json:"deadline"`
+			}
+			json.Unmarshal(data, &tick)
+			if tick.Deadline > 0 {
+				p.mu.Lock()
+				p.deadline = time.UnixMilli(tick.Deadline)
+				p.mu.Unlock()
+			}
+
+		case "bet_confirmed", "bet_rejected":
+			var reply struct {
+				Message    string    `json:"message"`
+				Bets       []float64 `json:"bets"`
+				NewBalance float64   `json:"new_balance"`
+			}
+			json.Unmarshal(data, &reply)
+			p.mu.Lock()
+			if len(p.pending) > 0 {
+				p.stats.sample(&p.stats.betRTT, received.Sub(p.pending[0]))
+				p.pending = p.pending[1:]
+			}
+			if msgType == "bet_confirmed" {
+				p.balance = reply.NewBalance
+				p.staked = 0
+				for _, amount := range reply.Bets {
+					p.staked += amount
+				}
+			}
+			p.mu.Unlock()
+			if msgType == "bet_rejected" {
+				p.stats.rejected(reply.Message)
+			}
+
+		case "results":
+			var results resultsMessage
+			json.Unmarshal(data, &results)
+			p.stats.sawResults(results.QuestionID, results.Rake)
+			p.mu.Lock()
+			p.results++
+			if !p.deadline.IsZero() {
+				p.stats.sample(&p.stats.resultsLag, received.Sub(p.deadline))
+			}
+			if result, ok := results.PlayerResults[p.id]; ok {
+				p.balance = result.NewBalance
+			}
+			p.staked = 0
+			p.mu.Unlock()
+
+		case "eliminated":
+			p.mu.Lock()
+			p.active = false
+			p.mu.Unlock()
+
+		case "game_ended":
+			var ended endedMessage
+			json.Unmarshal(data, &ended)
+			ended.record(p.stats)
+			p.mu.Lock()
+			if ended.Results != nil {
+				if result, ok := ended.Results.PlayerResults[p.id]; ok {
+					p.balance = result.NewBalance
+				}
+			}
+			p.ended = true
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// schedule places the player's bet on question at the time its timing
+// strategy picks, and maybe changes it later
+func (p *simPlayer) schedule(question simQuestion) {
+	start := time.UnixMilli(question.StartTime)
+	closes := time.UnixMilli(question.Deadline).Add(-p.lockIn)
+	window := closes.Sub(start)
+	if window <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	var at time.Time
+	switch p.timing {
+	case timingEarly:
+		at = start.Add(time.Duration(p.rng.Float64() * 0.2 * float64(window)))
+	case timingLastSecond:
+		at = closes.Add(-time.Duration(p.rng.Float64() * float64(min(window, time.Second))))
+	default:
+		at = start.Add(time.Duration(p.rng.Float64() * float64(window)))
+	}
+	changeAt := time.Time{}
+	if p.rng.Float64() < p.change {
+		changeAt = at.Add(time.Duration(p.rng.Float64() * float64(closes.Sub(at))))
+	}
+	p.mu.Unlock()
+
+	time.AfterFunc(time.Until(at), func() { p.placeBet(question) })
+	if !changeAt.IsZero() {
+		time.AfterFunc(time.Until(changeAt), func() { p.placeBet(question) })
+	}
+}
+
+// placeBet stakes what the player has, counting a bet it replaces
+func (p *simPlayer) placeBet(question simQuestion) {
+	p.mu.Lock()
+	available := p.balance + p.staked
+	if !p.active || p.ended || available <= 0 || len(question.Options) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	bets := make([]float64, len(question.Options))
+	switch p.bet {
+	case betSpread:
+		share := floorUnits(available / float64(len(bets)))
+		for i := range bets {
+			bets[i] = share
+		}
+	case betCautious:
+		bets[p.rng.Intn(len(bets))] = floorUnits(available / 5)
+	case betOracle:
+		bets[p.answers[question.ID]] = floorUnits(available)
+	default:
+		bets[p.rng.Intn(len(bets))] = floorUnits(available)
+	}
+	p.pending = append(p.pending, time.Now())
+	p.mu.Unlock()
+
+	p.stats.betSent()
+	p.send(map[string]interface{}{
+		"type":        "submit_bet",
+		"question_id": question.ID,
+		"bets":        bets,
+	})
+}
+
+// resultsMessage is the part of a results message the simulation checks
+type resultsMessage struct {
+	QuestionID    string  `json:"question_id"`
+	Rake          float64 `json:"rake"`
+	PlayerResults map[string]struct {
+		NewBalance float64 `json:"new_balance"`
+	} `json:"player_results"`
+}
+
+// endedMessage is the part of game_ended the simulation checks
+type endedMessage struct {
+	Winner       string          `json:"winner"`
+	HouseJackpot float64         `json:"house_jackpot"`
+	Results      *resultsMessage `json:"results"`
+}
+
+func (m *endedMessage) record(stats *stats) {
+	if m.Results != nil {
+		stats.sawResults(m.Results.QuestionID, m.Results.Rake)
+	}
+	stats.sawEnd(m.Winner, m.HouseJackpot)
+}
+
+// simHost starts the game over /quiz-broadcaster and watches it like a player
+type simHost struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	done    chan struct{}
+}
+
+func (h *simHost) send(msg map[string]interface{}) error {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	return h.conn.WriteJSON(msg)
+}
+
+func (h *simHost) run(stats *stats) {
+	defer close(h.done)
+	for {
+		_, data, err := h.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		switch messageType(data) {
+		case "question_live":
+			var live struct {
+				QuestionID string `json:"question_id"`
+			}
+			json.Unmarshal(data, &live)
+			if live.QuestionID != "" {
+				stats.sawQuestion(live.QuestionID)
+			}
+
+		case "results":
+			var results resultsMessage
+			json.Unmarshal(data, &results)
+			stats.sawResults(results.QuestionID, results.Rake)
+
+		case "game_ended":
+			var ended endedMessage
+			json.Unmarshal(data, &ended)
+			ended.record(stats)
+			return
+
+		case "error":
+			var problem struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(data, &problem)
+			stats.rejected("host: " + problem.Message)
+		}
+	}
+}
+
+// messageType reads just the type of a message
+func messageType(data []byte) string {
+	var head struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &head)
+	return head.Type
+}
+
+// floorUnits rounds a stake down to whole millionths, so it never exceeds
+// the balance it was split from
+func floorUnits(tokens float64) float64 {
+	return math.Floor(tokens*1e6) / 1e6
+}
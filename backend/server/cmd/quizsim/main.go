@@ -0,0 +1,429 @@
+// Command quizsim plays scripted quiz games against the real hub to measure it
+// under load. It serves the hub from an in-process HTTP server, connects a host
+// and N players over WebSockets, lets each player bet by a seeded strategy and
+// reports latency, lost messages and whether every token is accounted for.
+//
+// The game runs without MongoDB, so there are no buy-in or payout writes. A
+// run with the same seed asks the same questions and makes the same choices;
+// the timing still depends on the scheduler.
+//
+//	go run ./cmd/quizsim -players 500 -questions 10 -mode parimutuel -bet mixed -timing last-second
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dilyxs/medMarket/config"
+	"github.com/dilyxs/medMarket/pkg"
+	"github.com/gorilla/websocket"
+)
+
+const simHostID = "sim-host"
+
+type options struct {
+	players    int
+	questions  int
+	timeLimit  int
+	mode       string
+	lives      int
+	seed       int64
+	bet        string
+	timing     string
+	change     float64
+	lockIn     time.Duration
+	gap        time.Duration
+	review     time.Duration
+	tick       time.Duration
+	sendBuffer int
+	betBuffer  int
+	timeout    time.Duration
+	verbose    bool
+}
+
+func main() {
+	var opts options
+	flag.IntVar(&opts.players, "players", 100, "simulated players")
+	flag.IntVar(&opts.questions, "questions", 5, "questions to play; the game ends after the last one")
+	flag.IntVar(&opts.timeLimit, "time-limit", 5, "seconds per question")
+	flag.StringVar(&opts.mode, "mode", pkg.ScoringParimutuel, "scoring mode: elimination, points, parimutuel or lives")
+	flag.IntVar(&opts.lives, "lives", 0, "lives per player in lives mode (0 uses the default)")
+	flag.Int64Var(&opts.seed, "seed", 1, "seed for questions and player choices")
+	flag.StringVar(&opts.bet, "bet", betMixed, "bet strategy: random, spread, cautious, oracle or mixed")
+	flag.StringVar(&opts.timing, "timing", timingMixed, "bet timing: early, uniform, last-second or mixed")
+	flag.Float64Var(&opts.change, "change", 0.2, "chance a player changes their bet before it locks")
+	flag.DurationVar(&opts.lockIn, "lock-in", time.Second, "bet lock-in before each deadline")
+	flag.DurationVar(&opts.gap, "gap", 500*time.Millisecond, "pause between questions")
+	flag.DurationVar(&opts.review, "review", 0, "review after each question (0 skips it)")
+	flag.DurationVar(&opts.tick, "tick", time.Second, "clock tick interval (0 turns ticks off)")
+	flag.IntVar(&opts.sendBuffer, "send-buffer", 0, "per-player send buffer (0 uses the default)")
+	flag.IntVar(&opts.betBuffer, "bet-buffer", 0, "hub bet queue (0 uses the default)")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "give up on a game that runs longer")
+	flag.BoolVar(&opts.verbose, "v", false, "keep the server's logs")
+	flag.Parse()
+
+	if err := opts.check(); err != nil {
+		fmt.Fprintln(os.Stderr, "quizsim:", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !opts.verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	ok, err := run(opts, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "quizsim:", err)
+		os.Exit(1)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func (o options) check() error {
+	switch {
+	case o.players < 1:
+		return fmt.Errorf("-players must be at least 1")
+	case o.questions < 1:
+		return fmt.Errorf("-questions must be at least 1")
+	case o.timeLimit < 1:
+		return fmt.Errorf("-time-limit must be at least 1")
+	case time.Duration(o.timeLimit)*time.Second <= o.lockIn:
+		return fmt.Errorf("-lock-in must be shorter than -time-limit")
+	case o.change < 0 || o.change > 1:
+		return fmt.Errorf("-change must be between 0 and 1")
+	}
+	if o.bet != betMixed && !contains(betStrategies, o.bet) {
+		return fmt.Errorf("unknown bet strategy %q", o.bet)
+	}
+	if o.timing != timingMixed && !contains(timingStrategies, o.timing) {
+		return fmt.Errorf("unknown timing %q", o.timing)
+	}
+	return nil
+}
+
+// run plays one game and writes the report. It returns false when a check
+// failed.
+func run(opts options, out io.Writer) (bool, error) {
+	cfg := config.Default()
+	quizCfg := cfg.Quiz
+	quizCfg.BetLockIn = opts.lockIn
+	quizCfg.NextQuestionDelay = opts.gap
+	quizCfg.ReviewDuration = opts.review
+	quizCfg.TickInterval = opts.tick
+	if opts.sendBuffer > 0 {
+		quizCfg.PlayerSendBuffer = opts.sendBuffer
+	}
+	if opts.betBuffer > 0 {
+		quizCfg.BetBuffer = opts.betBuffer
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := pkg.NewQuizManager(ctx, nil, quizCfg, cfg.Sockets)
+
+	rng := rand.New(rand.NewSource(opts.seed))
+	questions, answers := makeQuestions(rng, opts)
+	game, err := manager.CreateGame(simHostID, questions, opts.gap, pkg.QuizRules{
+		Mode:         opts.mode,
+		Lives:        opts.lives,
+		MaxQuestions: opts.questions,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// The balances the server ended with, taken before the game is archived
+	var final pkg.QuizSnapshot
+	finished := make(chan struct{})
+	gameEnded := game.OnEnded
+	game.OnEnded = func(h *pkg.QuizHub) {
+		final = h.Snapshot()
+		close(finished)
+		gameEnded(h)
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/quiz-broadcaster", func(w http.ResponseWriter, r *http.Request) {
+		pkg.ConnectQuizBroadcaster(game, w, r, simHostID, false, false)
+	})
+	router.HandleFunc("/quiz-viewer", func(w http.ResponseWriter, r *http.Request) {
+		userID := r.URL.Query().Get("user")
+		pkg.ConnectQuizPlayer(game, w, r, userID, userID, userID+"@sim.local")
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	stats := newStats()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/quiz-broadcaster", nil)
+	if err != nil {
+		return false, fmt.Errorf("connect host: %w", err)
+	}
+	host := &simHost{conn: conn, done: make(chan struct{})}
+	go host.run(stats)
+	defer conn.Close()
+
+	players := connectPlayers(wsURL, opts, quizCfg, answers, stats)
+	if len(players) == 0 {
+		return false, fmt.Errorf("no player could connect")
+	}
+	if err := waitJoined(game, len(players), 10*time.Second); err != nil {
+		return false, err
+	}
+
+	started := time.Now()
+	if err := host.send(map[string]interface{}{"type": "start_game"}); err != nil {
+		return false, fmt.Errorf("start game: %w", err)
+	}
+
+	timedOut := false
+	select {
+	case <-finished:
+	case <-time.After(opts.timeout):
+		timedOut = true
+	}
+	elapsed := time.Since(started)
+
+	// Give the last messages a moment to arrive, then stop reading
+	waitAll(players, host, 5*time.Second)
+	for _, player := range players {
+		player.conn.Close()
+	}
+	conn.Close()
+
+	if timedOut {
+		fmt.Fprintf(out, "game did not end within %s\n", opts.timeout)
+		return false, nil
+	}
+	return report(out, opts, quizCfg, players, stats, final, elapsed), nil
+}
+
+// makeQuestions builds choice questions with a seeded correct option
+func makeQuestions(rng *rand.Rand, opts options) ([]*pkg.Question, map[string]int) {
+	questions := make([]*pkg.Question, 0, opts.questions)
+	answers := make(map[string]int, opts.questions)
+	for i := 0; i < opts.questions; i++ {
+		id := fmt.Sprintf("sim-q%d", i+1)
+		correct := rng.Intn(4)
+		questions = append(questions, &pkg.Question{
+			ID:           id,
+			Question:     fmt.Sprintf("Simulated question %d", i+1),
+			Options:      []string{"A", "B", "C", "D"},
+			CorrectIndex: correct,
+			TimeLimit:    opts.timeLimit,
+		})
+		answers[id] = correct
+	}
+	return questions, answers
+}
+
+// connectPlayers dials every player, a few at a time so the listener's
+// backlog doesn't refuse them
+func connectPlayers(wsURL string, opts options, cfg config.QuizConfig, answers map[string]int, stats *stats) []*simPlayer {
+	var (
+		mu      sync.Mutex
+		players []*simPlayer
+		wg      sync.WaitGroup
+	)
+	slots := make(chan struct{}, 32)
+
+	for i := 0; i < opts.players; i++ {
+		player := &simPlayer{
+			id:      fmt.Sprintf("sim-player-%04d", i+1),
+			bet:     opts.bet,
+			timing:  opts.timing,
+			change:  opts.change,
+			lockIn:  cfg.BetLockIn,
+			answers: answers,
+			stats:   stats,
+			rng:     rand.New(rand.NewSource(opts.seed + int64(i) + 1)),
+			done:    make(chan struct{}),
+		}
+		if player.bet == betMixed {
+			player.bet = betStrategies[player.rng.Intn(len(betStrategies))]
+		}
+		if player.timing == timingMixed {
+			player.timing = timingStrategies[player.rng.Intn(len(timingStrategies))]
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/quiz-viewer?user="+url.QueryEscape(player.id), nil)
+			if err != nil {
+				stats.connectFailed()
+				return
+			}
+			player.conn = conn
+			go player.run()
+
+			mu.Lock()
+			players = append(players, player)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return players
+}
+
+// waitJoined waits for the hub to register count players
+func waitJoined(game *pkg.QuizHub, count int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		joined := len(game.Snapshot().Players)
+		if joined >= count {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("only %d of %d players joined", joined, count)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// waitAll waits for every client to read game_ended, up to timeout
+func waitAll(players []*simPlayer, host *simHost, timeout time.Duration) {
+	expired := time.After(timeout)
+	for _, player := range players {
+		select {
+		case <-player.done:
+		case <-expired:
+			return
+		}
+	}
+	select {
+	case <-host.done:
+	case <-expired:
+	}
+}
+
+// report writes the results of the run and checks that no tokens were made or
+// lost. It returns false when a check failed.
+func report(out io.Writer, opts options, cfg config.QuizConfig, players []*simPlayer, stats *stats, final pkg.QuizSnapshot, elapsed time.Duration) bool {
+	ok := true
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	fmt.Fprintf(out, "quizsim: %d players, %d questions, %s mode, seed %d, bet %s, timing %s\n",
+		opts.players, opts.questions, final.Rules.Mode, opts.seed, opts.bet, opts.timing)
+	fmt.Fprintf(out, "game %s ran %s: %d questions opened, %d settled", final.GameID, elapsed.Round(time.Millisecond), len(stats.questions), len(stats.rake))
+	if stats.winner != "" {
+		fmt.Fprintf(out, ", won by %s", stats.winner)
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "\nlatency")
+	writeLatency(out, "bet round trip", stats.betRTT)
+	writeLatency(out, "question fan-out", stats.questionLag)
+	writeLatency(out, "results fan-out", stats.resultsLag)
+
+	// Every player should see every question and its results, and every bet
+	// should be answered. Balances only have to agree for players who did.
+	var missedQuestions, missedResults, unanswered, notEnded, complete, disagree int
+	balances := make(map[string]float64, len(final.Players))
+	for _, player := range final.Players {
+		balances[player.UserID] = player.Tokens
+	}
+	for _, player := range players {
+		player.mu.Lock()
+		missed := max(0, len(stats.questions)-player.questions) + max(0, len(stats.rake)-player.results) + len(player.pending)
+		missedQuestions += max(0, len(stats.questions)-player.questions)
+		missedResults += max(0, len(stats.rake)-player.results)
+		unanswered += len(player.pending)
+		if !player.ended {
+			notEnded++
+			missed++
+		}
+		if missed == 0 {
+			complete++
+			if server, ok := balances[player.id]; ok && math.Abs(server-player.balance) > 1e-6 {
+				disagree++
+			}
+		}
+		player.mu.Unlock()
+	}
+	fmt.Fprintln(out, "\ndelivery")
+	fmt.Fprintf(out, "  players connected  %d of %d\n", len(players), opts.players)
+	fmt.Fprintf(out, "  bets sent          %d\n", stats.betsSent)
+	fmt.Fprintf(out, "  bets unanswered    %d\n", unanswered)
+	fmt.Fprintf(out, "  questions missed   %d\n", missedQuestions)
+	fmt.Fprintf(out, "  results missed     %d\n", missedResults)
+	fmt.Fprintf(out, "  game_ended missed  %d\n", notEnded)
+	if stats.connectErrs > 0 || complete < len(players) {
+		fmt.Fprintf(out, "  FAIL: %d players lost messages (a full send buffer skips them)\n", len(players)-complete)
+		ok = false
+	}
+
+	fmt.Fprintln(out, "\nmessages received by players")
+	writeCounts(out, stats.messages)
+	if len(stats.rejections) > 0 {
+		fmt.Fprintln(out, "\nbets rejected")
+		writeCounts(out, stats.rejections)
+	}
+
+	// Tokens only move between players, the jackpot and the house
+	bought := pkg.ToUnits(cfg.StartingTokens) * pkg.TokenUnits(len(final.Players))
+	var held pkg.TokenUnits
+	for _, player := range final.Players {
+		held += pkg.ToUnits(player.Tokens)
+	}
+	var rake pkg.TokenUnits
+	for _, amount := range stats.rake {
+		rake += pkg.ToUnits(amount)
+	}
+	house := rake + pkg.ToUnits(stats.house)
+	jackpot := pkg.ToUnits(final.Jackpot)
+	drift := bought - held - house - jackpot
+
+	fmt.Fprintln(out, "\ntokens")
+	fmt.Fprintf(out, "  bought in          %.6f\n", bought.Tokens())
+	fmt.Fprintf(out, "  held by players    %.6f\n", held.Tokens())
+	fmt.Fprintf(out, "  kept by the house  %.6f (rake %.6f, jackpot %.6f)\n", house.Tokens(), rake.Tokens(), stats.house)
+	fmt.Fprintf(out, "  left in jackpot    %.6f\n", jackpot.Tokens())
+	fmt.Fprintf(out, "  unaccounted        %.6f\n", drift.Tokens())
+	fmt.Fprintf(out, "  client balances    %d of %d disagree with the server\n", disagree, complete)
+	switch {
+	case len(stats.rake) < len(stats.questions) || !stats.ended:
+		// A question nobody saw settle can't be accounted for
+		fmt.Fprintln(out, "  FAIL: no client saw every question settle")
+		ok = false
+	case drift != 0:
+		fmt.Fprintln(out, "  FAIL: tokens were created or lost")
+		ok = false
+	}
+	if disagree > 0 {
+		fmt.Fprintln(out, "  FAIL: clients and server disagree on balances")
+		ok = false
+	}
+
+	if ok {
+		fmt.Fprintln(out, "\nPASS")
+	}
+	return ok
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
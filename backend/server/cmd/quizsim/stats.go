@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats collects what the simulated clients saw
+type stats struct {
+	mu          sync.Mutex
+	betRTT      []time.Duration // submit_bet to bet_confirmed or bet_rejected
+	questionLag []time.Duration // question start to new_question arriving
+	resultsLag  []time.Duration // question deadline to results arriving
+	messages    map[string]int  // received by type
+	rejections  map[string]int  // bet_rejected by reason
+	betsSent    int
+	connectErrs int
+
+	// What the server sent anyone, pieced together from every client since
+	// each of them may have missed messages
+	questions map[string]bool    // question IDs opened
+	rake      map[string]float64 // question ID -> rake when it settled
+	ended     bool
+	winner    string
+	house     float64 // jackpot kept by the house at the end
+}
+
+func newStats() *stats {
+	return &stats{
+		messages:   make(map[string]int),
+		rejections: make(map[string]int),
+		questions:  make(map[string]bool),
+		rake:       make(map[string]float64),
+	}
+}
+
+func (s *stats) sawQuestion(questionID string) {
+	s.mu.Lock()
+	s.questions[questionID] = true
+	s.mu.Unlock()
+}
+
+func (s *stats) sawResults(questionID string, rake float64) {
+	s.mu.Lock()
+	s.questions[questionID] = true
+	s.rake[questionID] = rake
+	s.mu.Unlock()
+}
+
+func (s *stats) sawEnd(winner string, house float64) {
+	s.mu.Lock()
+	s.ended, s.winner, s.house = true, winner, house
+	s.mu.Unlock()
+}
+
+func (s *stats) message(msgType string) {
+	s.mu.Lock()
+	s.messages[msgType]++
+	s.mu.Unlock()
+}
+
+func (s *stats) sample(into *[]time.Duration, d time.Duration) {
+	s.mu.Lock()
+	*into = append(*into, d)
+	s.mu.Unlock()
+}
+
+func (s *stats) betSent() {
+	s.mu.Lock()
+	s.betsSent++
+	s.mu.Unlock()
+}
+
+func (s *stats) rejected(reason string) {
+	s.mu.Lock()
+	s.rejections[reason]++
+	s.mu.Unlock()
+}
+
+func (s *stats) connectFailed() {
+	s.mu.Lock()
+	s.connectErrs++
+	s.mu.Unlock()
+}
+
+// writeLatency prints the percentiles of samples
+func writeLatency(w io.Writer, name string, samples []time.Duration) {
+	if len(samples) == 0 {
+		fmt.Fprintf(w, "  %-18s no samples\n", name)
+		return
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) time.Duration {
+		return sorted[min(len(sorted)-1, int(p*float64(len(sorted))))]
+	}
+	fmt.Fprintf(w, "  %-18s n=%-6d p50=%-10s p95=%-10s p99=%-10s max=%s\n",
+		name, len(sorted), at(0.50).Round(time.Microsecond), at(0.95).Round(time.Microsecond),
+		at(0.99).Round(time.Microsecond), sorted[len(sorted)-1].Round(time.Microsecond))
+}
+
+// writeCounts prints a count per key, largest first
+func writeCounts(w io.Writer, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %-40s %d\n", strings.TrimSpace(key), counts[key])
+	}
+}
@@ -0,0 +1,439 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the full server configuration. Defaults are applied first, then
+// the optional YAML file, then environment variables.
+type Config struct {
+	Server  ServerConfig `yaml:"server"`
+	Mongo   MongoConfig  `yaml:"mongo"`
+	AI      AIConfig     `yaml:"ai"`
+	Solana  SolanaConfig `yaml:"solana"`
+	Quiz    QuizConfig   `yaml:"quiz"`
+	Chat    ChatConfig   `yaml:"chat"`
+	Stream  StreamConfig `yaml:"stream"`
+	WebRTC  WebRTCConfig `yaml:"webrtc"`
+	Sockets SocketConfig `yaml:"sockets"`
+	Auth    AuthConfig   `yaml:"auth"`
+}
+
+// ServerConfig controls the HTTP listener
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// MongoConfig holds the MongoDB connection settings
+type MongoConfig struct {
+	URI            string        `yaml:"uri"`
+	Database       string        `yaml:"database"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+}
+
+// AIConfig points at the Python segmentation service
+type AIConfig struct {
+	ServiceURL string        `yaml:"service_url"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// SolanaConfig holds RPC endpoints, treasury keys and fees
+type SolanaConfig struct {
+	RPC               string        `yaml:"rpc"`
+	VerifyRPC         string        `yaml:"verify_rpc"` // used by /verify_deposit
+	RPCTimeout        time.Duration `yaml:"rpc_timeout"`
+	TestMode          bool          `yaml:"test_mode"`
+	ReceiverAddress   string        `yaml:"receiver_address"`
+	TreasurySecretKey string        `yaml:"treasury_secret_key"` // JSON byte array
+	ServerPrivateKey  string        `yaml:"server_private_key"`  // base58
+	WithdrawalFee     float64       `yaml:"withdrawal_fee"`      // SOL
+	AssistantCost     float64       `yaml:"assistant_cost"`      // SOL
+}
+
+// QuizConfig controls the quiz hub
+type QuizConfig struct {
+	StartingTokens     float64       `yaml:"starting_tokens"` // buy-in debited from the user's token balance
+	NextQuestionDelay  time.Duration `yaml:"next_question_delay"`
+	PlayerSendBuffer   int           `yaml:"player_send_buffer"`
+	QuestionBuffer     int           `yaml:"question_buffer"`
+	BetBuffer          int           `yaml:"bet_buffer"`
+	SnapshotTimeout    time.Duration `yaml:"snapshot_timeout"`
+	LedgerTimeout      time.Duration `yaml:"ledger_timeout"`
+	MaxGames           int           `yaml:"max_games"`      // open lobbies and running games
+	ArchiveDelay       time.Duration `yaml:"archive_delay"`  // time players can see final results before an ended game is closed
+	ArchiveSize        int           `yaml:"archive_size"`   // finished games kept in memory
+	HistoryBuffer      int           `yaml:"history_buffer"` // pending quiz_games writes held in memory; once full, games wait for MongoDB
+	ScoringMode        string        `yaml:"scoring_mode"`   // default for new games: elimination, points, parimutuel or lives
+	Lives              int           `yaml:"lives"`          // wrong answers allowed in lives mode
+	PointsPerAnswer    float64       `yaml:"points_per_answer"`
+	SpeedBonus         float64       `yaml:"speed_bonus"`          // extra points for an instant answer, falling to 0 at the time limit
+	PointsRounds       int           `yaml:"points_rounds"`        // questions in a points game unless the host sets max_questions
+	HouseRake          float64       `yaml:"house_rake"`           // share of each parimutuel wrong pool kept by the house
+	PoolUpdateInterval time.Duration `yaml:"pool_update_interval"` // how often bet pools are pushed during a question, 0 disables
+	PoolReveal         time.Duration `yaml:"pool_reveal"`          // show players the pool only in the last part of a question, 0 always shows it
+	BetLockIn          time.Duration `yaml:"bet_lock_in"`          // bets can't be placed, changed or cancelled this close to the deadline
+	TickInterval       time.Duration `yaml:"tick_interval"`        // how often the countdown is pushed during a question, 0 disables
+	LeaderboardSize    int           `yaml:"leaderboard_size"`     // players in the leaderboards pushed after each game
+	ReviewDuration     time.Duration `yaml:"review_duration"`      // explanation and answer distribution shown after each question, 0 skips the review
+
+	// Integrity screen run on every finished game
+	FlagIdenticalAccounts  int           `yaml:"flag_identical_accounts"`  // accounts placing the same bet on one question
+	FlagIdenticalQuestions int           `yaml:"flag_identical_questions"` // questions the same accounts must match on to be flagged
+	FlagLateWindow         time.Duration `yaml:"flag_late_window"`         // a correct bet this close to the question closing counts as late
+	FlagLateCount          int           `yaml:"flag_late_count"`          // late correct bets in one game before a player is flagged
+	FlagSharedIPMin        int           `yaml:"flag_shared_ip_min"`       // accounts on one address before they're flagged; classrooms share a NAT
+	HoldFlaggedPayouts     bool          `yaml:"hold_flagged_payouts"`     // keep flagged players' payouts until an admin reviews the alert
+}
+
+// ChatConfig controls the chat hub
+type ChatConfig struct {
+	BroadcastBuffer  int `yaml:"broadcast_buffer"`
+	ClientSendBuffer int `yaml:"client_send_buffer"`
+}
+
+// StreamConfig controls the video broadcast hub
+type StreamConfig struct {
+	FrameBuffer       int `yaml:"frame_buffer"`
+	ViewerFrameBuffer int `yaml:"viewer_frame_buffer"`
+}
+
+// WebRTCConfig controls the SFU
+type WebRTCConfig struct {
+	ICEServers []string `yaml:"ice_servers"`
+}
+
+// SocketConfig holds WebSocket keepalive timings shared by all hubs
+type SocketConfig struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	PingInterval time.Duration `yaml:"ping_interval"`
+}
+
+// AuthConfig holds the secret shared with the Next.js frontend for session tokens
+type AuthConfig struct {
+	Secret     string `yaml:"secret"`
+	CookieName string `yaml:"cookie_name"`
+}
+
+// Default returns the configuration the server used before it was configurable
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Mongo: MongoConfig{
+			Database:       "db",
+			ConnectTimeout: 10 * time.Second,
+			RequestTimeout: 10 * time.Second,
+		},
+		AI: AIConfig{
+			ServiceURL: "http://localhost:8000",
+			Timeout:    10 * time.Second,
+		},
+		Solana: SolanaConfig{
+			RPC:           "https://api.devnet.solana.com",
+			VerifyRPC:     "https://api.mainnet-beta.solana.com",
+			RPCTimeout:    30 * time.Second,
+			WithdrawalFee: 0.00005,
+			AssistantCost: 0.4,
+		},
+		Quiz: QuizConfig{
+			StartingTokens:     50,
+			NextQuestionDelay:  3 * time.Second,
+			PlayerSendBuffer:   64,
+			QuestionBuffer:     32,
+			BetBuffer:          256,
+			SnapshotTimeout:    5 * time.Second,
+			LedgerTimeout:      10 * time.Second,
+			MaxGames:           20,
+			ArchiveDelay:       30 * time.Second,
+			ArchiveSize:        100,
+			HistoryBuffer:      1024,
+			ScoringMode:        "elimination",
+			Lives:              3,
+			PointsPerAnswer:    1000,
+			SpeedBonus:         500,
+			PointsRounds:       10,
+			HouseRake:          0.05,
+			PoolUpdateInterval: time.Second,
+			BetLockIn:          2 * time.Second,
+			TickInterval:       time.Second,
+			LeaderboardSize:    10,
+
+			FlagIdenticalAccounts:  3,
+			FlagIdenticalQuestions: 3,
+			FlagLateWindow:         5 * time.Second,
+			FlagLateCount:          3,
+			FlagSharedIPMin:        10,
+		},
+		Chat: ChatConfig{
+			BroadcastBuffer:  256,
+			ClientSendBuffer: 64,
+		},
+		Stream: StreamConfig{
+			FrameBuffer:       1000,
+			ViewerFrameBuffer: 1000,
+		},
+		WebRTC: WebRTCConfig{
+			ICEServers: []string{"stun:stun.l.google.com:19302"},
+		},
+		Sockets: SocketConfig{
+			ReadTimeout:  60 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			PingInterval: 30 * time.Second,
+		},
+		Auth: AuthConfig{
+			CookieName: "medmarket_session",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file at path (skipped
+// when path is empty) and the environment, then validates it.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides fields from the environment variables the server has
+// always read, plus a few new ones for settings that used to be literals.
+func (c *Config) applyEnv() error {
+	env := envReader{}
+
+	env.String("LISTEN_ADDR", &c.Server.Addr)
+	if port := os.Getenv("PORT"); port != "" && os.Getenv("LISTEN_ADDR") == "" {
+		c.Server.Addr = ":" + port
+	}
+	env.Duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	env.String("MONGODB_URI", &c.Mongo.URI)
+	env.String("MONGODB_DB", &c.Mongo.Database)
+
+	env.String("AI_SERVICE_URL", &c.AI.ServiceURL)
+	env.Duration("AI_SERVICE_TIMEOUT", &c.AI.Timeout)
+
+	env.String("SOLANA_RPC", &c.Solana.RPC)
+	env.String("SOLANA_VERIFY_RPC", &c.Solana.VerifyRPC)
+	env.Bool("SOLANA_TEST_MODE", &c.Solana.TestMode)
+	env.String("SOL_RECEIVER_ADDRESS", &c.Solana.ReceiverAddress)
+	env.String("SOL_TREASURY_SECRET_KEY", &c.Solana.TreasurySecretKey)
+	env.String("SOLANA_PRIVATE", &c.Solana.ServerPrivateKey)
+	env.Float("SOL_WITHDRAWAL_FEE", &c.Solana.WithdrawalFee)
+	env.Float("ASSISTANT_COST_SOL", &c.Solana.AssistantCost)
+
+	env.Float("QUIZ_STARTING_TOKENS", &c.Quiz.StartingTokens)
+	env.Duration("QUIZ_NEXT_QUESTION_DELAY", &c.Quiz.NextQuestionDelay)
+	env.String("QUIZ_SCORING_MODE", &c.Quiz.ScoringMode)
+
+	// Same precedence as the frontend's getSecret()
+	env.String("NEXTAUTH_SECRET", &c.Auth.Secret)
+	env.String("SESSION_SECRET", &c.Auth.Secret)
+	env.String("JWT_SECRET", &c.Auth.Secret)
+
+	if servers := os.Getenv("WEBRTC_ICE_SERVERS"); servers != "" {
+		c.WebRTC.ICEServers = strings.Split(servers, ",")
+	}
+
+	if err := errors.Join(env.errs...); err != nil {
+		return fmt.Errorf("invalid environment: %w", err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr (LISTEN_ADDR) must not be empty")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	check(c.Mongo.URI != "", "mongo.uri (MONGODB_URI) is required")
+	check(c.Mongo.Database != "", "mongo.database (MONGODB_DB) must not be empty")
+	check(c.Mongo.ConnectTimeout > 0, "mongo.connect_timeout must be positive")
+	check(c.Mongo.RequestTimeout > 0, "mongo.request_timeout must be positive")
+
+	check(c.AI.ServiceURL != "", "ai.service_url (AI_SERVICE_URL) must not be empty")
+	check(c.AI.Timeout > 0, "ai.timeout must be positive")
+
+	check(c.Solana.RPC != "", "solana.rpc (SOLANA_RPC) must not be empty")
+	check(c.Solana.VerifyRPC != "", "solana.verify_rpc (SOLANA_VERIFY_RPC) must not be empty")
+	check(c.Solana.RPCTimeout > 0, "solana.rpc_timeout must be positive")
+	check(c.Solana.WithdrawalFee >= 0, "solana.withdrawal_fee must not be negative")
+	check(c.Solana.AssistantCost >= 0, "solana.assistant_cost must not be negative")
+
+	check(c.Quiz.StartingTokens >= 0, "quiz.starting_tokens must not be negative")
+	check(c.Quiz.NextQuestionDelay >= 0, "quiz.next_question_delay must not be negative")
+	check(c.Quiz.PlayerSendBuffer > 0, "quiz.player_send_buffer must be positive")
+	check(c.Quiz.QuestionBuffer > 0, "quiz.question_buffer must be positive")
+	check(c.Quiz.BetBuffer > 0, "quiz.bet_buffer must be positive")
+	check(c.Quiz.SnapshotTimeout > 0, "quiz.snapshot_timeout must be positive")
+	check(c.Quiz.LedgerTimeout > 0, "quiz.ledger_timeout must be positive")
+	check(c.Quiz.MaxGames > 0, "quiz.max_games must be positive")
+	check(c.Quiz.ArchiveDelay >= 0, "quiz.archive_delay must not be negative")
+	check(c.Quiz.ArchiveSize >= 0, "quiz.archive_size must not be negative")
+	check(c.Quiz.HistoryBuffer > 0, "quiz.history_buffer must be positive")
+	switch c.Quiz.ScoringMode {
+	case "elimination", "points", "parimutuel", "lives":
+	default:
+		check(false, "quiz.scoring_mode must be elimination, points, parimutuel or lives")
+	}
+	check(c.Quiz.Lives > 0, "quiz.lives must be positive")
+	check(c.Quiz.PointsPerAnswer >= 0, "quiz.points_per_answer must not be negative")
+	check(c.Quiz.SpeedBonus >= 0, "quiz.speed_bonus must not be negative")
+	check(c.Quiz.PointsRounds > 0, "quiz.points_rounds must be positive")
+	check(c.Quiz.HouseRake >= 0 && c.Quiz.HouseRake < 1, "quiz.house_rake must be at least 0 and below 1")
+	check(c.Quiz.PoolUpdateInterval >= 0, "quiz.pool_update_interval must not be negative")
+	check(c.Quiz.PoolReveal >= 0, "quiz.pool_reveal must not be negative")
+	check(c.Quiz.BetLockIn >= 0, "quiz.bet_lock_in must not be negative")
+	check(c.Quiz.TickInterval >= 0, "quiz.tick_interval must not be negative")
+	check(c.Quiz.LeaderboardSize > 0, "quiz.leaderboard_size must be positive")
+	check(c.Quiz.ReviewDuration >= 0, "quiz.review_duration must not be negative")
+	check(c.Quiz.FlagIdenticalAccounts >= 2, "quiz.flag_identical_accounts must be at least 2")
+	check(c.Quiz.FlagIdenticalQuestions > 0, "quiz.flag_identical_questions must be positive")
+	check(c.Quiz.FlagLateWindow >= 0, "quiz.flag_late_window must not be negative")
+	check(c.Quiz.FlagLateCount > 0, "quiz.flag_late_count must be positive")
+	check(c.Quiz.FlagSharedIPMin >= 2, "quiz.flag_shared_ip_min must be at least 2")
+
+	check(c.Chat.BroadcastBuffer > 0, "chat.broadcast_buffer must be positive")
+	check(c.Chat.ClientSendBuffer > 0, "chat.client_send_buffer must be positive")
+
+	check(c.Stream.FrameBuffer > 0, "stream.frame_buffer must be positive")
+	check(c.Stream.ViewerFrameBuffer > 0, "stream.viewer_frame_buffer must be positive")
+
+	check(c.Sockets.ReadTimeout > 0, "sockets.read_timeout must be positive")
+	check(c.Sockets.WriteTimeout > 0, "sockets.write_timeout must be positive")
+	check(c.Sockets.PingInterval > 0, "sockets.ping_interval must be positive")
+	check(c.Sockets.PingInterval < c.Sockets.ReadTimeout, "sockets.ping_interval must be shorter than sockets.read_timeout")
+
+	check(c.Auth.Secret != "", "auth.secret (JWT_SECRET or SESSION_SECRET) is required")
+	check(c.Auth.CookieName != "", "auth.cookie_name must not be empty")
+
+	if len(errs) > 0 {
+		lines := make([]string, len(errs))
+		for i, err := range errs {
+			lines[i] = err.Error()
+		}
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(lines, "\n  "))
+	}
+	return nil
+}
+
+// Redacted returns a copy with secrets masked so it is safe to log
+func (c Config) Redacted() Config {
+	c.Mongo.URI = redactURI(c.Mongo.URI)
+	c.Solana.TreasurySecretKey = redact(c.Solana.TreasurySecretKey)
+	c.Solana.ServerPrivateKey = redact(c.Solana.ServerPrivateKey)
+	c.Auth.Secret = redact(c.Auth.Secret)
+	c.WebRTC.ICEServers = append([]string(nil), c.WebRTC.ICEServers...)
+	return c
+}
+
+// String renders the redacted configuration as YAML
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("<config: %v>", err)
+	}
+	return string(out)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// redactURI keeps the scheme and host of a connection string but hides credentials
+func redactURI(uri string) string {
+	schemeEnd := strings.Index(uri, "://")
+	at := strings.LastIndex(uri, "@")
+	if schemeEnd == -1 || at == -1 || at < schemeEnd {
+		return uri
+	}
+	return uri[:schemeEnd+3] + "[REDACTED]" + uri[at:]
+}
+
+// envReader applies environment overrides and collects parse errors
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) String(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func (e *envReader) Bool(key string, dst *bool) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: expected true or false, got %q", key, v))
+		return
+	}
+	*dst = parsed
+}
+
+func (e *envReader) Float(key string, dst *float64) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: expected a number, got %q", key, v))
+		return
+	}
+	*dst = parsed
+}
+
+func (e *envReader) Duration(key string, dst *time.Duration) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: expected a duration like 10s, got %q", key, v))
+		return
+	}
+	*dst = parsed
+}
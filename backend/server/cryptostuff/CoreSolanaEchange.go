@@ -4,27 +4,24 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
+	"github.com/dilyxs/medMarket/config"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
-	"github.com/joho/godotenv"
 )
 
-func LoadServerAccount() *solana.Wallet {
-	godotenv.Load()
-	solana_Private_key := os.Getenv("SOLANA_PRIVATE")
-	ServerAccountPass, err := solana.WalletFromPrivateKeyBase58(solana_Private_key)
+func LoadServerAccount(cfg config.SolanaConfig) *solana.Wallet {
+	ServerAccountPass, err := solana.WalletFromPrivateKeyBase58(cfg.ServerPrivateKey)
 	if err != nil {
 		log.Fatalf("cannot load server account!")
 	}
 	return ServerAccountPass
 }
 
-func TransferFunds(AddressTargetString string, quantity int) {
-	client := rpc.New(rpc.DevNet_RPC)
-	senderWallet := LoadServerAccount()
+func TransferFunds(cfg config.SolanaConfig, AddressTargetString string, quantity int) {
+	client := rpc.New(cfg.RPC)
+	senderWallet := LoadServerAccount(cfg)
 	receiverPubKey, err := solana.PublicKeyFromBase58(AddressTargetString)
 	if err != nil {
 		log.Fatalf("Invalid receiver address: %v", err)
@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/dilyxs/medMarket/auth"
+	"github.com/dilyxs/medMarket/config"
 	"github.com/dilyxs/medMarket/pkg"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -17,21 +23,27 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("MEDMARKET_CONFIG"), "optional YAML config file")
+	flag.Parse()
+
 	// Load environment variables
 	if err := godotenv.Load("../.env"); err != nil {
 		log.Println("No .env file found, using system environment variables")
 	}
 
-	// Connect to MongoDB
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		log.Fatal("MONGODB_URI not set in environment")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
 	}
+	log.Printf("Loaded configuration:\n%s", cfg)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	pkg.ConfigureSolana(cfg.Solana)
+
+	// Connect to MongoDB
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
 	defer cancel()
 
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Mongo.URI))
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
@@ -44,68 +56,138 @@ func main() {
 	log.Println("Connected to MongoDB")
 
 	// Get users collection
-	dbName := os.Getenv("MONGODB_DB")
-	if dbName == "" {
-		dbName = "db"
+	usersCollection := mongoClient.Database(cfg.Mongo.Database).Collection("users")
+
+	// Hubs run until hubCtx is cancelled during shutdown
+	hubCtx, stopHubs := context.WithCancel(context.Background())
+	defer stopHubs()
+	var hubs sync.WaitGroup
+
+	// Initialize hubs
+	broadcastServerHub := pkg.NewBroadcastServerHub(cfg.AI, cfg.Stream, cfg.Sockets)
+	chatHub := pkg.NewChatHub(cfg.Chat)
+	quizGames := pkg.NewQuizManager(hubCtx, usersCollection, cfg.Quiz, cfg.Sockets)
+	quizGames.Frames = broadcastServerHub
+
+	// Close ledger entries left open by a previous process (crash, kill -9):
+	// pay out games that ended, refund the rest
+	if settled, refunded, err := quizGames.Ledger.Reconcile(context.Background()); err != nil {
+		log.Printf("Quiz ledger reconcile failed: %v", err)
+	} else if settled+refunded > 0 {
+		log.Printf("Quiz ledger: settled %d and refunded %d unsettled entries", settled, refunded)
 	}
-	usersCollection := mongoClient.Database(dbName).Collection("users")
+	hubs.Add(2)
+	go func() {
+		defer hubs.Done()
+		chatHub.Start(hubCtx)
+	}()
+	go func() {
+		defer hubs.Done()
+		broadcastServerHub.StartHubWork(hubCtx)
+	}()
 
-	// Get AI service URL from environment (with fallback)
-	aiServiceURL := os.Getenv("AI_SERVICE_URL")
-	if aiServiceURL == "" {
-		aiServiceURL = "http://localhost:8000"
-		log.Printf("AI_SERVICE_URL not set, using default: %s", aiServiceURL)
+	// WebRTC mode: the broadcaster publishes a VP8 track which is forwarded to
+	// viewers, annotations still come from the JPEG feed on /broadcaster
+	sfuHub, err := pkg.NewSFUHub(cfg.WebRTC.ICEServers, cfg.Sockets)
+	if err != nil {
+		log.Fatalf("Failed to create WebRTC SFU: %v", err)
 	}
+	broadcastServerHub.SFU = sfuHub
 
-	// Initialize hubs
-	broadcastServerHub := pkg.NewBroadcastServerHub(aiServiceURL)
-	chatHub := pkg.NewChatHub()
-	quizHub := pkg.NewQuizHub(usersCollection)
-	go chatHub.Start()
-	go broadcastServerHub.StartHubWork()
-	go quizHub.Start()
+	// Session tokens are issued by the Next.js frontend with the same secret
+	verifier := auth.NewVerifier(cfg.Auth.Secret, cfg.Auth.CookieName)
+	roles := auth.NewRoleStore(usersCollection, cfg.Mongo.RequestTimeout)
 
 	// Setup router
 	router := mux.NewRouter()
 
-	log.Printf("Starting server on :8080 with AI service at %s", aiServiceURL)
+	log.Printf("Starting server on %s with AI service at %s", cfg.Server.Addr, cfg.AI.ServiceURL)
 
-	router.HandleFunc("/broadcaster", func(w http.ResponseWriter, r *http.Request) {
-		pkg.ConnectBroadCaster(broadcastServerHub, w, r)
-	})
+	router.HandleFunc("/broadcaster", roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+		user, takeover, ok := hostRequest(w, r)
+		if !ok {
+			return
+		}
+		pkg.ConnectBroadCaster(broadcastServerHub, w, r, user.UserID, takeover)
+	}))
 	router.HandleFunc("/viewer", func(w http.ResponseWriter, r *http.Request) {
 		id := rand.Intn(100000000)
 		pkg.AddNewUserViewerToHub(broadcastServerHub, w, r, id)
 	})
+	router.HandleFunc("/rtc-broadcaster", roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+		user, takeover, ok := hostRequest(w, r)
+		if !ok {
+			return
+		}
+		pkg.ConnectSFUBroadcaster(sfuHub, w, r, user.UserID, takeover)
+	}))
+	router.HandleFunc("/rtc-viewer", func(w http.ResponseWriter, r *http.Request) {
+		id := rand.Intn(100000000)
+		pkg.ConnectSFUViewer(sfuHub, w, r, id)
+	})
 	router.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
 		clientID := fmt.Sprintf("client-%d-%d", rand.Intn(1000000), rand.Intn(1000000))
 		pkg.AddChatClient(chatHub, w, r, clientID)
 	})
-	router.HandleFunc("/quiz-broadcaster", func(w http.ResponseWriter, r *http.Request) {
-		pkg.ConnectQuizBroadcaster(quizHub, w, r)
-	})
-	router.HandleFunc("/quiz-viewer", func(w http.ResponseWriter, r *http.Request) {
-		// Extract user from query params or headers
-		// For now, we'll use query params: ?userId=...&username=...&email=...
-		userID := r.URL.Query().Get("userId")
-		username := r.URL.Query().Get("username")
-		email := r.URL.Query().Get("email")
-
-		if userID == "" || email == "" {
-			http.Error(w, "Missing user credentials", http.StatusBadRequest)
+	router.HandleFunc("/quiz-broadcaster", roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+		user, takeover, ok := hostRequest(w, r)
+		if !ok {
 			return
 		}
 
-		if username == "" {
-			username = email
+		// ?game= picks a lobby; without it the host gets their open game or a new one
+		var game *pkg.QuizHub
+		var err error
+		if gameID := r.URL.Query().Get("game"); gameID != "" {
+			game, err = quizGames.Game(gameID)
+		} else {
+			game, err = quizGames.HostGame(user.UserID)
+		}
+		if err != nil {
+			respondGameError(w, err)
+			return
+		}
+		if !canHost(user, game) {
+			http.Error(w, `{"error": "only the host can run this game"}`, http.StatusForbidden)
+			return
 		}
+		pkg.ConnectQuizBroadcaster(game, w, r, user.UserID, takeover, user.Role.AtLeast(auth.RoleAdmin))
+	}))
+	router.HandleFunc("/quiz-viewer", auth.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		// Identity comes from the verified session token, never the query string
+		user, _ := auth.UserFromContext(r.Context())
 
-		pkg.ConnectQuizPlayer(quizHub, w, r, userID, username, email)
-	})
+		// ?game= picks a game; without it players join the newest open one
+		var game *pkg.QuizHub
+		var err error
+		if gameID := r.URL.Query().Get("game"); gameID != "" {
+			game, err = quizGames.Game(gameID)
+		} else {
+			game, err = quizGames.Latest()
+		}
+		if err != nil {
+			respondGameError(w, err)
+			return
+		}
+		// ?spectate=true watches without buying in
+		if r.URL.Query().Get("spectate") == "true" {
+			pkg.ConnectQuizSpectator(game, w, r, user.UserID, user.DisplayName())
+			return
+		}
+		pkg.ConnectQuizPlayer(game, w, r, user.UserID, user.DisplayName(), user.Email)
+	}))
 	router.HandleFunc("/verify_deposit", pkg.VerifyDeposit)
 
+	// Quiz lobbies, question banks and playlists
+	banks := pkg.NewQuestionBankStore(mongoClient.Database(cfg.Mongo.Database), cfg.Mongo.RequestTimeout)
+	RegisterQuizRoutes(router, quizGames, banks, roles)
+	RegisterBankRoutes(router, banks, roles)
+
+	// Admin-only routes
+	RegisterAdminRoutes(router, roles, quizGames)
+
 	// Register Solana routes
-	// RegisterSolanaRoutes(router, usersCollection)
+	// RegisterSolanaRoutes(router, usersCollection, cfg)
 
 	// CORS middleware
 	router.Use(func(next http.Handler) http.Handler {
@@ -121,6 +203,59 @@ func main() {
 		})
 	})
 
-	fmt.Println("medMarket backend server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	// Verify session tokens on every route and WebSocket upgrade
+	router.Use(verifier.Middleware)
+
+	server := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: router,
+	}
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	go func() {
+		fmt.Printf("medMarket backend server running on %s\n", cfg.Server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+
+	<-signalCtx.Done()
+	log.Println("Shutdown signal received")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// Stop accepting new connections first, then close the hijacked sockets
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+	stopHubs()
+
+	hubsDone := make(chan struct{})
+	go func() {
+		hubs.Wait()
+		quizGames.Wait()
+		close(hubsDone)
+	}()
+
+	select {
+	case <-hubsDone:
+		log.Println("All hubs stopped")
+	case <-shutdownCtx.Done():
+		log.Println("Shutdown deadline exceeded, exiting anyway")
+	}
+}
+
+// hostRequest reads ?takeover=true from a host socket request. Replacing a
+// connected host is only allowed for admins; everyone else gets 403.
+func hostRequest(w http.ResponseWriter, r *http.Request) (*auth.User, bool, bool) {
+	user, _ := auth.UserFromContext(r.Context())
+	takeover := r.URL.Query().Get("takeover") == "true"
+	if takeover && !user.Role.AtLeast(auth.RoleAdmin) {
+		http.Error(w, `{"error": "taking over a host requires the admin role"}`, http.StatusForbidden)
+		return nil, false, false
+	}
+	return user, takeover, true
 }
@@ -1,11 +1,13 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/dilyxs/medMarket/config"
 	"github.com/gorilla/websocket"
 )
 
@@ -27,20 +29,26 @@ type ChatHub struct {
 	Register   chan *ChatClient
 	Unregister chan *ChatClient
 	Mu         sync.RWMutex
+	Config     config.ChatConfig
 }
 
-func NewChatHub() *ChatHub {
+func NewChatHub(cfg config.ChatConfig) *ChatHub {
 	return &ChatHub{
 		Clients:    make(map[string]*ChatClient),
-		Broadcast:  make(chan ChatMessage, 256),
+		Broadcast:  make(chan ChatMessage, cfg.BroadcastBuffer),
 		Register:   make(chan *ChatClient, 16),
 		Unregister: make(chan *ChatClient, 16),
+		Config:     cfg,
 	}
 }
 
-func (h *ChatHub) Start() {
+func (h *ChatHub) Start(ctx context.Context) {
 	for {
 		select {
+		case <-ctx.Done():
+			h.closeAll(ShutdownReason)
+			return
+
 		case client := <-h.Register:
 			h.Mu.Lock()
 			h.Clients[client.ID] = client
@@ -70,6 +78,22 @@ func (h *ChatHub) Start() {
 	}
 }
 
+// closeAll sends a close frame to every client and drops them from the hub
+func (h *ChatHub) closeAll(reason string) {
+	h.Mu.Lock()
+	clients := make([]*ChatClient, 0, len(h.Clients))
+	for id, client := range h.Clients {
+		clients = append(clients, client)
+		delete(h.Clients, id)
+	}
+	h.Mu.Unlock()
+
+	for _, client := range clients {
+		sendCloseFrame(client.Conn, reason)
+	}
+	fmt.Printf("Chat hub closed %d clients\n", len(clients))
+}
+
 func (c *ChatClient) ReadPump(hub *ChatHub) {
 	defer func() {
 		hub.Unregister <- c
@@ -125,7 +149,7 @@ func AddChatClient(hub *ChatHub, w http.ResponseWriter, r *http.Request, clientI
 	client := &ChatClient{
 		ID:   clientID,
 		Conn: conn,
-		Send: make(chan ChatMessage, 64),
+		Send: make(chan ChatMessage, hub.Config.ClientSendBuffer),
 	}
 
 	hub.Register <- client
@@ -1,11 +1,13 @@
 package pkg
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/dilyxs/medMarket/config"
 	"github.com/gorilla/websocket"
 )
 
@@ -15,10 +17,12 @@ type UserViewer struct {
 	UserReceivingVideoDetails chan VideoFrameWithAnnotations
 	QandAnswerChan            chan QandAnswer
 	done                      chan struct{}
+	sockets                   config.SocketConfig
 	Mu                        sync.Mutex
 }
 type Broadcaster struct {
 	ID                      int
+	UserID                  string
 	Conn                    *websocket.Conn
 	UserReadingVideoDetails chan VideoFrameWithAnnotations
 	Mu                      sync.Mutex
@@ -55,6 +59,7 @@ type VideoFrameValere struct {
 	Frame         []byte              `json:"frame"`
 	HasRectangle  bool                `json:"hasrectangle"`
 	RectangleData RectangleDataValere `json:"rectangle"`
+	Timestamp     int64               `json:"timestamp"` // capture time in Unix ms, optional
 }
 
 type AnnotationMetadata struct {
@@ -63,8 +68,9 @@ type AnnotationMetadata struct {
 	Regions       []Region `json:"regions"`
 }
 type VideoFrameWithAnnotations struct {
-	Frame    []byte             `json:"frame"`
-	Metadata AnnotationMetadata `json:"metadata"`
+	Frame     []byte             `json:"frame"`
+	Metadata  AnnotationMetadata `json:"metadata"`
+	Timestamp int64              `json:"timestamp"`
 }
 
 var upgrader = websocket.Upgrader{
@@ -98,6 +104,15 @@ type BroadcastServerHub struct {
 	AIServiceURL   string
 	CurrentSession string
 	AIClient       *AIServiceClient
+	// Optional WebRTC fan-out; annotations are mirrored to its data channels
+	SFU *SFUHub
+	// Currently connected JPEG broadcaster, closed on shutdown
+	ActiveBroadcaster *Broadcaster
+	Stream            config.StreamConfig
+	Sockets           config.SocketConfig
+
+	// Last frame sent by the broadcaster, for quiz questions about it
+	LatestFrame *VideoFrameWithAnnotations
 }
 
 type UserViewerAddition struct {
@@ -114,8 +129,9 @@ func AddNewUserViewerToHub(hub *BroadcastServerHub, w http.ResponseWriter, r *ht
 	VideoUser := &UserViewer{
 		ID:                        viewerID,
 		Conn:                      conn,
-		UserReceivingVideoDetails: make(chan VideoFrameWithAnnotations, 1000),
+		UserReceivingVideoDetails: make(chan VideoFrameWithAnnotations, hub.Stream.ViewerFrameBuffer),
 		done:                      make(chan struct{}),
+		sockets:                   hub.Sockets,
 		Mu:                        sync.Mutex{},
 	}
 	hub.ListenForIncomingUserOrDisconnections <- &UserViewerAddition{
@@ -141,9 +157,9 @@ func (v *UserViewer) ReadPump(hub *BroadcastServerHub) {
 	}()
 
 	// Set up pong handler to keep connection alive
-	v.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	v.Conn.SetReadDeadline(time.Now().Add(v.sockets.ReadTimeout))
 	v.Conn.SetPongHandler(func(string) error {
-		v.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		v.Conn.SetReadDeadline(time.Now().Add(v.sockets.ReadTimeout))
 		return nil
 	})
 
@@ -176,7 +192,7 @@ func (v *UserViewer) ListenForVideoDetails() {
 			return
 		case message := <-v.UserReceivingVideoDetails:
 			v.Mu.Lock()
-			v.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			v.Conn.SetWriteDeadline(time.Now().Add(v.sockets.WriteTimeout))
 			if err := v.Conn.WriteJSON(message); err != nil { // happens if user ends the session
 				log.Printf("Viewer %d ListenForVideoDetails error: %v", v.ID, err)
 				return
@@ -187,7 +203,7 @@ func (v *UserViewer) ListenForVideoDetails() {
 }
 
 func (v *UserViewer) PingLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(v.sockets.PingInterval)
 	defer ticker.Stop()
 
 	for {
@@ -195,7 +211,7 @@ func (v *UserViewer) PingLoop() {
 		case <-v.done:
 			return
 		case <-ticker.C:
-			v.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			v.Conn.SetWriteDeadline(time.Now().Add(v.sockets.WriteTimeout))
 			v.Mu.Lock()
 			if err := v.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				log.Printf("Viewer %d PingLoop error: %v", v.ID, err)
@@ -217,6 +233,10 @@ func (b *BroadcastServerHub) EnndBroadcastingSession() {
 			b.CurrentSession = ""
 		}
 
+		b.Mu.Lock()
+		b.LatestFrame = nil
+		b.Mu.Unlock()
+
 		// Notify all viewers
 		b.Mu.RLock()
 		for _, viewer := range b.Viewers {
@@ -228,7 +248,17 @@ func (b *BroadcastServerHub) EnndBroadcastingSession() {
 	}
 }
 
-func ConnectBroadCaster(hub *BroadcastServerHub, w http.ResponseWriter, r *http.Request) {
+// ConnectBroadCaster streams video from hostID. A second host is refused
+// unless takeover is set, which callers must only allow for admins.
+func ConnectBroadCaster(hub *BroadcastServerHub, w http.ResponseWriter, r *http.Request, hostID string, takeover bool) {
+	hub.Mu.RLock()
+	current := hub.ActiveBroadcaster
+	hub.Mu.RUnlock()
+	if current != nil && current.UserID != hostID && !takeover {
+		http.Error(w, ErrHostActive.Error(), http.StatusConflict)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Broadcaster WebSocket upgrade failed: %v", err)
@@ -261,10 +291,26 @@ func ConnectBroadCaster(hub *BroadcastServerHub, w http.ResponseWriter, r *http.
 		}
 	}()
 	Broadcaster := &Broadcaster{
+		UserID:                  hostID,
 		Conn:                    conn,
-		UserReadingVideoDetails: make(chan VideoFrameWithAnnotations, 1000),
+		UserReadingVideoDetails: make(chan VideoFrameWithAnnotations, hub.Stream.FrameBuffer),
 		Mu:                      sync.Mutex{},
 	}
+	hub.Mu.Lock()
+	previous := hub.ActiveBroadcaster
+	hub.ActiveBroadcaster = Broadcaster
+	hub.Mu.Unlock()
+	if previous != nil {
+		log.Printf("Broadcaster %s replaced by %s", previous.UserID, hostID)
+		sendCloseFrame(previous.Conn, HostTakeoverReason)
+	}
+	defer func() {
+		hub.Mu.Lock()
+		if hub.ActiveBroadcaster == Broadcaster {
+			hub.ActiveBroadcaster = nil
+		}
+		hub.Mu.Unlock()
+	}()
 
 	// Start goroutine to send annotated frames back to broadcaster
 	go func() {
@@ -380,6 +426,16 @@ func (b *Broadcaster) ListenForVideoInput(hub *BroadcastServerHub) {
 			}
 		}
 
+		annotatedFrame.Timestamp = newMessage.Timestamp
+		if annotatedFrame.Timestamp == 0 {
+			annotatedFrame.Timestamp = time.Now().UnixMilli()
+		}
+
+		hub.Mu.Lock()
+		latest := annotatedFrame
+		hub.LatestFrame = &latest
+		hub.Mu.Unlock()
+
 		// Send frame with metadata to viewers
 		hub.VideoDetailsChan <- annotatedFrame
 
@@ -403,27 +459,71 @@ func (b *BroadcastServerHub) ShareBroadscastingDetails() {
 			}
 		}
 		b.Mu.RUnlock()
+
+		if b.SFU != nil {
+			b.SFU.PublishAnnotations(message)
+		}
 	}
 }
 
-func NewBroadcastServerHub(aiServiceURL string) *BroadcastServerHub {
+func NewBroadcastServerHub(ai config.AIConfig, stream config.StreamConfig, sockets config.SocketConfig) *BroadcastServerHub {
 	return &BroadcastServerHub{
-		ValereRawVideoDetailsChan:             make(chan VideoFrameValere, 1000),
+		ValereRawVideoDetailsChan:             make(chan VideoFrameValere, stream.FrameBuffer),
 		AcceptingUsers:                        true,
 		Viewers:                               make(map[int]*UserViewer),
-		VideoDetailsChan:                      make(chan VideoFrameWithAnnotations, 1000),
+		VideoDetailsChan:                      make(chan VideoFrameWithAnnotations, stream.FrameBuffer),
 		EndOFStream:                           make(chan bool),
 		ListenForIncomingUserOrDisconnections: make(chan *UserViewerAddition, 1000),
 		QandAnswer:                            make(chan QandAnswer, 100),
 		Mu:                                    sync.RWMutex{},
-		AIServiceURL:                          aiServiceURL,
+		AIServiceURL:                          ai.ServiceURL,
 		CurrentSession:                        "",
-		AIClient:                              NewAIServiceClient(aiServiceURL, 10*time.Second),
+		AIClient:                              NewAIServiceClient(ai.ServiceURL, ai.Timeout),
+		Stream:                                stream,
+		Sockets:                               sockets,
 	}
 }
 
-func (b *BroadcastServerHub) StartHubWork() {
+// StartHubWork runs the hub until ctx is cancelled, then ends the AI session
+// and closes the broadcaster and every viewer with a close frame.
+func (b *BroadcastServerHub) StartHubWork(ctx context.Context) {
 	go b.AddOrRemoveUser()
 	go b.ShareBroadscastingDetails()
 	go b.EnndBroadcastingSession()
+
+	<-ctx.Done()
+	b.Shutdown(ShutdownReason)
+}
+
+// Shutdown stops accepting viewers, ends any AI session and closes every socket
+func (b *BroadcastServerHub) Shutdown(reason string) {
+	b.Mu.Lock()
+	b.AcceptingUsers = false
+	broadcaster := b.ActiveBroadcaster
+	viewers := make([]*UserViewer, 0, len(b.Viewers))
+	for _, viewer := range b.Viewers {
+		viewers = append(viewers, viewer)
+	}
+	b.Mu.Unlock()
+
+	if b.CurrentSession != "" {
+		log.Printf("Shutdown: ending AI session %s", b.CurrentSession)
+		if err := b.AIClient.EndSession(b.CurrentSession); err != nil {
+			log.Printf("Error ending AI session: %v", err)
+		}
+		b.CurrentSession = ""
+	}
+
+	if broadcaster != nil {
+		sendCloseFrame(broadcaster.Conn, reason)
+	}
+	for _, viewer := range viewers {
+		sendCloseFrame(viewer.Conn, reason)
+	}
+
+	if b.SFU != nil {
+		b.SFU.Close(reason)
+	}
+
+	log.Printf("Broadcast hub shut down (%d viewers closed)", len(viewers))
 }
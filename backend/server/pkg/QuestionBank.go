@@ -0,0 +1,481 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrBankNotFound     = errors.New("question bank not found")
+	ErrQuestionNotFound = errors.New("question not found")
+	ErrPlaylistNotFound = errors.New("playlist not found")
+)
+
+// ValidationError is returned when a bank, question or playlist is rejected
+// because of its content rather than a database failure
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+func invalid(err error) error {
+	return &ValidationError{Err: err}
+}
+
+// Question difficulties accepted in banks. Empty means unrated.
+var difficulties = map[string]bool{"": true, "easy": true, "medium": true, "hard": true}
+
+// BankQuestion is a reusable question stored in a bank
+type BankQuestion struct {
+	ID           string    `bson:"id" json:"id"`
+	Question     string    `bson:"question" json:"question"`
+	Options      []string  `bson:"options" json:"options"`
+	CorrectIndex int       `bson:"correct_index" json:"correct_index"`
+	TimeLimit    int       `bson:"time_limit" json:"time_limit"`
+	Tags         []string  `bson:"tags" json:"tags"`
+	Difficulty   string    `bson:"difficulty,omitempty" json:"difficulty,omitempty"`
+	Explanation  string    `bson:"explanation,omitempty" json:"explanation,omitempty"`
+	ReferenceURL string    `bson:"reference_url,omitempty" json:"reference_url,omitempty"`
+	ImageURL     string    `bson:"image_url,omitempty" json:"image_url,omitempty"`
+	FrameRef     string    `bson:"frame_ref,omitempty" json:"frame_ref,omitempty"` // stream frame the question refers to
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+
+	QuestionFormat `bson:",inline"` // multi_select, numeric and hotspot questions
+}
+
+// Validate applies the same rules as questions submitted live, plus the
+// bank-only fields
+func (q *BankQuestion) Validate() error {
+	question := q.ToQuestion("")
+	if err := question.Validate(); err != nil {
+		return err
+	}
+	if !difficulties[q.Difficulty] {
+		return errors.New("difficulty must be easy, medium or hard")
+	}
+	return nil
+}
+
+// ToQuestion converts the bank question to a live question with the given ID
+func (q *BankQuestion) ToQuestion(id string) *Question {
+	return &Question{
+		ID:             id,
+		Type:           q.Type,
+		Question:       q.Question,
+		Options:        q.Options,
+		CorrectIndex:   q.CorrectIndex,
+		CorrectIndices: q.CorrectIndices,
+		Numeric:        q.Numeric,
+		Answer:         q.Answer,
+		ImageURL:       q.ImageURL,
+		Region:         q.Region,
+		Explanation:    q.Explanation,
+		ReferenceURL:   q.ReferenceURL,
+		TimeLimit:      q.TimeLimit,
+		CreatedAt:      time.Now(),
+	}
+}
+
+// QuestionBank is a named set of questions owned by an instructor
+type QuestionBank struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	OwnerID     string             `bson:"owner_id" json:"owner_id"`
+	Tags        []string           `bson:"tags" json:"tags"`
+	Questions   []BankQuestion     `bson:"questions" json:"questions"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// PlaylistItem points at one question in a bank
+type PlaylistItem struct {
+	BankID     primitive.ObjectID `bson:"bank_id" json:"bank_id"`
+	QuestionID string             `bson:"question_id" json:"question_id"`
+}
+
+// Playlist is an ordered run of bank questions played with a fixed gap
+type Playlist struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	OwnerID    string             `bson:"owner_id" json:"owner_id"`
+	Items      []PlaylistItem     `bson:"items" json:"items"`
+	GapSeconds int                `bson:"gap_seconds" json:"gap_seconds"` // pause between questions, 0 uses the server default
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// QuestionBankStore keeps banks in question_banks and playlists in quiz_playlists
+type QuestionBankStore struct {
+	Banks     *mongo.Collection
+	Playlists *mongo.Collection
+	Timeout   time.Duration
+}
+
+// NewQuestionBankStore creates a store in db
+func NewQuestionBankStore(db *mongo.Database, timeout time.Duration) *QuestionBankStore {
+	return &QuestionBankStore{
+		Banks:     db.Collection("question_banks"),
+		Playlists: db.Collection("quiz_playlists"),
+		Timeout:   timeout,
+	}
+}
+
+// normalizeTags lower-cases and de-duplicates tags so "POCUS" and "pocus" match
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// prepareQuestion validates q and fills in its ID, tags and timestamps
+func prepareQuestion(q *BankQuestion, now time.Time) error {
+	if err := q.Validate(); err != nil {
+		return invalid(err)
+	}
+	if q.ID == "" {
+		q.ID = primitive.NewObjectID().Hex()
+	}
+	q.Tags = normalizeTags(q.Tags)
+	if q.CreatedAt.IsZero() {
+		q.CreatedAt = now
+	}
+	q.UpdatedAt = now
+	return nil
+}
+
+// CreateBank validates and stores a new bank
+func (s *QuestionBankStore) CreateBank(ctx context.Context, bank *QuestionBank) error {
+	if strings.TrimSpace(bank.Name) == "" {
+		return invalid(errors.New("name is required"))
+	}
+
+	now := time.Now()
+	if bank.Questions == nil {
+		bank.Questions = []BankQuestion{}
+	}
+	for i := range bank.Questions {
+		if err := prepareQuestion(&bank.Questions[i], now); err != nil {
+			return invalid(fmt.Errorf("question %d: %w", i+1, err))
+		}
+	}
+	bank.ID = primitive.NewObjectID()
+	bank.Tags = normalizeTags(bank.Tags)
+	bank.CreatedAt = now
+	bank.UpdatedAt = now
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	_, err := s.Banks.InsertOne(ctx, bank)
+	return err
+}
+
+// ListBanks returns banks, optionally only those with a question or bank tag
+func (s *QuestionBankStore) ListBanks(ctx context.Context, tag string) ([]QuestionBank, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+		filter = bson.M{"$or": bson.A{bson.M{"tags": tag}, bson.M{"questions.tags": tag}}}
+	}
+
+	cursor, err := s.Banks.Find(ctx, filter, options.Find().SetSort(bson.M{"updated_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	banks := make([]QuestionBank, 0)
+	if err := cursor.All(ctx, &banks); err != nil {
+		return nil, err
+	}
+	return banks, nil
+}
+
+// GetBank fetches a bank by its hex ID
+func (s *QuestionBankStore) GetBank(ctx context.Context, id string) (*QuestionBank, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrBankNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var bank QuestionBank
+	err = s.Banks.FindOne(ctx, bson.M{"_id": oid}).Decode(&bank)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrBankNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bank, nil
+}
+
+// UpdateBank changes a bank's name, description and tags
+func (s *QuestionBankStore) UpdateBank(ctx context.Context, id primitive.ObjectID, name, description string, tags []string) error {
+	if strings.TrimSpace(name) == "" {
+		return invalid(errors.New("name is required"))
+	}
+	return s.updateBank(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"name":        name,
+		"description": description,
+		"tags":        normalizeTags(tags),
+		"updated_at":  time.Now(),
+	}}, ErrBankNotFound)
+}
+
+// DeleteBank removes a bank. Playlists pointing at it skip its questions.
+func (s *QuestionBankStore) DeleteBank(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	result, err := s.Banks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrBankNotFound
+	}
+	return nil
+}
+
+// AddQuestion validates q and appends it to the bank
+func (s *QuestionBankStore) AddQuestion(ctx context.Context, bankID primitive.ObjectID, q *BankQuestion) error {
+	q.ID = ""
+	q.CreatedAt = time.Time{}
+	if err := prepareQuestion(q, time.Now()); err != nil {
+		return err
+	}
+	return s.updateBank(ctx, bson.M{"_id": bankID}, bson.M{
+		"$push": bson.M{"questions": q},
+		"$set":  bson.M{"updated_at": q.UpdatedAt},
+	}, ErrBankNotFound)
+}
+
+// UpdateQuestion replaces the question with q.ID in the bank
+func (s *QuestionBankStore) UpdateQuestion(ctx context.Context, bankID primitive.ObjectID, q *BankQuestion, createdAt time.Time) error {
+	q.CreatedAt = createdAt
+	if err := prepareQuestion(q, time.Now()); err != nil {
+		return err
+	}
+	return s.updateBank(ctx, bson.M{"_id": bankID, "questions.id": q.ID}, bson.M{"$set": bson.M{
+		"questions.$": q,
+		"updated_at":  q.UpdatedAt,
+	}}, ErrQuestionNotFound)
+}
+
+// DeleteQuestion removes a question from the bank
+func (s *QuestionBankStore) DeleteQuestion(ctx context.Context, bankID primitive.ObjectID, questionID string) error {
+	return s.updateBank(ctx, bson.M{"_id": bankID, "questions.id": questionID}, bson.M{
+		"$pull": bson.M{"questions": bson.M{"id": questionID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}, ErrQuestionNotFound)
+}
+
+func (s *QuestionBankStore) updateBank(ctx context.Context, filter, update bson.M, notFound error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	result, err := s.Banks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// QuestionsFromBank returns the bank's questions ready to queue, optionally
+// only those carrying tag
+func QuestionsFromBank(bank *QuestionBank, tag string) []*Question {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	questions := make([]*Question, 0, len(bank.Questions))
+	for i := range bank.Questions {
+		q := &bank.Questions[i]
+		if tag != "" && !containsTag(q.Tags, tag) {
+			continue
+		}
+		questions = append(questions, q.ToQuestion(liveQuestionID(len(questions))))
+	}
+	return questions
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// liveQuestionID makes a unique ID for the i-th question queued in one batch
+func liveQuestionID(i int) string {
+	return fmt.Sprintf("q-%d-%d", time.Now().UnixNano(), i)
+}
+
+// CreatePlaylist validates and stores a playlist
+func (s *QuestionBankStore) CreatePlaylist(ctx context.Context, playlist *Playlist) error {
+	if err := validatePlaylist(playlist); err != nil {
+		return invalid(err)
+	}
+
+	now := time.Now()
+	playlist.ID = primitive.NewObjectID()
+	playlist.CreatedAt = now
+	playlist.UpdatedAt = now
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	_, err := s.Playlists.InsertOne(ctx, playlist)
+	return err
+}
+
+func validatePlaylist(playlist *Playlist) error {
+	if strings.TrimSpace(playlist.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(playlist.Items) == 0 {
+		return errors.New("playlist needs at least one question")
+	}
+	if playlist.GapSeconds < 0 {
+		return errors.New("gap_seconds must not be negative")
+	}
+	return nil
+}
+
+// ListPlaylists returns every playlist, most recently updated first
+func (s *QuestionBankStore) ListPlaylists(ctx context.Context) ([]Playlist, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	cursor, err := s.Playlists.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"updated_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	playlists := make([]Playlist, 0)
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
+	return playlists, nil
+}
+
+// GetPlaylist fetches a playlist by its hex ID
+func (s *QuestionBankStore) GetPlaylist(ctx context.Context, id string) (*Playlist, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrPlaylistNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var playlist Playlist
+	err = s.Playlists.FindOne(ctx, bson.M{"_id": oid}).Decode(&playlist)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPlaylistNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// UpdatePlaylist replaces a playlist's name, items and gap
+func (s *QuestionBankStore) UpdatePlaylist(ctx context.Context, playlist *Playlist) error {
+	if err := validatePlaylist(playlist); err != nil {
+		return invalid(err)
+	}
+	playlist.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	result, err := s.Playlists.UpdateOne(ctx, bson.M{"_id": playlist.ID}, bson.M{"$set": bson.M{
+		"name":        playlist.Name,
+		"items":       playlist.Items,
+		"gap_seconds": playlist.GapSeconds,
+		"updated_at":  playlist.UpdatedAt,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPlaylistNotFound
+	}
+	return nil
+}
+
+// DeletePlaylist removes a playlist
+func (s *QuestionBankStore) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	result, err := s.Playlists.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrPlaylistNotFound
+	}
+	return nil
+}
+
+// QuestionsForPlaylist resolves a playlist to questions in playlist order.
+// Items whose bank or question has since been deleted are skipped.
+func (s *QuestionBankStore) QuestionsForPlaylist(ctx context.Context, playlist *Playlist) ([]*Question, error) {
+	bankIDs := make([]primitive.ObjectID, 0, len(playlist.Items))
+	for _, item := range playlist.Items {
+		bankIDs = append(bankIDs, item.BankID)
+	}
+
+	findCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	cursor, err := s.Banks.Find(findCtx, bson.M{"_id": bson.M{"$in": bankIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var banks []QuestionBank
+	if err := cursor.All(findCtx, &banks); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]map[string]*BankQuestion, len(banks))
+	for i := range banks {
+		questions := make(map[string]*BankQuestion, len(banks[i].Questions))
+		for j := range banks[i].Questions {
+			questions[banks[i].Questions[j].ID] = &banks[i].Questions[j]
+		}
+		byID[banks[i].ID] = questions
+	}
+
+	questions := make([]*Question, 0, len(playlist.Items))
+	for _, item := range playlist.Items {
+		if q, ok := byID[item.BankID][item.QuestionID]; ok {
+			questions = append(questions, q.ToQuestion(liveQuestionID(len(questions))))
+		}
+	}
+	return questions, nil
+}
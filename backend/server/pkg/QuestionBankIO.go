@@ -0,0 +1,418 @@
+package pkg
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bankCSVHeader is the column layout written by export. Import matches columns
+// by name, so spreadsheets may reorder them or leave optional ones out.
+var bankCSVHeader = []string{
+	"id", "question", "option_a", "option_b", "option_c", "option_d",
+	"correct_index", "time_limit", "tags", "difficulty", "explanation", "reference_url", "image_url", "frame_ref",
+	"type", "correct_indices", "answer", "min", "max", "unit", "tolerance", "region",
+}
+
+var requiredCSVColumns = []string{"question", "option_a", "option_b", "correct_index", "time_limit"}
+
+// ImportRowError reports why one row of an import was rejected. Row is the
+// 1-based CSV line (the header is line 1) or the 1-based JSON question index.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportRow is a parsed question and the row it came from
+type ImportRow struct {
+	Row      int
+	Question BankQuestion
+}
+
+// ImportError is returned when an import has invalid rows; nothing is written
+type ImportError struct {
+	Rows []ImportRowError
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d invalid rows", len(e.Rows))
+}
+
+// ExportedQuestion is a bank question without timestamps, so exports only
+// change when the questions do
+type ExportedQuestion struct {
+	ID           string   `json:"id"`
+	Question     string   `json:"question"`
+	Options      []string `json:"options"`
+	CorrectIndex int      `json:"correct_index"`
+	TimeLimit    int      `json:"time_limit"`
+	Tags         []string `json:"tags"`
+	Difficulty   string   `json:"difficulty,omitempty"`
+	Explanation  string   `json:"explanation,omitempty"`
+	ReferenceURL string   `json:"reference_url,omitempty"`
+	ImageURL     string   `json:"image_url,omitempty"`
+	FrameRef     string   `json:"frame_ref,omitempty"`
+
+	QuestionFormat
+}
+
+// BankExport is the JSON file format for a bank
+type BankExport struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Tags        []string           `json:"tags"`
+	Questions   []ExportedQuestion `json:"questions"`
+}
+
+// ExportBank converts a bank to its file format
+func ExportBank(bank *QuestionBank) BankExport {
+	export := BankExport{
+		Name:        bank.Name,
+		Description: bank.Description,
+		Tags:        bank.Tags,
+		Questions:   make([]ExportedQuestion, 0, len(bank.Questions)),
+	}
+	if export.Tags == nil {
+		export.Tags = []string{}
+	}
+	for _, q := range bank.Questions {
+		tags := q.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		export.Questions = append(export.Questions, ExportedQuestion{
+			ID:           q.ID,
+			Question:     q.Question,
+			Options:      q.Options,
+			CorrectIndex: q.CorrectIndex,
+			TimeLimit:    q.TimeLimit,
+			Tags:         tags,
+			Difficulty:   q.Difficulty,
+			Explanation:  q.Explanation,
+			ReferenceURL: q.ReferenceURL,
+			ImageURL:     q.ImageURL,
+			FrameRef:     q.FrameRef,
+
+			QuestionFormat: q.QuestionFormat,
+		})
+	}
+	return export
+}
+
+// WriteBankJSON writes the bank as indented JSON
+func WriteBankJSON(w io.Writer, bank *QuestionBank) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ExportBank(bank))
+}
+
+// WriteBankCSV writes one row per question. Tags are joined with ";".
+func WriteBankCSV(w io.Writer, bank *QuestionBank) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(bankCSVHeader); err != nil {
+		return err
+	}
+
+	for _, q := range bank.Questions {
+		options := make([]string, 4)
+		copy(options, q.Options)
+		row := []string{
+			q.ID, q.Question, options[0], options[1], options[2], options[3],
+			strconv.Itoa(q.CorrectIndex), strconv.Itoa(q.TimeLimit),
+			strings.Join(q.Tags, ";"), q.Difficulty, q.Explanation, q.ReferenceURL, q.ImageURL, q.FrameRef,
+		}
+		row = append(row, formatCSVColumns(q.QuestionFormat)...)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatCSVColumns writes the type, correct_indices, answer, min, max, unit,
+// tolerance and region cells. They are empty for single-choice questions.
+func formatCSVColumns(format QuestionFormat) []string {
+	cells := make([]string, 8)
+	cells[0] = format.Type
+	indices := make([]string, len(format.CorrectIndices))
+	for i, index := range format.CorrectIndices {
+		indices[i] = strconv.Itoa(index)
+	}
+	cells[1] = strings.Join(indices, ";")
+	if format.Numeric != nil {
+		cells[2] = strconv.FormatFloat(format.Answer, 'f', -1, 64)
+		cells[3] = strconv.FormatFloat(format.Numeric.Min, 'f', -1, 64)
+		cells[4] = strconv.FormatFloat(format.Numeric.Max, 'f', -1, 64)
+		cells[5] = format.Numeric.Unit
+		cells[6] = strconv.FormatFloat(format.Numeric.Tolerance, 'f', -1, 64)
+	}
+	if format.Region != nil {
+		polygon, _ := json.Marshal(format.Region.Polygon)
+		cells[7] = string(polygon)
+	}
+	return cells
+}
+
+// parseCSVFormat reads the columns written by formatCSVColumns. The region is
+// the polygon as JSON, e.g. [[10,20],[40,20],[25,60]].
+func parseCSVFormat(field func(name string) string) (QuestionFormat, error) {
+	format := QuestionFormat{Type: strings.ToLower(field("type"))}
+
+	if indices := field("correct_indices"); indices != "" {
+		for _, value := range strings.Split(indices, ";") {
+			index, err := parseCorrectIndex(value)
+			if err != nil {
+				return format, errors.New("correct_indices must be numbers or option letters A-D separated by ;")
+			}
+			format.CorrectIndices = append(format.CorrectIndices, index)
+		}
+	}
+
+	if format.Type == QuestionNumeric {
+		format.Numeric = &NumericRange{Unit: field("unit")}
+		into := []*float64{&format.Answer, &format.Numeric.Min, &format.Numeric.Max, &format.Numeric.Tolerance}
+		for i, name := range []string{"answer", "min", "max", "tolerance"} {
+			value, err := strconv.ParseFloat(field(name), 64)
+			if err != nil {
+				return format, fmt.Errorf("%s must be a number", name)
+			}
+			*into[i] = value
+		}
+	}
+
+	if region := field("region"); region != "" {
+		format.Region = &Region{}
+		if err := json.Unmarshal([]byte(region), &format.Region.Polygon); err != nil {
+			return format, errors.New("region must be a JSON list of [x, y] points")
+		}
+	}
+	return format, nil
+}
+
+// parseCorrectIndex accepts a 0-based index or an option letter (A-D)
+func parseCorrectIndex(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 1 {
+		if letter := strings.ToUpper(value)[0]; letter >= 'A' && letter <= 'D' {
+			return int(letter - 'A'), nil
+		}
+	}
+	index, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("correct_index must be a number or an option letter A-D")
+	}
+	return index, nil
+}
+
+// ParseBankCSV reads questions from CSV. Every row is checked; the rows that
+// fail are all reported together.
+func ParseBankCSV(r io.Reader) ([]ImportRow, []ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, &ValidationError{Err: errors.New("CSV has no header row")}
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, &ValidationError{Err: fmt.Errorf("CSV is missing the %s column", name)}
+		}
+	}
+
+	rows := make([]ImportRow, 0)
+	rowErrors := make([]ImportRowError, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, ImportRowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, &ValidationError{Err: err}
+		}
+		// Quoted cells can span lines, so take the line from the reader
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		// Skip blank lines spreadsheets like to leave at the end
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		q := BankQuestion{
+			ID:           field("id"),
+			Question:     field("question"),
+			Difficulty:   strings.ToLower(field("difficulty")),
+			Explanation:  field("explanation"),
+			ReferenceURL: field("reference_url"),
+			ImageURL:     field("image_url"),
+			FrameRef:     field("frame_ref"),
+			Tags:         strings.Split(field("tags"), ";"),
+		}
+		for _, name := range []string{"option_a", "option_b", "option_c", "option_d"} {
+			if option := field(name); option != "" {
+				q.Options = append(q.Options, option)
+			}
+		}
+
+		q.QuestionFormat, err = parseCSVFormat(field)
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+		// Only single-choice questions need correct_index
+		if value := field("correct_index"); value != "" || q.Type == "" || q.Type == QuestionChoice {
+			q.CorrectIndex, err = parseCorrectIndex(value)
+			if err != nil {
+				rowErrors = append(rowErrors, ImportRowError{Row: line, Error: err.Error()})
+				continue
+			}
+		}
+		q.TimeLimit, err = strconv.Atoi(field("time_limit"))
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: line, Error: "time_limit must be a whole number of seconds"})
+			continue
+		}
+		if err := q.Validate(); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, ImportRow{Row: line, Question: q})
+	}
+
+	return rows, rowErrors, nil
+}
+
+// ParseBankJSON reads a bank exported by WriteBankJSON
+func ParseBankJSON(r io.Reader) (*BankExport, []ImportRow, []ImportRowError, error) {
+	var export BankExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, nil, &ValidationError{Err: fmt.Errorf("invalid JSON: %v", err)}
+	}
+
+	rows := make([]ImportRow, 0, len(export.Questions))
+	rowErrors := make([]ImportRowError, 0)
+	for i, exported := range export.Questions {
+		q := BankQuestion{
+			ID:           exported.ID,
+			Question:     exported.Question,
+			Options:      exported.Options,
+			CorrectIndex: exported.CorrectIndex,
+			TimeLimit:    exported.TimeLimit,
+			Tags:         exported.Tags,
+			Difficulty:   exported.Difficulty,
+			Explanation:  exported.Explanation,
+			ReferenceURL: exported.ReferenceURL,
+			ImageURL:     exported.ImageURL,
+			FrameRef:     exported.FrameRef,
+
+			QuestionFormat: exported.QuestionFormat,
+		}
+		if err := q.Validate(); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, ImportRow{Row: i + 1, Question: q})
+	}
+
+	return &export, rows, rowErrors, nil
+}
+
+// prepareImport checks imported rows against each other and, when appending,
+// against the bank's questions. Imported IDs are kept so playlists survive a
+// replace; clashes are reported against the row.
+func prepareImport(bank *QuestionBank, rows []ImportRow, rowErrors []ImportRowError, replace bool) ([]BankQuestion, error) {
+	created := make(map[string]time.Time, len(bank.Questions))
+	for _, q := range bank.Questions {
+		created[q.ID] = q.CreatedAt
+	}
+
+	seen := make(map[string]int)
+	now := time.Now()
+	questions := make([]BankQuestion, 0, len(rows))
+	for _, row := range rows {
+		q := row.Question
+		if q.ID != "" {
+			if _, clash := created[q.ID]; clash && !replace {
+				rowErrors = append(rowErrors, ImportRowError{Row: row.Row, Error: "id " + q.ID + " is already in this bank"})
+				continue
+			}
+			if first, dup := seen[q.ID]; dup {
+				rowErrors = append(rowErrors, ImportRowError{Row: row.Row, Error: fmt.Sprintf("id %s repeats row %d", q.ID, first)})
+				continue
+			}
+			seen[q.ID] = row.Row
+			// Questions that survive a replace keep their creation date
+			q.CreatedAt = created[q.ID]
+		}
+		if err := prepareQuestion(&q, now); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: row.Row, Error: err.Error()})
+			continue
+		}
+		questions = append(questions, q)
+	}
+
+	if len(rowErrors) > 0 {
+		sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+		return nil, &ImportError{Rows: rowErrors}
+	}
+	return questions, nil
+}
+
+// ImportQuestions writes parsed rows to a bank, all or nothing. With replace
+// the bank's questions become exactly the imported ones; otherwise they are
+// appended. It returns how many questions were written.
+func (s *QuestionBankStore) ImportQuestions(ctx context.Context, bank *QuestionBank, rows []ImportRow, rowErrors []ImportRowError, replace bool) (int, error) {
+	questions, err := prepareImport(bank, rows, rowErrors, replace)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	update := bson.M{"$push": bson.M{"questions": bson.M{"$each": questions}}, "$set": bson.M{"updated_at": now}}
+	if replace {
+		update = bson.M{"$set": bson.M{"questions": questions, "updated_at": now}}
+	}
+	if err := s.updateBank(ctx, bson.M{"_id": bank.ID}, update, ErrBankNotFound); err != nil {
+		return 0, err
+	}
+	return len(questions), nil
+}
+
+// CreateBankFromImport creates a bank holding the imported rows, all or nothing
+func (s *QuestionBankStore) CreateBankFromImport(ctx context.Context, bank *QuestionBank, rows []ImportRow, rowErrors []ImportRowError) error {
+	questions, err := prepareImport(&QuestionBank{}, rows, rowErrors, true)
+	if err != nil {
+		return err
+	}
+	bank.Questions = questions
+	return s.CreateBank(ctx, bank)
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Host commands for the open question, sent over /quiz-broadcaster
+const (
+	HostPauseQuestion  = "pause_question"
+	HostResumeQuestion = "resume_question"
+	HostExtendQuestion = "extend_question"
+	HostEndQuestion    = "end_question"
+)
+
+// timeLeft is how long the open question has before it closes. Callers hold
+// h.Mu.
+func (h *QuizHub) timeLeft() time.Duration {
+	return h.Engine.TimeLeft(time.Now())
+}
+
+// betsLocked reports whether the open question is inside its lock-in window,
+// when bets can no longer be placed, changed or cancelled. Callers hold h.Mu.
+func (h *QuizHub) betsLocked() bool {
+	return h.Engine.BetsLocked(time.Now())
+}
+
+// armTimer closes question once its deadline passes. Callers hold h.Mu.
+func (h *QuizHub) armTimer(question *Question) {
+	if h.GameState.Timer != nil {
+		h.GameState.Timer.Stop()
+	}
+	h.GameState.Timer = time.AfterFunc(time.Until(h.Engine.Deadline), func() {
+		h.processQuestionResults(question)
+	})
+}
+
+// clockMessage is the countdown for the open question. Callers hold h.Mu.
+func (h *QuizHub) clockMessage() map[string]interface{} {
+	msg := map[string]interface{}{
+		"type":         "tick",
+		"question_id":  h.GameState.CurrentQuestion.ID,
+		"remaining_ms": max(0, h.timeLeft().Milliseconds()),
+		"paused":       h.GameState.Paused,
+		"locked":       h.betsLocked(),
+	}
+	if !h.GameState.Paused {
+		msg["deadline"] = h.GameState.Deadline.UnixMilli()
+	}
+	return msg
+}
+
+// broadcastClock sends the countdown to players and the host right away
+func (h *QuizHub) broadcastClock() {
+	h.Mu.RLock()
+	if !h.GameState.QuestionActive {
+		h.Mu.RUnlock()
+		return
+	}
+	msg := h.clockMessage()
+	h.Mu.RUnlock()
+
+	h.broadcastToPlayers(msg)
+	h.notifyBroadcaster(msg)
+}
+
+// runQuestionClock sends a tick every TickInterval until question closes, so
+// clients count down from the server's deadline rather than their own clock
+func (h *QuizHub) runQuestionClock(question *Question) {
+	if h.Config.TickInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.Config.TickInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.Mu.RLock()
+		live := h.GameState.QuestionActive && h.GameState.CurrentQuestion == question
+		var msg map[string]interface{}
+		if live {
+			msg = h.clockMessage()
+		}
+		h.Mu.RUnlock()
+
+		if !live {
+			return
+		}
+		h.broadcastToPlayers(msg)
+		h.notifyBroadcaster(msg)
+	}
+}
+
+// handleClockCommand pauses, resumes, extends or ends the open question
+func (h *QuizHub) handleClockCommand(cmd HostCommand) {
+	h.Mu.Lock()
+	question := h.GameState.CurrentQuestion
+
+	var err error
+	switch cmd.Type {
+	case HostPauseQuestion:
+		if err = h.Engine.Pause(time.Now()); err == nil {
+			h.GameState.Timer.Stop()
+		}
+
+	case HostResumeQuestion:
+		if err = h.Engine.Resume(time.Now()); err == nil {
+			h.armTimer(question)
+		}
+
+	case HostExtendQuestion:
+		if err = h.Engine.Extend(time.Duration(cmd.Seconds) * time.Second); err == nil && !h.GameState.Paused {
+			h.armTimer(question)
+		}
+
+	case HostEndQuestion:
+		if err = h.Engine.EndQuestion(time.Now()); err == nil {
+			h.GameState.Timer.Stop()
+		}
+
+	default:
+		err = errors.New("unknown command " + cmd.Type)
+	}
+	h.syncGame()
+	h.Mu.Unlock()
+
+	if err != nil {
+		h.notifyBroadcaster(map[string]interface{}{
+			"type":    "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Quiz %s: host %s sent %s for question %s\n", h.CurrentGameID(), cmd.HostID, cmd.Type, question.ID)
+	if cmd.Type == HostEndQuestion {
+		// Off the hub loop: results may wait to queue the next question
+		go h.processQuestionResults(question)
+		return
+	}
+	h.broadcastClock()
+}
@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"github.com/dilyxs/medMarket/config"
+	"github.com/dilyxs/medMarket/quizengine"
+)
+
+// NewQuizEngine creates the engine for a game using the configured buy-in,
+// bet lock-in and review
+func NewQuizEngine(cfg config.QuizConfig) *quizengine.Engine {
+	return quizengine.New(ToUnits(cfg.StartingTokens), cfg.BetLockIn, cfg.ReviewDuration > 0)
+}
+
+// syncGame copies the engine's state into GameState, which snapshots,
+// listings and the sockets read. Callers hold h.Mu.
+func (h *QuizHub) syncGame() {
+	e, game := h.Engine, h.GameState
+	game.State = e.State
+	switch e.State {
+	case quizengine.StateLobby:
+		game.Phase = QuizPhaseLobby
+	case quizengine.StateEnded:
+		game.Phase = QuizPhaseEnded
+	default:
+		game.Phase = QuizPhaseRunning
+	}
+	game.GameActive = e.State != quizengine.StateEnded
+	game.QuestionActive = e.State == quizengine.StateQuestionOpen
+	game.StartedAt = e.StartedAt
+	game.EndedAt = e.EndedAt
+	game.QuestionsPlayed = e.QuestionsPlayed
+	game.QuestionStartTime = e.Opened
+	game.Deadline = e.Deadline
+	game.Paused = e.Paused
+	game.PausedRemaining = e.PausedRemaining
+	game.Jackpot = e.Jackpot.Tokens()
+}
+
+// syncPlayer copies player's standing from the engine onto their connection.
+// Callers hold h.Mu.
+func (h *QuizHub) syncPlayer(player *QuizPlayer) {
+	if standing, ok := h.Engine.Players[player.UserID]; ok {
+		player.setStanding(*standing)
+	}
+}
+
+// syncPlayers copies every player's standing from the engine. Callers hold
+// h.Mu.
+func (h *QuizHub) syncPlayers() {
+	for _, player := range h.Players {
+		h.syncPlayer(player)
+	}
+}
+
+// setStanding copies an engine player's balance and status for the snapshot,
+// records and settlement, which read them under player.Mu
+func (p *QuizPlayer) setStanding(standing quizengine.Player) {
+	var bets []float64
+	if standing.Stakes != nil {
+		bets = make([]float64, len(standing.Stakes))
+		for i, stake := range standing.Stakes {
+			bets[i] = stake.Tokens()
+		}
+	}
+
+	p.Mu.Lock()
+	defer p.Mu.Unlock()
+	p.Tokens = standing.Tokens.Tokens()
+	p.IsActive = standing.Active
+	p.CurrentBets = bets
+	p.Points = standing.Points
+	p.Lives = standing.Lives
+	p.JoinedAt = standing.JoinedAt
+}
+
+// engineBet is bet as the engine takes it, with each stake in whole
+// TokenUnits so pools split exactly
+func engineBet(bet *BetSubmission) quizengine.Bet {
+	stakes := make([]TokenUnits, len(bet.Bets))
+	for i, amount := range bet.Bets {
+		stakes[i] = ToUnits(amount)
+	}
+	return quizengine.Bet{
+		PlayerID:   bet.PlayerID,
+		QuestionID: bet.QuestionID,
+		Stakes:     stakes,
+		Placed:     bet.Timestamp,
+	}
+}
+
+// nextQueued takes the next question off the queue. Callers hold h.Mu.
+func (h *QuizHub) nextQueued() *Question {
+	if len(h.GameState.QuestionQueue) == 0 {
+		return nil
+	}
+	next := h.GameState.QuestionQueue[0]
+	h.GameState.QuestionQueue = h.GameState.QuestionQueue[1:]
+	return next
+}
+
+// grades grades each bet on question against its type for the engine.
+// Callers hold h.Mu.
+func (h *QuizHub) grades(question *Question) map[string]quizengine.Grade {
+	grades := make(map[string]quizengine.Grade, len(h.Bets))
+	for playerID, bet := range h.Bets {
+		correct, wrong := question.Grade(bet)
+		grades[playerID] = quizengine.Grade{Correct: correct, Wrong: wrong}
+	}
+	return grades
+}
+
+// quizResults builds the results message for question from the engine's
+// settlement, adding each player's bet and the answer key. Callers hold h.Mu.
+func (h *QuizHub) quizResults(question *Question, settlement quizengine.Settlement) QuizResults {
+	results := QuizResults{
+		Type:              "results",
+		QuestionID:        question.ID,
+		CorrectIndex:      question.CorrectIndex,
+		EliminatedPlayers: settlement.Eliminated,
+		RemainingPlayers:  settlement.Remaining,
+		Jackpot:           settlement.Jackpot.Tokens(),
+		Rake:              settlement.Rake.Tokens(),
+		Odds:              settlement.Odds,
+		PlayerResults:     make(map[string]PlayerResult, len(settlement.Results)),
+	}
+	question.revealAnswer(&results)
+
+	for playerID, outcome := range settlement.Results {
+		result := PlayerResult{
+			Won:            outcome.Won,
+			TokensReturned: outcome.Returned.Tokens(),
+			TokensLost:     outcome.Lost.Tokens(),
+			NewBalance:     outcome.Balance.Tokens(),
+			PointsEarned:   outcome.PointsEarned,
+			Points:         outcome.Points,
+			Lives:          outcome.Lives,
+			Odds:           outcome.Odds,
+			Winnings:       outcome.Winnings.Tokens(),
+		}
+		if bet := h.Bets[playerID]; bet != nil {
+			result.Bets = bet.Bets
+			result.Value, result.Point = bet.Value, bet.Point
+			result.Credit = question.Credit(bet)
+			correct, _ := question.Grade(bet)
+			result.CorrectStake = correct.Tokens()
+		}
+		results.PlayerResults[playerID] = result
+	}
+	return results
+}
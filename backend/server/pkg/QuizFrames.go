@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNoFrame is returned when a question asks for the broadcast frame but
+// nothing is being broadcast
+var ErrNoFrame = errors.New("no broadcast frame to attach")
+
+// FrameSource supplies the latest frame of the live video broadcast
+type FrameSource interface {
+	CurrentFrame() (VideoFrameWithAnnotations, bool)
+}
+
+// CurrentFrame returns the last frame the broadcaster sent, with its
+// segmentation metadata
+func (b *BroadcastServerHub) CurrentFrame() (VideoFrameWithAnnotations, bool) {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	if b.LatestFrame == nil {
+		return VideoFrameWithAnnotations{}, false
+	}
+	return *b.LatestFrame, true
+}
+
+// QuestionFrame is a broadcast frame attached to a quiz question, kept in
+// quiz_frames so the question can be reviewed later
+type QuestionFrame struct {
+	GameID     string   `bson:"game_id" json:"game_id,omitempty"`
+	QuestionID string   `bson:"question_id" json:"question_id,omitempty"`
+	Image      []byte   `bson:"image" json:"image"`             // JPEG as broadcast, base64 in JSON
+	CapturedAt int64    `bson:"captured_at" json:"captured_at"` // Unix timestamp in ms
+	FrameIndex int      `bson:"frame_index" json:"frame_index"`
+	Regions    []Region `bson:"regions,omitempty" json:"regions,omitempty"` // segmentation regions, when the host attached them
+}
+
+// forPlayers is the frame as players see it. A hotspot's regions would give
+// the answer away, so they are left out until the results.
+func (f *QuestionFrame) forPlayers(q *Question) *QuestionFrame {
+	frame := *f
+	frame.GameID, frame.QuestionID = "", ""
+	if q.Kind() == QuestionHotspot {
+		frame.Regions = nil
+	}
+	return &frame
+}
+
+// attachFrame copies the broadcast's current frame onto question. With
+// withRegions its segmentation regions go along too, and a regionIndex of 0
+// or more makes that region the hotspot's target.
+func (h *QuizHub) attachFrame(question *Question, withRegions bool, regionIndex int) error {
+	if h.Frames == nil {
+		return ErrNoFrame
+	}
+	current, ok := h.Frames.CurrentFrame()
+	if !ok {
+		return ErrNoFrame
+	}
+
+	question.Frame = &QuestionFrame{
+		Image:      current.Frame,
+		CapturedAt: current.Timestamp,
+		FrameIndex: current.Metadata.FrameIndex,
+	}
+	if withRegions {
+		question.Frame.Regions = current.Metadata.Regions
+	}
+	if regionIndex >= 0 {
+		if regionIndex >= len(current.Metadata.Regions) {
+			return invalid(fmt.Errorf("the frame has %d regions", len(current.Metadata.Regions)))
+		}
+		region := current.Metadata.Regions[regionIndex]
+		question.Region = &region
+	}
+	return nil
+}
+
+// RecordFrame stores the frame a question was asked about
+func (s *QuizGameStore) RecordFrame(gameID string, question *Question) {
+	frame := *question.Frame
+	frame.GameID, frame.QuestionID = gameID, question.ID
+	s.enqueue(func(ctx context.Context) error {
+		_, err := s.Frames.ReplaceOne(ctx,
+			bson.M{"game_id": gameID, "question_id": question.ID},
+			frame,
+			options.Replace().SetUpsert(true),
+		)
+		return err
+	})
+}
+
+// Frame fetches the frame attached to one question of a game
+func (s *QuizGameStore) Frame(ctx context.Context, gameID, questionID string) (*QuestionFrame, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var frame QuestionFrame
+	if err := s.Frames.FindOne(ctx, bson.M{"game_id": gameID, "question_id": questionID}).Decode(&frame); err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
@@ -0,0 +1,373 @@
+package pkg
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Statuses stored on a quiz_games record. A game interrupted by a server
+// shutdown is "aborted" and its players are refunded their open bets.
+const (
+	QuizRecordAborted = "aborted"
+)
+
+// QuizGameRecord is one document in quiz_games: the full transcript of a game
+type QuizGameRecord struct {
+	GameID    string               `bson:"_id" json:"game_id"`
+	HostID    string               `bson:"host_id" json:"host_id"`
+	Status    string               `bson:"status" json:"status"`
+	Rules     QuizRules            `bson:"rules" json:"rules"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+	StartedAt time.Time            `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	EndedAt   time.Time            `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	PlayerIDs []string             `bson:"player_ids" json:"-"`
+	Players   []QuizGamePlayer     `bson:"players" json:"players"`
+	Questions []QuizQuestionRecord `bson:"questions" json:"questions,omitempty"`
+	WinnerID  string               `bson:"winner_id,omitempty" json:"winner_id,omitempty"`
+	Jackpot   float64              `bson:"jackpot" json:"jackpot"` // left unclaimed when the house wins
+
+	Adjustments []QuizAdjustment `bson:"adjustments,omitempty" json:"adjustments,omitempty"`
+}
+
+// QuizAdjustment is an audited change the host made to a player's balance
+type QuizAdjustment struct {
+	PlayerID   string    `bson:"player_id" json:"player_id"`
+	HostID     string    `bson:"host_id" json:"host_id"`
+	Amount     float64   `bson:"amount" json:"amount"`
+	Reason     string    `bson:"reason" json:"reason"`
+	NewBalance float64   `bson:"new_balance" json:"new_balance"`
+	At         time.Time `bson:"at" json:"at"`
+}
+
+// QuizGamePlayer is a player's stake and outcome in a game
+type QuizGamePlayer struct {
+	UserID     string    `bson:"user_id" json:"user_id"`
+	Username   string    `bson:"username" json:"username"`
+	BuyIn      float64   `bson:"buy_in" json:"buy_in"`
+	Payout     float64   `bson:"payout" json:"payout"`
+	Eliminated bool      `bson:"eliminated" json:"eliminated"`
+	Removed    string    `bson:"removed,omitempty" json:"removed,omitempty"` // "kicked" or "banned" by the host
+	JoinedAt   time.Time `bson:"joined_at" json:"joined_at"`
+	IP         string    `bson:"ip,omitempty" json:"-"`        // for the integrity screen, never shown to other players
+	DeviceID   string    `bson:"device_id,omitempty" json:"-"` // set by the client
+}
+
+// QuizQuestionRecord is a question as asked, including the correct answer,
+// every accepted bet and the results
+type QuizQuestionRecord struct {
+	QuestionID   string          `bson:"question_id" json:"question_id"`
+	Question     string          `bson:"question" json:"question"`
+	Options      []string        `bson:"options" json:"options"`
+	CorrectIndex int             `bson:"correct_index" json:"correct_index"`
+	ImageURL     string          `bson:"image_url,omitempty" json:"image_url,omitempty"`
+	Explanation  string          `bson:"explanation,omitempty" json:"explanation,omitempty"`
+	ReferenceURL string          `bson:"reference_url,omitempty" json:"reference_url,omitempty"`
+	TimeLimit    int             `bson:"time_limit" json:"time_limit"`
+	StartedAt    time.Time       `bson:"started_at" json:"started_at"`
+	ClosedAt     time.Time       `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	Bets         []BetSubmission `bson:"bets" json:"bets"` // every submission in order; a player's last one counts
+	Results      *QuizResults    `bson:"results,omitempty" json:"results,omitempty"`
+	VoidReason   string          `bson:"void_reason,omitempty" json:"void_reason,omitempty"` // set when the host voided it and refunded every bet
+	HasFrame     bool            `bson:"has_frame,omitempty" json:"has_frame,omitempty"`     // a broadcast frame is stored in quiz_frames
+
+	QuestionFormat `bson:",inline"`
+}
+
+// QuizGameStore records games in the quiz_games collection. Writes go through
+// one goroutine so they land in the order the hub made them without blocking
+// the hub loop on MongoDB. The queue holds Backlog writes; once it is full,
+// new writes wait for room rather than being dropped, since payouts wait on
+// them.
+type QuizGameStore struct {
+	Games   *mongo.Collection
+	Frames  *mongo.Collection // frames attached to questions, kept apart as they are large
+	Timeout time.Duration
+	Backlog int // pending writes the queue holds before writers wait
+
+	mu      sync.Mutex
+	changed *sync.Cond // a write was queued or made, or the store closed
+	pending []func(ctx context.Context) error
+	done    chan struct{}
+	closed  bool
+	stalled int       // writes that waited for room since the last warning
+	warned  time.Time // when the backlog warning was last logged
+}
+
+// backlogWarnInterval limits how often a full queue is logged
+const backlogWarnInterval = time.Minute
+
+// NewQuizGameStore creates the store and starts its writer
+func NewQuizGameStore(games, frames *mongo.Collection, timeout time.Duration, backlog int) *QuizGameStore {
+	s := &QuizGameStore{
+		Games:   games,
+		Frames:  frames,
+		Timeout: timeout,
+		Backlog: backlog,
+		done:    make(chan struct{}),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// run makes the queued writes in order. A write stays queued until it is
+// made, so it counts against the Backlog while it runs.
+func (s *QuizGameStore) run() {
+	defer close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for len(s.pending) == 0 && !s.closed {
+			s.changed.Wait()
+		}
+		if len(s.pending) == 0 {
+			return
+		}
+		write := s.pending[0]
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+		if err := write(ctx); err != nil {
+			log.Printf("Quiz history write failed: %v\n", err)
+		}
+		cancel()
+
+		s.mu.Lock()
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.changed.Broadcast()
+	}
+}
+
+// enqueue queues a write, waiting for room while Backlog writes are pending,
+// and reports false if the store has been closed
+func (s *QuizGameStore) enqueue(write func(ctx context.Context) error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= s.Backlog && !s.closed {
+		s.stalled++
+		s.warnBacklog()
+		for len(s.pending) >= s.Backlog && !s.closed {
+			s.changed.Wait()
+		}
+	}
+	if s.closed {
+		return false
+	}
+	s.pending = append(s.pending, write)
+	s.changed.Broadcast()
+	return true
+}
+
+// warnBacklog logs that the queue is full, at most once per
+// backlogWarnInterval. Callers hold s.mu.
+func (s *QuizGameStore) warnBacklog() {
+	if time.Since(s.warned) < backlogWarnInterval {
+		return
+	}
+	log.Printf("Quiz history is falling behind: %d writes pending, %d waited for room\n", len(s.pending), s.stalled)
+	s.warned = time.Now()
+	s.stalled = 0
+}
+
+// Close flushes pending writes and stops the writer
+func (s *QuizGameStore) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.changed.Broadcast()
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *QuizGameStore) update(gameID string, update bson.M, opts ...*options.UpdateOptions) {
+	s.enqueue(func(ctx context.Context) error {
+		_, err := s.Games.UpdateOne(ctx, bson.M{"_id": gameID}, update, opts...)
+		return err
+	})
+}
+
+// RecordGame creates the record for a newly opened lobby
+func (s *QuizGameStore) RecordGame(info QuizGameInfo) {
+	record := QuizGameRecord{
+		GameID:    info.GameID,
+		HostID:    info.HostID,
+		Status:    info.Phase,
+		Rules:     info.Rules,
+		CreatedAt: info.CreatedAt,
+		PlayerIDs: []string{},
+		Players:   []QuizGamePlayer{},
+		Questions: []QuizQuestionRecord{},
+	}
+	s.enqueue(func(ctx context.Context) error {
+		_, err := s.Games.InsertOne(ctx, record)
+		return err
+	})
+}
+
+// RecordStart marks the game as running
+func (s *QuizGameStore) RecordStart(gameID string, startedAt time.Time) {
+	s.update(gameID, bson.M{"$set": bson.M{"status": QuizPhaseRunning, "started_at": startedAt}})
+}
+
+// RecordPlayer adds a player who bought into the game
+func (s *QuizGameStore) RecordPlayer(gameID string, player QuizGamePlayer) {
+	s.update(gameID, bson.M{
+		"$addToSet": bson.M{"player_ids": player.UserID},
+		"$push":     bson.M{"players": player},
+	})
+}
+
+// RecordQuestion appends a question when it goes live
+func (s *QuizGameStore) RecordQuestion(gameID string, question *Question, startedAt time.Time) {
+	s.update(gameID, bson.M{"$push": bson.M{"questions": QuizQuestionRecord{
+		QuestionID:     question.ID,
+		Question:       question.Question,
+		Options:        question.Options,
+		CorrectIndex:   question.CorrectIndex,
+		ImageURL:       question.ImageURL,
+		Explanation:    question.Explanation,
+		ReferenceURL:   question.ReferenceURL,
+		TimeLimit:      question.TimeLimit,
+		StartedAt:      startedAt,
+		Bets:           []BetSubmission{},
+		HasFrame:       question.Frame != nil,
+		QuestionFormat: question.Format(),
+	}}})
+	if question.Frame != nil {
+		s.RecordFrame(gameID, question)
+	}
+}
+
+// RecordBet appends an accepted bet to its question
+func (s *QuizGameStore) RecordBet(gameID, questionID string, bet BetSubmission) {
+	s.update(gameID,
+		bson.M{"$push": bson.M{"questions.$[q].bets": bet}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"q.question_id": questionID}},
+		}),
+	)
+}
+
+// RecordResults stores the outcome of a question
+func (s *QuizGameStore) RecordResults(gameID string, results QuizResults, closedAt time.Time) {
+	s.update(gameID,
+		bson.M{"$set": bson.M{
+			"questions.$[q].results":   results,
+			"questions.$[q].closed_at": closedAt,
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"q.question_id": results.QuestionID}},
+		}),
+	)
+}
+
+// RecordVoid marks a question the host voided; its bets were refunded
+func (s *QuizGameStore) RecordVoid(gameID, questionID, reason string, closedAt time.Time) {
+	s.update(gameID,
+		bson.M{"$set": bson.M{
+			"questions.$[q].void_reason": reason,
+			"questions.$[q].closed_at":   closedAt,
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"q.question_id": questionID}},
+		}),
+	)
+}
+
+// RecordAdjustment appends a host balance adjustment to the game's audit trail
+func (s *QuizGameStore) RecordAdjustment(gameID string, adjustment QuizAdjustment) {
+	s.update(gameID, bson.M{"$push": bson.M{"adjustments": adjustment}})
+}
+
+// RecordEnd stores the final payouts once a game ends or is aborted
+func (s *QuizGameStore) RecordEnd(gameID, status string, endedAt time.Time, winnerID string, jackpot float64, players []QuizGamePlayer) {
+	s.update(gameID, bson.M{"$set": bson.M{
+		"status":    status,
+		"ended_at":  endedAt,
+		"winner_id": winnerID,
+		"jackpot":   jackpot,
+		"players":   players,
+	}})
+}
+
+// GamesForUser lists the games userID played, newest first, without the
+// per-question transcript
+func (s *QuizGameStore) GamesForUser(ctx context.Context, userID string, limit int64) ([]QuizGameRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	cursor, err := s.Games.Find(ctx, bson.M{"player_ids": userID}, options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(limit).
+		SetProjection(bson.M{"questions": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	games := make([]QuizGameRecord, 0)
+	if err := cursor.All(ctx, &games); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// Game fetches a full game transcript
+func (s *QuizGameStore) Game(ctx context.Context, gameID string) (*QuizGameRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var record QuizGameRecord
+	if err := s.Games.FindOne(ctx, bson.M{"_id": gameID}).Decode(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// HasPlayer reports whether userID took part in the game
+func (r *QuizGameRecord) HasPlayer(userID string) bool {
+	for _, id := range r.PlayerIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Finished reports whether the game is over. Until then the record holds the
+// open question's answer and everyone's live bets.
+func (r *QuizGameRecord) Finished() bool {
+	return r.Status == QuizPhaseEnded || r.Status == QuizRecordAborted
+}
+
+// playerRecords builds the final player list from the hub's players
+func (h *QuizHub) playerRecords() []QuizGamePlayer {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	players := make([]QuizGamePlayer, 0, len(h.Players))
+	for _, player := range h.Players {
+		player.Mu.RLock()
+		players = append(players, QuizGamePlayer{
+			UserID:     player.UserID,
+			Username:   player.Username,
+			BuyIn:      h.Config.StartingTokens,
+			Payout:     player.Tokens,
+			Eliminated: !player.IsActive,
+			JoinedAt:   player.JoinedAt,
+			IP:         player.IP,
+			DeviceID:   player.DeviceID,
+		})
+		player.Mu.RUnlock()
+	}
+	return append(players, h.Departed...)
+}
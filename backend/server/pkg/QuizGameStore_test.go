@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStoreBacklog checks a full write queue makes writers wait for room
+// instead of growing or dropping writes, and that every write is made in order
+func TestStoreBacklog(t *testing.T) {
+	s := NewQuizGameStore(nil, nil, time.Second, 2)
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var made []int
+	write := func(i int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			if i == 0 {
+				<-release
+			}
+			mu.Lock()
+			made = append(made, i)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	s.enqueue(write(0))
+	s.enqueue(write(1))
+
+	queued := make(chan bool)
+	go func() { queued <- s.enqueue(write(2)) }()
+	select {
+	case <-queued:
+		t.Fatal("a write was queued past the backlog")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if ok := <-queued; !ok {
+		t.Fatal("the waiting write was dropped")
+	}
+	s.Close()
+
+	if len(made) != 3 || made[0] != 0 || made[1] != 1 || made[2] != 2 {
+		t.Errorf("writes made %v, want [0 1 2]", made)
+	}
+	if s.enqueue(write(3)) {
+		t.Error("a write was queued after Close")
+	}
+}
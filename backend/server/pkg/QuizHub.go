@@ -1,87 +1,188 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dilyxs/medMarket/config"
+	"github.com/dilyxs/medMarket/quizengine"
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Question represents a quiz question
 type Question struct {
-	ID           string   `json:"id"`
-	Question     string   `json:"question"`
-	Options      []string `json:"options"`      // 2-4 options
-	CorrectIndex int      `json:"-"`            // Don't send to clients
-	TimeLimit    int      `json:"time_limit"`   // seconds
-	CreatedAt    time.Time `json:"created_at"`
+	ID             string         `json:"id"`
+	Type           string         `json:"type,omitempty"` // choice (default), multi_select, numeric or hotspot
+	Question       string         `json:"question"`
+	Options        []string       `json:"options"`             // 2-4 options; none for numeric and hotspot
+	CorrectIndex   int            `json:"-"`                   // Don't send to clients
+	CorrectIndices []int          `json:"-"`                   // multi_select
+	Numeric        *NumericRange  `json:"numeric,omitempty"`   // numeric: bounds and tolerance, shown to players
+	Answer         float64        `json:"-"`                   // numeric
+	ImageURL       string         `json:"image_url,omitempty"` // hotspot: the image players click on
+	Region         *Region        `json:"-"`                   // hotspot: the target, e.g. a segmentation mask
+	Frame          *QuestionFrame `json:"-"`                   // broadcast frame the question is about
+	Explanation    string         `json:"explanation,omitempty"`
+	ReferenceURL   string         `json:"reference_url,omitempty"` // further reading, shown with the explanation
+	TimeLimit      int            `json:"time_limit"`              // seconds
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// Validate checks the rules every question must meet, whether submitted live
+// or loaded from a bank
+func (q *Question) Validate() error {
+	if strings.TrimSpace(q.Question) == "" {
+		return errors.New("question text is required")
+	}
+	if err := q.validateFormat(); err != nil {
+		return err
+	}
+	if q.TimeLimit <= 0 {
+		return errors.New("time_limit must be positive")
+	}
+	if q.ReferenceURL != "" {
+		if link, err := url.Parse(q.ReferenceURL); err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+			return errors.New("reference_url must be an http or https link")
+		}
+	}
+	return nil
 }
 
 // QuestionForClient is sent to players (without correct answer)
 type QuestionForClient struct {
-	ID        string   `json:"id"`
-	Question  string   `json:"question"`
-	Options   []string `json:"options"`
-	TimeLimit int      `json:"time_limit"`
-	StartTime int64    `json:"start_time"` // Unix timestamp in ms
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	Question  string         `json:"question"`
+	Options   []string       `json:"options"`
+	Numeric   *NumericRange  `json:"numeric,omitempty"`
+	ImageURL  string         `json:"image_url,omitempty"`
+	Frame     *QuestionFrame `json:"frame,omitempty"`
+	TimeLimit int            `json:"time_limit"`
+	StartTime int64          `json:"start_time"` // Unix timestamp in ms
+	Deadline  int64          `json:"deadline"`   // Unix timestamp in ms; tick messages carry changes
 }
 
 // BetSubmission represents a player's bet on a question
 type BetSubmission struct {
-	PlayerID   string    `json:"player_id"`
-	QuestionID string    `json:"question_id"`
-	Bets       []float64 `json:"bets"` // Array of bets for each option
-	Timestamp  time.Time `json:"timestamp"`
+	PlayerID   string    `json:"player_id" bson:"player_id"`
+	QuestionID string    `json:"question_id" bson:"question_id"`
+	Bets       []float64 `json:"bets" bson:"bets"`                       // Array of bets for each option, or the one stake on a numeric or hotspot answer
+	Value      *float64  `json:"value,omitempty" bson:"value,omitempty"` // numeric estimate
+	Point      *Point    `json:"point,omitempty" bson:"point,omitempty"` // hotspot click
+	Timestamp  time.Time `json:"timestamp" bson:"timestamp"`             // server receive time
+	Cancelled  bool      `json:"cancelled,omitempty" bson:"cancelled,omitempty"`
+}
+
+// Total is the whole stake across every option
+func (b *BetSubmission) Total() TokenUnits {
+	total := TokenUnits(0)
+	for _, amount := range b.Bets {
+		total += ToUnits(amount)
+	}
+	return total
 }
 
 // QuizPlayer represents a player in the quiz
 type QuizPlayer struct {
-	UserID       string
-	Username     string
-	Email        string
-	Conn         *websocket.Conn
-	Send         chan interface{}
-	Tokens       float64
-	IsActive     bool // false if eliminated
-	CurrentBets  []float64
-	Mu           sync.RWMutex
+	UserID      string
+	Username    string
+	Email       string
+	Conn        *websocket.Conn
+	Send        chan interface{}
+	Tokens      float64 // copied from the engine by syncPlayer, like the fields below
+	IsActive    bool    // false if eliminated
+	CurrentBets []float64
+	LedgerEntry primitive.ObjectID // buy-in recorded in quiz_ledger
+	Connected   bool               // guarded by the hub's Mu; Send is closed once false
+	JoinedAt    time.Time
+	Points      float64 // points mode score
+	Lives       int     // lives mode strikes left
+	IP          string  // address of the latest connection
+	DeviceID    string  // the client's ?device= identifier
+	Mu          sync.RWMutex
 }
 
 // QuizBroadcaster represents the broadcaster/host
 type QuizBroadcaster struct {
-	Conn *websocket.Conn
-	Send chan interface{}
+	UserID   string
+	Takeover bool // set when an admin explicitly replaces the current host
+	Admin    bool // the host has the admin role, which may credit tokens
+	Conn     *websocket.Conn
+	Send     chan interface{}
 }
 
 // QuizResults sent after each question
 type QuizResults struct {
-	Type              string                 `json:"type"` // "results"
-	QuestionID        string                 `json:"question_id"`
-	CorrectIndex      int                    `json:"correct_index"`
-	EliminatedPlayers []string               `json:"eliminated_players"`
-	RemainingPlayers  int                    `json:"remaining_players"`
-	Jackpot           float64                `json:"jackpot"`
-	PlayerResults     map[string]PlayerResult `json:"player_results"`
+	Type              string                  `json:"type" bson:"-"` // "results"
+	QuestionID        string                  `json:"question_id" bson:"question_id"`
+	CorrectIndex      int                     `json:"correct_index" bson:"correct_index"`
+	CorrectIndices    []int                   `json:"correct_indices,omitempty" bson:"correct_indices,omitempty"` // multi_select
+	Answer            *float64                `json:"answer,omitempty" bson:"answer,omitempty"`                   // numeric
+	Region            *Region                 `json:"region,omitempty" bson:"region,omitempty"`                   // hotspot
+	EliminatedPlayers []string                `json:"eliminated_players" bson:"eliminated_players"`
+	RemainingPlayers  int                     `json:"remaining_players" bson:"remaining_players"`
+	Jackpot           float64                 `json:"jackpot" bson:"jackpot"`
+	Rake              float64                 `json:"rake,omitempty" bson:"rake,omitempty"` // parimutuel: kept by the house
+	Odds              float64                 `json:"odds,omitempty" bson:"odds,omitempty"` // parimutuel: payout per token on the correct option
+	PlayerResults     map[string]PlayerResult `json:"player_results" bson:"player_results"`
 }
 
 type PlayerResult struct {
-	Bets          []float64 `json:"bets"`
-	Won           bool      `json:"won"`
-	TokensReturned float64  `json:"tokens_returned"`
-	TokensLost    float64   `json:"tokens_lost"`
-	NewBalance    float64   `json:"new_balance"`
+	Bets           []float64 `json:"bets" bson:"bets"`
+	Won            bool      `json:"won" bson:"won"`
+	TokensReturned float64   `json:"tokens_returned" bson:"tokens_returned"`
+	TokensLost     float64   `json:"tokens_lost" bson:"tokens_lost"`
+	NewBalance     float64   `json:"new_balance" bson:"new_balance"`
+	PointsEarned   float64   `json:"points_earned,omitempty" bson:"points_earned,omitempty"`
+	Points         float64   `json:"points,omitempty" bson:"points,omitempty"`
+	Lives          int       `json:"lives,omitempty" bson:"lives,omitempty"`
+	Odds           float64   `json:"odds,omitempty" bson:"odds,omitempty"`         // parimutuel: tokens paid per token on the correct option
+	Winnings       float64   `json:"winnings,omitempty" bson:"winnings,omitempty"` // parimutuel: share of the wrong pool
+	Value          *float64  `json:"value,omitempty" bson:"value,omitempty"`       // numeric estimate
+	Point          *Point    `json:"point,omitempty" bson:"point,omitempty"`       // hotspot click
+	Credit         float64   `json:"credit,omitempty" bson:"credit,omitempty"`     // numeric and hotspot: share of the stake that counted as correct
+	CorrectStake   float64   `json:"correct_stake,omitempty" bson:"correct_stake,omitempty"`
 }
 
-// QuizGameState tracks the current game state
+// Quiz game phases. A game opens as a lobby, runs once the host starts it and
+// ends when its scoring mode says so or max_questions have been played.
+const (
+	QuizPhaseLobby   = "lobby"
+	QuizPhaseRunning = "running"
+	QuizPhaseEnded   = "ended"
+)
+
+// QuizGameState tracks the current game state. The engine's part of it, from
+// Phase to the jackpot, is copied in by syncGame after every engine call.
 type QuizGameState struct {
+	GameID            string
+	HostID            string
+	Phase             string
+	State             string // the engine's state, finer than Phase
+	CreatedAt         time.Time
+	StartedAt         time.Time
+	EndedAt           time.Time
+	Rules             QuizRules
+	QuestionsPlayed   int
 	CurrentQuestion   *Question
 	QuestionStartTime time.Time
+	Deadline          time.Time     // when the open question closes; extended by the host
+	Paused            bool          // the host has stopped the clock
+	PausedRemaining   time.Duration // time left when the clock was paused
 	QuestionQueue     []*Question
+	QuestionGap       time.Duration   // pause before a queued question, Config.NextQuestionDelay if zero
+	Review            *QuestionReview // explanation and distribution being shown after a question, nil otherwise
+	ReviewTimer       *time.Timer
 	Jackpot           float64
 	GameActive        bool
 	QuestionActive    bool
@@ -90,74 +191,248 @@ type QuizGameState struct {
 
 // QuizHub manages the quiz game
 type QuizHub struct {
-	Players          map[string]*QuizPlayer // userID -> player
-	Broadcaster      *QuizBroadcaster
-	GameState        *QuizGameState
-	Bets             map[string]*BetSubmission // playerID -> bet for current question
-	Register         chan *QuizPlayer
-	Unregister       chan *QuizPlayer
+	Players               map[string]*QuizPlayer    // userID -> player's connection; their standing is in Engine
+	Bets                  map[string]*BetSubmission // playerID -> bet on the open question as sent; Engine holds the stakes
+	Departed              []QuizGamePlayer          // players the host removed, already paid out
+	Banned                map[string]string         // userID -> reason; they can't rejoin this game
+	Spectators            map[string]*QuizSpectator // userID -> watching without a buy-in
+	Broadcaster           *QuizBroadcaster
+	GameState             *QuizGameState
+	Engine                *quizengine.Engine // the game's rules; called with Mu held
+	Register              chan *QuizPlayer
+	Unregister            chan *QuizPlayer
 	RegisterBroadcaster   chan *QuizBroadcaster
 	UnregisterBroadcaster chan *QuizBroadcaster
-	SubmitQuestion   chan *Question
-	SubmitBet        chan *BetSubmission
-	Mu               sync.RWMutex
-	UsersCollection  *mongo.Collection
+	RegisterSpectator     chan *QuizSpectator
+	UnregisterSpectator   chan *QuizSpectator
+	SubmitQuestion        chan *Question
+	SubmitBet             chan *BetSubmission
+	CancelBet             chan *BetSubmission
+	StartGame             chan string // host ID asking to start the game
+	HostCommands          chan HostCommand
+	Mu                    sync.RWMutex
+	UsersCollection       *mongo.Collection
+	Config                config.QuizConfig
+	Sockets               config.SocketConfig
+	Ledger                *QuizLedger     // nil when running without MongoDB
+	Store                 *QuizGameStore  // nil when running without MongoDB
+	Frames                FrameSource     // live broadcast for questions about its frames, may be nil
+	Alerts                *QuizAlertStore // nil when running without MongoDB
+	OnEnded               func(h *QuizHub)
+
+	settling sync.WaitGroup // payouts still being made; Shutdown waits for them
+	stopped  chan struct{}  // closed once Start returns
 }
 
-func NewQuizHub(usersCollection *mongo.Collection) *QuizHub {
+// NewQuizHub creates a game in the lobby phase with the given ID
+func NewQuizHub(gameID string, usersCollection *mongo.Collection, cfg config.QuizConfig, sockets config.SocketConfig) *QuizHub {
+	var ledger *QuizLedger
+	if usersCollection != nil {
+		ledger = NewQuizLedger(usersCollection, cfg.LedgerTimeout)
+	}
+
+	game := &QuizGameState{
+		GameID:        gameID,
+		Phase:         QuizPhaseLobby,
+		State:         quizengine.StateLobby,
+		Rules:         QuizRules{Mode: ScoringElimination},
+		CreatedAt:     time.Now(),
+		QuestionQueue: make([]*Question, 0),
+		GameActive:    true,
+	}
+
 	return &QuizHub{
-		Players:         make(map[string]*QuizPlayer),
-		GameState:       &QuizGameState{
-			QuestionQueue: make([]*Question, 0),
-			GameActive:    true,
-		},
-		Bets:            make(map[string]*BetSubmission),
-		Register:        make(chan *QuizPlayer, 16),
-		Unregister:      make(chan *QuizPlayer, 16),
+		Players:               make(map[string]*QuizPlayer),
+		Bets:                  make(map[string]*BetSubmission),
+		Banned:                make(map[string]string),
+		Spectators:            make(map[string]*QuizSpectator),
+		GameState:             game,
+		Engine:                NewQuizEngine(cfg),
+		Register:              make(chan *QuizPlayer, 16),
+		Unregister:            make(chan *QuizPlayer, 16),
 		RegisterBroadcaster:   make(chan *QuizBroadcaster, 1),
 		UnregisterBroadcaster: make(chan *QuizBroadcaster, 1),
-		SubmitQuestion:  make(chan *Question, 32),
-		SubmitBet:       make(chan *BetSubmission, 256),
-		UsersCollection: usersCollection,
+		RegisterSpectator:     make(chan *QuizSpectator, 16),
+		UnregisterSpectator:   make(chan *QuizSpectator, 16),
+		SubmitQuestion:        make(chan *Question, cfg.QuestionBuffer),
+		SubmitBet:             make(chan *BetSubmission, cfg.BetBuffer),
+		CancelBet:             make(chan *BetSubmission, cfg.BetBuffer),
+		StartGame:             make(chan string, 1),
+		HostCommands:          make(chan HostCommand, 16),
+		UsersCollection:       usersCollection,
+		Config:                cfg,
+		Sockets:               sockets,
+		Ledger:                ledger,
+		stopped:               make(chan struct{}),
 	}
 }
 
-func (h *QuizHub) Start() {
+func (h *QuizHub) Start(ctx context.Context) {
+	defer close(h.stopped)
 	for {
 		select {
+		case <-ctx.Done():
+			reason := ShutdownReason
+			if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+				reason = cause.Error()
+			}
+			h.Shutdown(reason)
+			return
+
 		case player := <-h.Register:
 			h.Mu.Lock()
+			if _, banned := h.Banned[player.UserID]; banned {
+				// Banned while their buy-in was going through
+				h.Mu.Unlock()
+				if h.Ledger != nil && !player.LedgerEntry.IsZero() {
+					go h.Ledger.Refund(context.Background(), player.LedgerEntry, h.Config.StartingTokens)
+				}
+				select {
+				case player.Send <- map[string]interface{}{
+					"type":    "error",
+					"message": "you have been banned from this game",
+				}:
+				default:
+				}
+				close(player.Send)
+				continue
+			}
+			duplicateEntry := player.LedgerEntry
+			previous := h.Players[player.UserID]
+			if _, err := h.Engine.Join(player.UserID, time.Now()); err != nil {
+				// The game left the lobby while their buy-in was going
+				// through: give it back and let them watch instead
+				h.Mu.Unlock()
+				if h.Ledger != nil && !player.LedgerEntry.IsZero() {
+					go h.Ledger.Refund(context.Background(), player.LedgerEntry, h.Config.StartingTokens)
+				}
+				log.Printf("Quiz player %s (%s) can't join: %v; spectating\n", player.Username, player.UserID, err)
+				h.addSpectator(&QuizSpectator{
+					UserID:   player.UserID,
+					Username: player.Username,
+					Conn:     player.Conn,
+					Send:     player.Send,
+				})
+				continue
+			}
 			h.Players[player.UserID] = player
+			h.syncPlayer(player)
+			if previous != nil {
+				// A second tab replaces the first connection and keeps its buy-in
+				previous.Mu.RLock()
+				player.LedgerEntry = previous.LedgerEntry
+				previous.Mu.RUnlock()
+				if previous.Connected {
+					previous.Connected = false
+					close(previous.Send)
+				}
+
+				// Both connections raced through buy-in; only the first one counts
+				if h.Ledger != nil && !duplicateEntry.IsZero() && duplicateEntry != player.LedgerEntry {
+					go h.Ledger.Refund(context.Background(), duplicateEntry, h.Config.StartingTokens)
+				}
+			} else {
+				if h.Store != nil {
+					h.Store.RecordPlayer(h.GameState.GameID, QuizGamePlayer{
+						UserID:   player.UserID,
+						Username: player.Username,
+						BuyIn:    h.Config.StartingTokens,
+						JoinedAt: player.JoinedAt,
+						IP:       player.IP,
+						DeviceID: player.DeviceID,
+					})
+				}
+			}
+			player.Connected = true
+			playerCount := len(h.Players)
+			tokens, active := player.Tokens, player.IsActive
 			h.Mu.Unlock()
-			
-			// Give player 50 tokens on join
-			player.Mu.Lock()
-			player.Tokens = 50.0
-			player.IsActive = true
-			player.Mu.Unlock()
-			
-			log.Printf("Quiz player %s (%s) joined with 50 tokens (%d total players)\n", 
-				player.Username, player.UserID, len(h.Players))
-			
+
+			if previous != nil {
+				log.Printf("Quiz player %s (%s) reconnected with %.2f tokens (active: %v)\n",
+					player.Username, player.UserID, tokens, active)
+			} else {
+				log.Printf("Quiz player %s (%s) joined with %.0f tokens (%d total players)\n",
+					player.Username, player.UserID, h.Config.StartingTokens, playerCount)
+			}
+
 			// Send current game state to new player
 			h.sendGameStateToPlayer(player)
 
 		case player := <-h.Unregister:
+			// The player stays in the game so they can reconnect; their stack
+			// is settled when the game ends
 			h.Mu.Lock()
-			if _, ok := h.Players[player.UserID]; ok {
-				delete(h.Players, player.UserID)
+			if current, ok := h.Players[player.UserID]; ok && current == player && player.Connected {
+				player.Connected = false
 				close(player.Send)
 			}
+			// A player moved to spectating shares their connection
+			if spectator, ok := h.Spectators[player.UserID]; ok && spectator.Conn == player.Conn {
+				delete(h.Spectators, player.UserID)
+				if spectator.Connected {
+					spectator.Connected = false
+					close(spectator.Send)
+				}
+			}
 			h.Mu.Unlock()
-			log.Printf("Quiz player %s disconnected (%d total players)\n", 
-				player.UserID, len(h.Players))
+			log.Printf("Quiz player %s disconnected\n", player.UserID)
+
+		case spectator := <-h.RegisterSpectator:
+			h.addSpectator(spectator)
+
+		case spectator := <-h.UnregisterSpectator:
+			h.removeSpectator(spectator)
 
 		case broadcaster := <-h.RegisterBroadcaster:
 			h.Mu.Lock()
+			current := h.Broadcaster
+			if current != nil && current.UserID != broadcaster.UserID && !broadcaster.Takeover {
+				h.Mu.Unlock()
+				broadcaster.Send <- map[string]interface{}{
+					"type":    "error",
+					"message": ErrHostActive.Error(),
+				}
+				close(broadcaster.Send)
+				log.Printf("Quiz host %s rejected: %s is already hosting\n", broadcaster.UserID, current.UserID)
+				continue
+			}
 			h.Broadcaster = broadcaster
 			h.Mu.Unlock()
+
+			if current != nil {
+				select {
+				case current.Send <- map[string]interface{}{
+					"type":    "host_replaced",
+					"message": HostTakeoverReason,
+				}:
+				default:
+				}
+				close(current.Send)
+				log.Printf("Quiz host %s replaced by %s\n", current.UserID, broadcaster.UserID)
+			}
 			log.Println("Quiz broadcaster connected")
 
+			// Tell the host which game they're running and whether it has started
+			info := h.Info()
+			h.Mu.RLock()
+			queued := make([]*Question, len(h.GameState.QuestionQueue))
+			copy(queued, h.GameState.QuestionQueue)
+			review := h.GameState.Review
+			h.Mu.RUnlock()
+			state := map[string]interface{}{
+				"type":    "game_state",
+				"game_id": info.GameID,
+				"phase":   info.Phase,
+				"rules":   info.Rules,
+				"players": info.Players,
+				"queued":  queued,
+			}
+			if review != nil {
+				state["review"] = review
+			}
+			broadcaster.Send <- state
+
 		case broadcaster := <-h.UnregisterBroadcaster:
 			h.Mu.Lock()
 			if h.Broadcaster == broadcaster {
@@ -172,375 +447,653 @@ func (h *QuizHub) Start() {
 
 		case bet := <-h.SubmitBet:
 			h.handleBetSubmission(bet)
+
+		case cancel := <-h.CancelBet:
+			h.handleCancelBet(cancel)
+
+		case hostID := <-h.StartGame:
+			h.handleStartGame(hostID)
+
+		case cmd := <-h.HostCommands:
+			h.handleHostCommand(cmd)
 		}
 	}
 }
 
+func (h *QuizHub) handleStartGame(hostID string) {
+	h.Mu.Lock()
+	err := h.Engine.Start(time.Now())
+	if err != nil {
+		phase := h.GameState.Phase
+		h.Mu.Unlock()
+		h.notifyBroadcaster(map[string]interface{}{
+			"type":    "error",
+			"message": "game is already " + phase,
+		})
+		return
+	}
+	h.syncGame()
+	first := h.nextQueued()
+	playerCount := len(h.Players)
+	h.Mu.Unlock()
+
+	log.Printf("Quiz %s started by %s with %d players\n", h.GameState.GameID, hostID, playerCount)
+	if h.Store != nil {
+		h.Store.RecordStart(h.GameState.GameID, h.GameState.StartedAt)
+	}
+
+	started := map[string]interface{}{
+		"type":    "game_started",
+		"game_id": h.GameState.GameID,
+		"players": playerCount,
+	}
+	h.broadcastToPlayers(started)
+	h.notifyBroadcaster(started)
+
+	if first != nil {
+		h.handleNewQuestion(first)
+	} else {
+		h.notifyBroadcaster(map[string]interface{}{
+			"type":              "ready_for_question",
+			"remaining_players": playerCount,
+		})
+	}
+}
+
 func (h *QuizHub) handleNewQuestion(question *Question) {
 	h.Mu.Lock()
-	
-	// If a question is currently active, queue it
-	if h.GameState.QuestionActive {
+	opened, err := h.Engine.Open(question.ID, time.Duration(question.TimeLimit)*time.Second, time.Now())
+	if err != nil {
+		h.Mu.Unlock()
+		h.notifyBroadcaster(map[string]interface{}{
+			"type":    "error",
+			"message": "game has ended",
+		})
+		return
+	}
+
+	// Queued while the game is in the lobby or a question is open or being
+	// reviewed
+	if !opened {
 		h.GameState.QuestionQueue = append(h.GameState.QuestionQueue, question)
-		log.Printf("Question queued: %s (%d in queue)\n", question.Question, len(h.GameState.QuestionQueue))
+		position := len(h.GameState.QuestionQueue)
+		log.Printf("Question queued: %s (%d in queue)\n", question.Question, position)
 		h.Mu.Unlock()
-		
+
 		// Notify broadcaster
 		h.notifyBroadcaster(map[string]interface{}{
-			"type": "question_queued",
-			"question": question,
-			"queue_position": len(h.GameState.QuestionQueue),
+			"type":           "question_queued",
+			"question":       question,
+			"queue_position": position,
 		})
 		return
 	}
-	
-	// Start new question
 	h.GameState.CurrentQuestion = question
-	h.GameState.QuestionActive = true
-	h.GameState.QuestionStartTime = time.Now()
-	h.Bets = make(map[string]*BetSubmission) // Clear previous bets
-	
+	h.Bets = make(map[string]*BetSubmission)
+	h.syncGame()
+
+	if h.Store != nil {
+		h.Store.RecordQuestion(h.GameState.GameID, question, h.GameState.QuestionStartTime)
+	}
+	questionMsg := question.ForClient(h.GameState.QuestionStartTime, h.GameState.Deadline)
 	h.Mu.Unlock()
-	
+
 	log.Printf("Broadcasting new question: %s\n", question.Question)
-	
-	// Broadcast question to all active players
-	questionMsg := QuestionForClient{
-		ID:        question.ID,
-		Question:  question.Question,
-		Options:   question.Options,
-		TimeLimit: question.TimeLimit,
-		StartTime: time.Now().UnixMilli(),
-	}
-	
+
 	broadcastMsg := map[string]interface{}{
 		"type":     "new_question",
 		"question": questionMsg,
 	}
-	
-	log.Printf("Broadcasting question to players: ID=%s, Question=%s, Options=%v, TimeLimit=%d\n", 
+
+	log.Printf("Broadcasting question to players: ID=%s, Question=%s, Options=%v, TimeLimit=%d\n",
 		questionMsg.ID, questionMsg.Question, questionMsg.Options, questionMsg.TimeLimit)
-	
+
 	h.broadcastToPlayers(broadcastMsg)
-	
+
 	// Notify broadcaster that question is live
 	h.notifyBroadcaster(map[string]interface{}{
-		"type": "question_live",
+		"type":        "question_live",
 		"question_id": question.ID,
 	})
-	
+
 	// Start timer
 	h.Mu.Lock()
-	h.GameState.Timer = time.AfterFunc(time.Duration(question.TimeLimit)*time.Second, func() {
-		h.processQuestionResults()
-	})
+	h.armTimer(question)
 	h.Mu.Unlock()
+
+	go h.runQuestionClock(question)
+	go h.runPoolUpdates(question)
+}
+
+// rejectBet tells a player why their bet or cancellation was refused. Callers
+// hold h.Mu.
+func (h *QuizHub) rejectBet(player *QuizPlayer, reason string) {
+	log.Printf("Bet rejected for %s: %s\n", player.UserID, reason)
+	h.sendToPlayer(player, map[string]interface{}{
+		"type":    "bet_rejected",
+		"message": reason,
+	})
+}
+
+// sendToPlayer queues msg for player without blocking, so a slow client
+// can't stall the hub. Callers hold h.Mu.
+func (h *QuizHub) sendToPlayer(player *QuizPlayer, msg interface{}) {
+	if !player.Connected {
+		return
+	}
+	select {
+	case player.Send <- msg:
+	default:
+		// Skip if channel full
+	}
 }
 
+// handleBetSubmission places a bet, or replaces the player's earlier bet on
+// the same question
 func (h *QuizHub) handleBetSubmission(bet *BetSubmission) {
 	h.Mu.Lock()
 	defer h.Mu.Unlock()
-	
-	if !h.GameState.QuestionActive {
-		log.Printf("Bet rejected: no active question\n")
+
+	now := time.Now()
+	err := h.Engine.CheckBet(bet.PlayerID, bet.QuestionID, bet.Timestamp, now)
+	if errors.Is(err, quizengine.ErrNotPlaying) {
+		log.Printf("Bet rejected: player %s not in the game\n", bet.PlayerID)
 		return
 	}
-	
-	player, exists := h.Players[bet.PlayerID]
-	if !exists || !player.IsActive {
-		log.Printf("Bet rejected: player %s not active\n", bet.PlayerID)
+	player := h.Players[bet.PlayerID]
+	if err != nil {
+		h.rejectBet(player, err.Error())
 		return
 	}
-	
-	// Validate bet
-	totalBet := 0.0
-	for _, b := range bet.Bets {
-		totalBet += b
-	}
-	
-	player.Mu.Lock()
-	if totalBet > player.Tokens {
-		player.Mu.Unlock()
-		log.Printf("Bet rejected: insufficient tokens (has %.2f, tried to bet %.2f)\n", player.Tokens, totalBet)
+	if problem := h.GameState.CurrentQuestion.checkAnswer(bet); problem != "" {
+		h.rejectBet(player, problem)
 		return
 	}
-	
-	// Deduct tokens
-	player.Tokens -= totalBet
-	player.CurrentBets = bet.Bets
-	player.Mu.Unlock()
-	
-	// Store bet
+	staked := engineBet(bet)
+	receipt, err := h.Engine.Bet(staked, now)
+	if err != nil {
+		h.rejectBet(player, err.Error())
+		return
+	}
+	for i, stake := range staked.Stakes {
+		bet.Bets[i] = stake.Tokens()
+	}
 	h.Bets[bet.PlayerID] = bet
-	
-	log.Printf("Player %s bet %.2f tokens across %d options\n", bet.PlayerID, totalBet, len(bet.Bets))
-	
+	h.syncPlayer(player)
+
+	if h.Store != nil {
+		h.Store.RecordBet(h.GameState.GameID, h.GameState.CurrentQuestion.ID, *bet)
+	}
+
+	if receipt.Replaced {
+		log.Printf("Player %s replaced their bet: %.2f tokens across %d options (refunded %.2f)\n",
+			bet.PlayerID, receipt.Stake.Tokens(), len(bet.Bets), receipt.Refund.Tokens())
+	} else {
+		log.Printf("Player %s bet %.2f tokens across %d options\n", bet.PlayerID, receipt.Stake.Tokens(), len(bet.Bets))
+	}
+
 	// Notify player of successful bet
-	player.Send <- map[string]interface{}{
-		"type": "bet_confirmed",
-		"bets": bet.Bets,
-		"new_balance": player.Tokens,
+	h.sendToPlayer(player, map[string]interface{}{
+		"type":        "bet_confirmed",
+		"bets":        bet.Bets,
+		"replaced":    receipt.Replaced,
+		"refunded":    receipt.Refund.Tokens(),
+		"new_balance": receipt.Balance.Tokens(),
+	})
+}
+
+// handleCancelBet withdraws a player's bet on the open question and refunds
+// the stake
+func (h *QuizHub) handleCancelBet(cancel *BetSubmission) {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	receipt, err := h.Engine.Cancel(cancel.PlayerID, cancel.QuestionID, cancel.Timestamp, time.Now())
+	if errors.Is(err, quizengine.ErrNotPlaying) {
+		return
+	}
+	player := h.Players[cancel.PlayerID]
+	if err != nil {
+		h.rejectBet(player, err.Error())
+		return
+	}
+	delete(h.Bets, cancel.PlayerID)
+	h.syncPlayer(player)
+	cancel.Cancelled = true
+	cancel.Bets = nil
+
+	if h.Store != nil {
+		h.Store.RecordBet(h.GameState.GameID, h.GameState.CurrentQuestion.ID, *cancel)
 	}
+	log.Printf("Player %s cancelled their bet (refunded %.2f)\n", cancel.PlayerID, receipt.Refund.Tokens())
+
+	h.sendToPlayer(player, map[string]interface{}{
+		"type":        "bet_cancelled",
+		"refunded":    receipt.Refund.Tokens(),
+		"new_balance": receipt.Balance.Tokens(),
+	})
 }
 
-func (h *QuizHub) processQuestionResults() {
+// processQuestionResults closes question and settles its bets. Timers that
+// fire for a question that has since been paused, extended or closed do nothing.
+func (h *QuizHub) processQuestionResults(question *Question) {
 	h.Mu.Lock()
-	
-	if !h.GameState.QuestionActive {
+	if h.GameState.CurrentQuestion != question || !h.Engine.Close(time.Now()) {
 		h.Mu.Unlock()
 		return
 	}
-	
-	question := h.GameState.CurrentQuestion
-	if question == nil {
-		log.Println("processQuestionResults called but CurrentQuestion is nil")
+	h.syncGame()
+
+	log.Printf("Processing results for question: %s (correct answer: %d)\n", question.ID, question.CorrectIndex)
+
+	// The distribution is taken before scoring settles the bets
+	distribution := h.poolUpdate()
+
+	settlement, err := h.Engine.Settle(h.grades(question))
+	if err != nil {
 		h.Mu.Unlock()
+		log.Printf("Quiz %s: failed to settle %s: %v\n", h.GameState.GameID, question.ID, err)
 		return
 	}
-	correctIndex := question.CorrectIndex
-	
-	log.Printf("Processing results for question: %s (correct answer: %d)\n", question.ID, correctIndex)
-	
-	results := QuizResults{
-		Type:              "results",
-		QuestionID:        question.ID,
-		CorrectIndex:      correctIndex,
-		EliminatedPlayers: make([]string, 0),
-		PlayerResults:     make(map[string]PlayerResult),
-		Jackpot:           h.GameState.Jackpot,
-	}
-	
-	// Process each player
-	for playerID, player := range h.Players {
-		if !player.IsActive {
-			continue
-		}
-		
-		bet, hasBet := h.Bets[playerID]
-		
-		player.Mu.Lock()
-		
-		// Check if player has bet on correct answer
-		correctBet := 0.0
-		wrongBets := 0.0
-		
-		if hasBet && correctIndex < len(bet.Bets) {
-			correctBet = bet.Bets[correctIndex]
-			for i, b := range bet.Bets {
-				if i != correctIndex {
-					wrongBets += b
-				}
-			}
-		}
-		
-		// If player didn't bet on correct answer or didn't bet at all, eliminate
-		if correctBet == 0 {
-			player.IsActive = false
-			results.EliminatedPlayers = append(results.EliminatedPlayers, playerID)
-			
-			// All their money goes to jackpot
-			if hasBet {
-				h.GameState.Jackpot += wrongBets
-			}
-			
-			var betArray []float64
-			if hasBet {
-				betArray = bet.Bets
-			}
-			
-			results.PlayerResults[playerID] = PlayerResult{
-				Bets:          betArray,
-				Won:           false,
-				TokensReturned: 0,
-				TokensLost:    wrongBets,
-				NewBalance:    player.Tokens,
-			}
-			
-			log.Printf("Player %s ELIMINATED (bet %.2f on correct, %.2f on wrong)\n", 
-				playerID, correctBet, wrongBets)
-		} else {
-			// Player survives - return correct bet, jackpot gets wrong bets
-			player.Tokens += correctBet
-			h.GameState.Jackpot += wrongBets
-			
-			var betArray []float64
-			if hasBet {
-				betArray = bet.Bets
-			}
-			
-			results.PlayerResults[playerID] = PlayerResult{
-				Bets:          betArray,
-				Won:           true,
-				TokensReturned: correctBet,
-				TokensLost:    wrongBets,
-				NewBalance:    player.Tokens,
-			}
-			
-			log.Printf("Player %s SURVIVED (returned %.2f, lost %.2f to jackpot, new balance: %.2f)\n", 
-				playerID, correctBet, wrongBets, player.Tokens)
-		}
-		
-		player.Mu.Unlock()
+	results := h.quizResults(question, settlement)
+	h.GameState.CurrentQuestion = nil
+	h.syncGame()
+	h.syncPlayers()
+	houseJackpot := settlement.HouseJackpot.Tokens()
+
+	if h.Store != nil {
+		h.Store.RecordResults(h.GameState.GameID, results, time.Now())
 	}
-	
-	// Count remaining active players
-	remainingCount := 0
-	var lastPlayer *QuizPlayer
-	for _, player := range h.Players {
-		if player.IsActive {
-			remainingCount++
-			lastPlayer = player
+
+	// Eliminated players stay connected and watch the rest of the game
+	for _, playerID := range results.EliminatedPlayers {
+		if player, exists := h.Players[playerID]; exists {
+			h.sendToPlayer(player, map[string]interface{}{
+				"type":       "eliminated",
+				"message":    "You have been eliminated from the quiz! You can keep watching.",
+				"spectating": true,
+			})
 		}
 	}
-	
-	results.RemainingPlayers = remainingCount
-	results.Jackpot = h.GameState.Jackpot
-	
-	log.Printf("Results: %d eliminated, %d remaining, jackpot: %.2f\n", 
-		len(results.EliminatedPlayers), remainingCount, h.GameState.Jackpot)
-	
-	// Check for game end conditions
-	gameEnded := false
-	if remainingCount == 1 && lastPlayer != nil {
-		// Winner!
-		lastPlayer.Mu.Lock()
-		lastPlayer.Tokens += h.GameState.Jackpot
-		winnerBalance := lastPlayer.Tokens
-		winnerID := lastPlayer.UserID
-		lastPlayer.Mu.Unlock()
-		
-		log.Printf("WINNER: %s with %.2f tokens!\n", winnerID, winnerBalance)
-		
-		results.PlayerResults[winnerID] = PlayerResult{
-			Bets:          results.PlayerResults[winnerID].Bets,
-			Won:           true,
-			TokensReturned: results.PlayerResults[winnerID].TokensReturned + h.GameState.Jackpot,
-			TokensLost:    results.PlayerResults[winnerID].TokensLost,
-			NewBalance:    winnerBalance,
-		}
-		
-		h.GameState.Jackpot = 0
-		gameEnded = true
-		
-	} else if remainingCount == 0 {
-		// House wins
-		log.Printf("HOUSE WINS! Jackpot: %.2f tokens\n", h.GameState.Jackpot)
-		h.GameState.Jackpot = 0
-		gameEnded = true
-	}
-	
-	h.GameState.QuestionActive = false
-	h.GameState.CurrentQuestion = nil
-	
 	h.Mu.Unlock()
-	
+
+	log.Printf("Results: %d eliminated (%s), %d remaining, jackpot: %.2f\n",
+		len(results.EliminatedPlayers), strings.Join(results.EliminatedPlayers, ", "), results.RemainingPlayers, results.Jackpot)
+	if results.Odds > 0 {
+		log.Printf("Parimutuel odds %.4f, rake %.6f\n", results.Odds, results.Rake)
+	}
+	if settlement.WinnerID != "" {
+		log.Printf("WINNER: %s with %.2f tokens!\n", settlement.WinnerID, results.PlayerResults[settlement.WinnerID].NewBalance)
+	} else if settlement.Ended {
+		log.Printf("HOUSE WINS! Jackpot: %.2f tokens\n", houseJackpot)
+	}
+
 	// Broadcast results to all players
 	h.broadcastToPlayers(results)
-	
+
 	// Notify broadcaster
 	h.notifyBroadcaster(results)
-	
-	// Eliminate players by disconnecting them
-	h.Mu.RLock()
-	for _, playerID := range results.EliminatedPlayers {
-		if player, exists := h.Players[playerID]; exists {
-			player.Send <- map[string]interface{}{
-				"type": "eliminated",
-				"message": "You have been eliminated from the quiz!",
+
+	// If game ended, notify everyone
+	if settlement.Ended {
+		h.finishGame(settlement.WinnerID, houseJackpot, map[string]interface{}{
+			"type":          "game_ended",
+			"results":       results,
+			"winner":        settlement.WinnerID,
+			"house_jackpot": houseJackpot,
+		})
+	} else if h.Config.ReviewDuration > 0 {
+		h.startReview(question, &results, distribution)
+	} else {
+		h.nextQuestion(results.RemainingPlayers)
+	}
+}
+
+// finishGame moves the game to the ended phase, pays out every stack, records
+// the outcome and sends msg to everyone. It does nothing if the game has
+// already ended.
+func (h *QuizHub) finishGame(winnerID string, houseJackpot float64, msg map[string]interface{}) {
+	h.Mu.Lock()
+	if err := h.Engine.Finish(time.Now()); err != nil {
+		h.Mu.Unlock()
+		return
+	}
+	// Counted under Mu so a Shutdown that finds the game ended waits for the
+	// payouts below
+	h.settling.Add(1)
+	defer h.settling.Done()
+	h.syncGame()
+	remaining := make([]*QuizPlayer, 0, len(h.Players))
+	for _, player := range h.Players {
+		remaining = append(remaining, player)
+	}
+	h.Mu.Unlock()
+
+	if h.Store != nil {
+		h.Store.RecordEnd(h.GameState.GameID, QuizPhaseEnded, h.GameState.EndedAt, winnerID, houseJackpot, h.playerRecords())
+	}
+
+	// Credit final balances, including the jackpot for the winner. Flagged
+	// players' payouts wait for the integrity screen, which needs the
+	// transcript written first.
+	screened := false
+	if h.Alerts != nil && h.Store != nil {
+		if h.Config.HoldFlaggedPayouts {
+			h.settling.Add(1)
+			screened = h.Store.AfterWrites(func() {
+				defer h.settling.Done()
+				h.screenGame(remaining)
+			})
+			if !screened {
+				h.settling.Done()
 			}
-			// Close connection after a delay to ensure message is sent
-			go func(p *QuizPlayer) {
-				time.Sleep(2 * time.Second)
-				p.Conn.Close()
-			}(player)
+		} else {
+			h.Store.AfterWrites(func() { h.screenGame(nil) })
 		}
 	}
-	h.Mu.RUnlock()
-	
-	// If game ended, notify everyone
-	if gameEnded {
-		h.Mu.Lock()
-		h.GameState.GameActive = false
+	if !screened {
+		for _, player := range remaining {
+			h.goSettle(player)
+		}
+	}
+
+	h.broadcastToPlayers(msg)
+	h.notifyBroadcaster(msg)
+
+	if h.OnEnded != nil {
+		h.OnEnded(h)
+	}
+}
+
+// nextQuestion plays the next queued question after the gap, or tells the
+// host to send one. It may block for the gap, so the hub loop runs it in a
+// goroutine, which gives up if the hub stops meanwhile.
+func (h *QuizHub) nextQuestion(remainingPlayers int) {
+	h.Mu.Lock()
+	if nextQuestion := h.nextQueued(); nextQuestion != nil {
 		h.Mu.Unlock()
-		
-		h.broadcastToPlayers(map[string]interface{}{
-			"type": "game_ended",
-			"results": results,
-		})
-		
+
+		// Small delay before next question
+		gap := h.GameState.QuestionGap
+		if gap == 0 {
+			gap = h.Config.NextQuestionDelay
+		}
+		timer := time.NewTimer(gap)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-h.stopped:
+			return
+		}
+		select {
+		case h.SubmitQuestion <- nextQuestion:
+		case <-h.stopped:
+		}
+	} else {
+		h.Mu.Unlock()
+		// Notify broadcaster they can submit next question
 		h.notifyBroadcaster(map[string]interface{}{
-			"type": "game_ended",
-			"results": results,
+			"type":              "ready_for_question",
+			"remaining_players": remainingPlayers,
 		})
-	} else {
-		// Process next question in queue
-		h.Mu.Lock()
-		if len(h.GameState.QuestionQueue) > 0 {
-			nextQuestion := h.GameState.QuestionQueue[0]
-			h.GameState.QuestionQueue = h.GameState.QuestionQueue[1:]
-			h.Mu.Unlock()
-			
-			// Small delay before next question
-			time.Sleep(3 * time.Second)
-			h.SubmitQuestion <- nextQuestion
+	}
+}
+
+// QuizSnapshot is the in-flight game state written to quiz_snapshots on shutdown
+type QuizSnapshot struct {
+	GameID          string                    `bson:"game_id"`
+	Phase           string                    `bson:"phase"`
+	Rules           QuizRules                 `bson:"rules"`
+	SavedAt         time.Time                 `bson:"saved_at"`
+	GameActive      bool                      `bson:"game_active"`
+	QuestionActive  bool                      `bson:"question_active"`
+	CurrentQuestion *Question                 `bson:"current_question,omitempty"`
+	QuestionQueue   []*Question               `bson:"question_queue"`
+	Jackpot         float64                   `bson:"jackpot"`
+	Players         []QuizPlayerSnapshot      `bson:"players"`
+	Bets            map[string]*BetSubmission `bson:"bets"`
+}
+
+// QuizPlayerSnapshot is a player's balance and status at snapshot time
+type QuizPlayerSnapshot struct {
+	UserID      string    `bson:"user_id"`
+	Username    string    `bson:"username"`
+	Email       string    `bson:"email"`
+	Tokens      float64   `bson:"tokens"`
+	IsActive    bool      `bson:"is_active"`
+	Connected   bool      `bson:"connected"`
+	CurrentBets []float64 `bson:"current_bets"`
+	Points      float64   `bson:"points"`
+	Lives       int       `bson:"lives"`
+}
+
+// Snapshot copies the current game state
+func (h *QuizHub) Snapshot() QuizSnapshot {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+	return h.snapshot()
+}
+
+// snapshot copies the current game state. Callers hold h.Mu.
+func (h *QuizHub) snapshot() QuizSnapshot {
+	snapshot := QuizSnapshot{
+		GameID:          h.GameState.GameID,
+		Phase:           h.GameState.Phase,
+		SavedAt:         time.Now(),
+		Rules:           h.GameState.Rules,
+		GameActive:      h.GameState.GameActive,
+		QuestionActive:  h.GameState.QuestionActive,
+		CurrentQuestion: h.GameState.CurrentQuestion,
+		QuestionQueue:   h.GameState.QuestionQueue,
+		Jackpot:         h.GameState.Jackpot,
+		Players:         make([]QuizPlayerSnapshot, 0, len(h.Players)),
+		Bets:            h.Bets,
+	}
+
+	for _, player := range h.Players {
+		player.Mu.RLock()
+		snapshot.Players = append(snapshot.Players, QuizPlayerSnapshot{
+			UserID:      player.UserID,
+			Username:    player.Username,
+			Email:       player.Email,
+			Tokens:      player.Tokens,
+			IsActive:    player.IsActive,
+			Connected:   player.Connected,
+			CurrentBets: player.CurrentBets,
+			Points:      player.Points,
+			Lives:       player.Lives,
+		})
+		player.Mu.RUnlock()
+	}
+
+	return snapshot
+}
+
+// Shutdown stops the question timer, persists the in-flight game and closes
+// every player and the host with a close frame. A game that already ended was
+// recorded and paid out by finishGame, so archiving it only closes the sockets.
+func (h *QuizHub) Shutdown(reason string) {
+	h.Mu.Lock()
+	if h.GameState.Timer != nil {
+		h.GameState.Timer.Stop()
+	}
+	h.clearReview()
+	snapshot := h.snapshot()
+	inFlight := h.Engine.InFlight()
+	jackpot := h.GameState.Jackpot
+	// Ending the game stops the question's clock and pool updates, and keeps a
+	// timer that fires now from settling it a second time
+	live := h.Engine.Finish(time.Now()) == nil
+	h.syncGame()
+	h.Mu.Unlock()
+
+	if live && h.UsersCollection != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), h.Config.SnapshotTimeout)
+		snapshots := h.UsersCollection.Database().Collection("quiz_snapshots")
+		if _, err := snapshots.InsertOne(ctx, snapshot); err != nil {
+			log.Printf("Failed to persist quiz state: %v\n", err)
 		} else {
-			h.Mu.Unlock()
-			// Notify broadcaster they can submit next question
-			h.notifyBroadcaster(map[string]interface{}{
-				"type": "ready_for_question",
-				"remaining_players": remainingCount,
-			})
+			log.Println("Quiz state persisted to quiz_snapshots")
+		}
+		cancel()
+	}
+
+	// Record payouts, including refunded bets, for games cut short
+	if live && h.Store != nil {
+		records := h.playerRecords()
+		for i := range records {
+			records[i].Payout = (ToUnits(records[i].Payout) + inFlight[records[i].UserID]).Tokens()
+		}
+		h.Store.RecordEnd(h.GameState.GameID, QuizRecordAborted, time.Now(), "", jackpot, records)
+	}
+
+	h.Mu.Lock()
+	players := make([]*QuizPlayer, 0, len(h.Players))
+	for id, player := range h.Players {
+		players = append(players, player)
+		delete(h.Players, id)
+	}
+	spectators := make([]*QuizSpectator, 0, len(h.Spectators))
+	for id, spectator := range h.Spectators {
+		if spectator.Connected {
+			spectators = append(spectators, spectator)
+		}
+		delete(h.Spectators, id)
+	}
+	broadcaster := h.Broadcaster
+	h.Broadcaster = nil
+	h.Mu.Unlock()
+
+	// Pay out every stack, refunding bets on the unanswered question
+	if live {
+		for _, player := range players {
+			h.settlePlayer(context.Background(), player, inFlight[player.UserID])
+		}
+	}
+
+	for _, player := range players {
+		if player.Connected {
+			sendCloseFrame(player.Conn, reason)
 		}
 	}
+	for _, spectator := range spectators {
+		sendCloseFrame(spectator.Conn, reason)
+	}
+	if broadcaster != nil {
+		sendCloseFrame(broadcaster.Conn, reason)
+	}
+
+	// A game that ended just before may still be paying out, or waiting on its
+	// integrity screen to
+	h.settling.Wait()
+
+	log.Printf("Quiz %s shut down (%d players closed)\n", h.GameState.GameID, len(players))
+}
+
+// CurrentGameID returns the ID buy-ins are recorded against
+func (h *QuizHub) CurrentGameID() string {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+	return h.GameState.GameID
+}
+
+// goSettle settles player on its own goroutine, which Shutdown waits for.
+// Callers hold Mu, or are inside a finishGame that counted itself.
+func (h *QuizHub) goSettle(player *QuizPlayer) {
+	h.settling.Add(1)
+	go func() {
+		defer h.settling.Done()
+		h.settlePlayer(context.Background(), player, 0)
+	}()
+}
+
+// settlePlayer credits the player's remaining tokens plus extra back to their
+// MongoDB balance and closes their ledger entry
+func (h *QuizHub) settlePlayer(ctx context.Context, player *QuizPlayer, extra TokenUnits) {
+	if h.Ledger == nil || player.LedgerEntry.IsZero() {
+		return
+	}
+
+	player.Mu.RLock()
+	payout := (ToUnits(player.Tokens) + extra).Tokens()
+	player.Mu.RUnlock()
+
+	if err := h.Ledger.Settle(ctx, player.LedgerEntry, payout); err != nil {
+		log.Printf("Quiz ledger: failed to settle %s (%.2f tokens): %v\n", player.UserID, payout, err)
+		return
+	}
+	log.Printf("Quiz ledger: settled %s with %.2f tokens\n", player.UserID, payout)
 }
 
+// sendGameStateToPlayer catches a player up on the game. The state is built
+// under the lock and sent without blocking, so a full Send buffer can't hold
+// the lock.
 func (h *QuizHub) sendGameStateToPlayer(player *QuizPlayer) {
+	state := h.playerState(player)
+
+	h.Mu.RLock()
+	h.sendToPlayer(player, state)
+	h.Mu.RUnlock()
+}
+
+// playerState is the game as player sees it on joining
+func (h *QuizHub) playerState(player *QuizPlayer) map[string]interface{} {
 	h.Mu.RLock()
 	defer h.Mu.RUnlock()
-	
+
 	state := map[string]interface{}{
-		"type": "game_state",
+		"type":        "game_state",
+		"game_id":     h.GameState.GameID,
+		"phase":       h.GameState.Phase,
 		"game_active": h.GameState.GameActive,
-		"jackpot": h.GameState.Jackpot,
-		"tokens": player.Tokens,
-		"is_active": player.IsActive,
+		"jackpot":     h.GameState.Jackpot,
+		"tokens":      player.Tokens,
+		"is_active":   player.IsActive,
+		"rules":       h.GameState.Rules,
+		"points":      player.Points,
+		"lives":       player.Lives,
+		"spectating":  !player.IsActive,
 	}
-	
+
+	if bet, ok := h.Bets[player.UserID]; ok && h.GameState.QuestionActive {
+		state["current_bets"] = bet.Bets
+	}
+
 	if h.GameState.QuestionActive && h.GameState.CurrentQuestion != nil {
-		elapsed := time.Since(h.GameState.QuestionStartTime).Seconds()
-		remaining := float64(h.GameState.CurrentQuestion.TimeLimit) - elapsed
-		
-		if remaining > 0 {
-			state["current_question"] = QuestionForClient{
-				ID:        h.GameState.CurrentQuestion.ID,
-				Question:  h.GameState.CurrentQuestion.Question,
-				Options:   h.GameState.CurrentQuestion.Options,
-				TimeLimit: h.GameState.CurrentQuestion.TimeLimit,
-				StartTime: h.GameState.QuestionStartTime.UnixMilli(),
-			}
+		if h.timeLeft() > 0 {
+			state["clock"] = h.clockMessage()
+			state["current_question"] = h.GameState.CurrentQuestion.ForClient(h.GameState.QuestionStartTime, h.GameState.Deadline)
 		}
 	}
-	
-	player.Send <- state
+	if h.GameState.Review != nil {
+		state["review"] = h.GameState.Review
+	}
+	return state
 }
 
+// broadcastToPlayers sends msg to every connected player, eliminated ones
+// included, and to spectators
 func (h *QuizHub) broadcastToPlayers(msg interface{}) {
 	h.Mu.RLock()
 	defer h.Mu.RUnlock()
-	
+
 	for _, player := range h.Players {
+		if !player.Connected {
+			continue
+		}
 		select {
 		case player.Send <- msg:
 		default:
 			// Skip if channel full
 		}
 	}
+	h.broadcastToSpectators(msg)
 }
 
 func (h *QuizHub) notifyBroadcaster(msg interface{}) {
 	h.Mu.RLock()
 	defer h.Mu.RUnlock()
-	
+
 	if h.Broadcaster != nil {
 		select {
 		case h.Broadcaster.Send <- msg:
@@ -557,22 +1110,22 @@ func (p *QuizPlayer) ReadPump(hub *QuizHub) {
 		hub.Unregister <- p
 		p.Conn.Close()
 	}()
-	
-	p.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+
+	p.Conn.SetReadDeadline(time.Now().Add(hub.Sockets.ReadTimeout))
 	p.Conn.SetPongHandler(func(string) error {
-		p.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		p.Conn.SetReadDeadline(time.Now().Add(hub.Sockets.ReadTimeout))
 		return nil
 	})
-	
+
 	for {
 		var msg map[string]interface{}
 		err := p.Conn.ReadJSON(&msg)
 		if err != nil {
 			break
 		}
-		
+
 		msgType, _ := msg["type"].(string)
-		
+
 		switch msgType {
 		case "submit_bet":
 			// Extract bet data
@@ -583,28 +1136,45 @@ func (p *QuizPlayer) ReadPump(hub *QuizHub) {
 					bets[i] = val
 				}
 			}
-			
+
 			questionID, _ := msg["question_id"].(string)
-			
+
 			bet := &BetSubmission{
 				PlayerID:   p.UserID,
 				QuestionID: questionID,
 				Bets:       bets,
 				Timestamp:  time.Now(),
 			}
-			
+			if value, ok := msg["value"].(float64); ok {
+				bet.Value = &value
+			}
+			if msg["point"] != nil {
+				var point Point
+				if remarshal(msg["point"], &point) == nil {
+					bet.Point = &point
+				}
+			}
+
 			hub.SubmitBet <- bet
+
+		case "cancel_bet":
+			questionID, _ := msg["question_id"].(string)
+			hub.CancelBet <- &BetSubmission{
+				PlayerID:   p.UserID,
+				QuestionID: questionID,
+				Timestamp:  time.Now(),
+			}
 		}
 	}
 }
 
-func (p *QuizPlayer) WritePump() {
-	ticker := time.NewTicker(30 * time.Second)
+func (p *QuizPlayer) WritePump(hub *QuizHub) {
+	ticker := time.NewTicker(hub.Sockets.PingInterval)
 	defer func() {
 		ticker.Stop()
 		p.Conn.Close()
 	}()
-	
+
 	for {
 		select {
 		case msg, ok := <-p.Send:
@@ -612,15 +1182,15 @@ func (p *QuizPlayer) WritePump() {
 				p.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			
-			p.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+			p.Conn.SetWriteDeadline(time.Now().Add(hub.Sockets.WriteTimeout))
 			err := p.Conn.WriteJSON(msg)
 			if err != nil {
 				return
 			}
-			
+
 		case <-ticker.C:
-			p.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			p.Conn.SetWriteDeadline(time.Now().Add(hub.Sockets.WriteTimeout))
 			if err := p.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -633,16 +1203,16 @@ func (b *QuizBroadcaster) ReadPump(hub *QuizHub) {
 		hub.UnregisterBroadcaster <- b
 		b.Conn.Close()
 	}()
-	
+
 	for {
 		var msg map[string]interface{}
 		err := b.Conn.ReadJSON(&msg)
 		if err != nil {
 			break
 		}
-		
+
 		msgType, _ := msg["type"].(string)
-		
+
 		switch msgType {
 		case "submit_question":
 			// Parse question data
@@ -650,38 +1220,105 @@ func (b *QuizBroadcaster) ReadPump(hub *QuizHub) {
 			optionsData, _ := msg["options"].([]interface{})
 			correctIndex, _ := msg["correct_index"].(float64)
 			timeLimit, _ := msg["time_limit"].(float64)
-			
+
 			options := make([]string, 0)
 			for _, opt := range optionsData {
 				if str, ok := opt.(string); ok && str != "" {
 					options = append(options, str)
 				}
 			}
-			
-			if len(options) < 2 || len(options) > 4 {
-				log.Printf("Invalid question: must have 2-4 options\n")
-				continue
-			}
-			
+
+			// "type" names the message, so the question's type is question_type
+			questionType, _ := msg["question_type"].(string)
+			answer, _ := msg["answer"].(float64)
+			imageURL, _ := msg["image_url"].(string)
+			explanation, _ := msg["explanation"].(string)
+			referenceURL, _ := msg["reference_url"].(string)
+
 			question := &Question{
 				ID:           fmt.Sprintf("q-%d", time.Now().UnixNano()),
+				Type:         questionType,
 				Question:     questionText,
 				Options:      options,
 				CorrectIndex: int(correctIndex),
+				Answer:       answer,
+				ImageURL:     imageURL,
+				Explanation:  strings.TrimSpace(explanation),
+				ReferenceURL: strings.TrimSpace(referenceURL),
 				TimeLimit:    int(timeLimit),
 				CreatedAt:    time.Now(),
 			}
-			
+			if err := question.decodeFormat(msg); err != nil {
+				log.Printf("Invalid question: %v\n", err)
+				continue
+			}
+
+			// Attach the frame being broadcast right now, optionally with its
+			// segmentation regions; region_index picks a hotspot's target
+			if attach, _ := msg["attach_frame"].(bool); attach {
+				withRegions, _ := msg["attach_regions"].(bool)
+				regionIndex := -1
+				if index, ok := msg["region_index"].(float64); ok {
+					regionIndex = int(index)
+				}
+				if err := hub.attachFrame(question, withRegions, regionIndex); err != nil {
+					hub.notifyBroadcaster(map[string]interface{}{
+						"type":    "error",
+						"message": err.Error(),
+					})
+					continue
+				}
+			}
+
+			if err := question.Validate(); err != nil {
+				log.Printf("Invalid question: %v\n", err)
+				continue
+			}
+
 			hub.SubmitQuestion <- question
+
+		case "start_game":
+			hub.StartGame <- b.UserID
+
+		case HostPauseQuestion, HostResumeQuestion, HostExtendQuestion, HostEndQuestion,
+			HostKickPlayer, HostVoidQuestion, HostRemoveQueued, HostReorderQueue, HostAdjustBalance, HostEndGame, HostEndReview:
+			seconds, _ := msg["seconds"].(float64)
+			playerID, _ := msg["player_id"].(string)
+			ban, _ := msg["ban"].(bool)
+			reason, _ := msg["reason"].(string)
+			amount, _ := msg["amount"].(float64)
+			questionID, _ := msg["question_id"].(string)
+			jackpot, _ := msg["jackpot"].(string)
+			idsData, _ := msg["question_ids"].([]interface{})
+			questionIDs := make([]string, 0, len(idsData))
+			for _, id := range idsData {
+				if str, ok := id.(string); ok {
+					questionIDs = append(questionIDs, str)
+				}
+			}
+
+			hub.HostCommands <- HostCommand{
+				Type:        msgType,
+				HostID:      b.UserID,
+				Admin:       b.Admin,
+				Seconds:     int(seconds),
+				PlayerID:    playerID,
+				Ban:         ban,
+				Reason:      reason,
+				Amount:      amount,
+				QuestionID:  questionID,
+				QuestionIDs: questionIDs,
+				Jackpot:     jackpot,
+			}
 		}
 	}
 }
 
-func (b *QuizBroadcaster) WritePump() {
+func (b *QuizBroadcaster) WritePump(hub *QuizHub) {
 	defer b.Conn.Close()
-	
+
 	for msg := range b.Send {
-		b.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		b.Conn.SetWriteDeadline(time.Now().Add(hub.Sockets.WriteTimeout))
 		err := b.Conn.WriteJSON(msg)
 		if err != nil {
 			return
@@ -689,7 +1326,22 @@ func (b *QuizBroadcaster) WritePump() {
 	}
 }
 
-func ConnectQuizBroadcaster(hub *QuizHub, w http.ResponseWriter, r *http.Request) {
+// HostConflict reports whether hostID would replace a different connected host
+func (h *QuizHub) HostConflict(hostID string) bool {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+	return h.Broadcaster != nil && h.Broadcaster.UserID != hostID
+}
+
+// ConnectQuizBroadcaster connects hostID as the quiz host. If another host is
+// connected the request is refused unless takeover is set; callers must only
+// set takeover and admin for admins.
+func ConnectQuizBroadcaster(hub *QuizHub, w http.ResponseWriter, r *http.Request, hostID string, takeover, admin bool) {
+	if !takeover && hub.HostConflict(hostID) {
+		http.Error(w, ErrHostActive.Error(), http.StatusConflict)
+		return
+	}
+
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true
@@ -697,26 +1349,81 @@ func ConnectQuizBroadcaster(hub *QuizHub, w http.ResponseWriter, r *http.Request
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
-	
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		w.WriteHeader(http.StatusUpgradeRequired)
 		w.Write([]byte(`{"error": "WebSocket upgrade failed"}`))
 		return
 	}
-	
+
 	broadcaster := &QuizBroadcaster{
-		Conn: conn,
-		Send: make(chan interface{}, 64),
+		UserID:   hostID,
+		Takeover: takeover,
+		Admin:    admin,
+		Conn:     conn,
+		Send:     make(chan interface{}, hub.Config.PlayerSendBuffer),
 	}
-	
+
 	hub.RegisterBroadcaster <- broadcaster
-	
-	go broadcaster.WritePump()
+
+	go broadcaster.WritePump(hub)
 	go broadcaster.ReadPump(hub)
 }
 
+// ConnectQuizPlayer debits the buy-in from the user's token balance and joins
+// them to the game's lobby. Players who already bought in can reconnect at any
+// time; anyone else arriving once the game is running watches as a spectator.
 func ConnectQuizPlayer(hub *QuizHub, w http.ResponseWriter, r *http.Request, userID, username, email string) {
+	hub.Mu.RLock()
+	gameActive := hub.GameState.GameActive
+	running := hub.GameState.Phase == QuizPhaseRunning
+	_, returning := hub.Players[userID]
+	_, banned := hub.Banned[userID]
+	hub.Mu.RUnlock()
+
+	if running && !returning && !banned {
+		ConnectQuizSpectator(hub, w, r, userID, username)
+		return
+	}
+
+	if banned {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "you have been banned from this game"})
+		return
+	}
+
+	// Returning players already bought in and may rejoin to see the final results
+	if !gameActive && !returning {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "game has ended"})
+		return
+	}
+
+	var ledgerEntry primitive.ObjectID
+	if hub.Ledger != nil && !returning {
+		entryID, err := hub.Ledger.BuyIn(r.Context(), hub.CurrentGameID(), userID, hub.Config.StartingTokens)
+		if errors.Is(err, ErrInsufficientTokens) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPaymentRequired)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":  err.Error(),
+				"buy_in": hub.Config.StartingTokens,
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Quiz buy-in failed for %s: %v\n", userID, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "buy-in failed"})
+			return
+		}
+		ledgerEntry = entryID
+	}
+
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true
@@ -724,25 +1431,30 @@ func ConnectQuizPlayer(hub *QuizHub, w http.ResponseWriter, r *http.Request, use
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
-	
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		w.WriteHeader(http.StatusUpgradeRequired)
-		json.NewEncoder(w).Encode(map[string]string{"error": "WebSocket upgrade failed"})
+		// Upgrade already wrote the error response; just give the buy-in back
+		if hub.Ledger != nil && !returning {
+			hub.Ledger.Refund(context.Background(), ledgerEntry, hub.Config.StartingTokens)
+		}
 		return
 	}
-	
+
 	player := &QuizPlayer{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
-		Conn:     conn,
-		Send:     make(chan interface{}, 64),
-		IsActive: true,
+		UserID:      userID,
+		Username:    username,
+		Email:       email,
+		Conn:        conn,
+		Send:        make(chan interface{}, hub.Config.PlayerSendBuffer),
+		IsActive:    true,
+		LedgerEntry: ledgerEntry,
+		IP:          clientIP(r),
+		DeviceID:    deviceID(r),
 	}
-	
+
 	hub.Register <- player
-	
-	go player.WritePump()
+
+	go player.WritePump(hub)
 	go player.ReadPump(hub)
 }
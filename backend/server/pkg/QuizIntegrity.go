@@ -0,0 +1,451 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dilyxs/medMarket/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of integrity alert
+const (
+	AlertIdenticalBets = "identical_bets" // several accounts keep placing the same bet
+	AlertLateBets      = "late_bets"      // correct bets placed just before questions closed, as if the answer had leaked
+	AlertSharedIP      = "shared_ip"      // accounts in one game connecting from the same address
+	AlertSharedDevice  = "shared_device"  // accounts in one game using the same device
+)
+
+// Alert statuses. An open alert holds its players' payouts when
+// quiz.hold_flagged_payouts is set; dismissing releases them and confirming
+// forfeits them.
+const (
+	AlertOpen      = "open"
+	AlertDismissed = "dismissed"
+	AlertConfirmed = "confirmed"
+)
+
+// ErrAlertReviewed is returned when resolving an alert that isn't open
+var ErrAlertReviewed = errors.New("alert has already been reviewed")
+
+// QuizAlert is one suspicious pattern found in a finished game
+type QuizAlert struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	GameID      string             `bson:"game_id" json:"game_id"`
+	Kind        string             `bson:"kind" json:"kind"`
+	UserIDs     []string           `bson:"user_ids" json:"user_ids"`
+	QuestionIDs []string           `bson:"question_ids,omitempty" json:"question_ids,omitempty"`
+	Detail      string             `bson:"detail" json:"detail"`
+	Held        bool               `bson:"held" json:"held"` // the players' payouts are waiting for review
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ReviewedBy  string             `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewedAt  time.Time          `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	Note        string             `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+// QuizAlertStore keeps integrity alerts in the quiz_alerts collection
+type QuizAlertStore struct {
+	Alerts  *mongo.Collection
+	Timeout time.Duration
+}
+
+// NewQuizAlertStore creates a store for the given collection
+func NewQuizAlertStore(alerts *mongo.Collection, timeout time.Duration) *QuizAlertStore {
+	return &QuizAlertStore{Alerts: alerts, Timeout: timeout}
+}
+
+// Insert stores new alerts
+func (s *QuizAlertStore) Insert(ctx context.Context, alerts []QuizAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	docs := make([]interface{}, len(alerts))
+	for i := range alerts {
+		docs[i] = alerts[i]
+	}
+	_, err := s.Alerts.InsertMany(ctx, docs)
+	return err
+}
+
+// List returns alerts newest first, filtered by status and game when set
+func (s *QuizAlertStore) List(ctx context.Context, status, gameID string, limit int64) ([]QuizAlert, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if gameID != "" {
+		filter["game_id"] = gameID
+	}
+	cursor, err := s.Alerts.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]QuizAlert, 0)
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// Resolve marks an open alert dismissed or confirmed
+func (s *QuizAlertStore) Resolve(ctx context.Context, id primitive.ObjectID, status, reviewer, note string) (*QuizAlert, error) {
+	if status != AlertDismissed && status != AlertConfirmed {
+		return nil, invalid(fmt.Errorf("status must be %s or %s", AlertDismissed, AlertConfirmed))
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var alert QuizAlert
+	err := s.Alerts.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": AlertOpen},
+		bson.M{"$set": bson.M{
+			"status":      status,
+			"reviewed_by": reviewer,
+			"reviewed_at": time.Now(),
+			"note":        note,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&alert)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if count, _ := s.Alerts.CountDocuments(ctx, bson.M{"_id": id}); count > 0 {
+			return nil, ErrAlertReviewed
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// OpenHolds reports whether userID still has an open alert holding their
+// payout from gameID
+func (s *QuizAlertStore) OpenHolds(ctx context.Context, gameID, userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	count, err := s.Alerts.CountDocuments(ctx, bson.M{
+		"game_id":  gameID,
+		"user_ids": userID,
+		"status":   AlertOpen,
+		"held":     true,
+	})
+	return count > 0, err
+}
+
+// AnalyzeGame looks for collusion and answer leaks in a finished game's
+// transcript. Only the last bet each player sent on a question counts.
+func AnalyzeGame(record *QuizGameRecord, cfg config.QuizConfig) []QuizAlert {
+	var alerts []QuizAlert
+	alert := func(kind string, users, questions []string, detail string) {
+		sort.Strings(users)
+		alerts = append(alerts, QuizAlert{
+			GameID:      record.GameID,
+			Kind:        kind,
+			UserIDs:     users,
+			QuestionIDs: questions,
+			Detail:      detail,
+			Status:      AlertOpen,
+			CreatedAt:   time.Now(),
+		})
+	}
+
+	// Accounts that bet identically: count how often each pair matches, then
+	// group the pairs that matched often enough
+	pairs := make(map[[2]string][]string)
+	late := make(map[string][]string)
+	for _, q := range record.Questions {
+		if q.VoidReason != "" {
+			continue
+		}
+		question := q.asQuestion()
+		byVector := make(map[string][]string)
+		for userID, bet := range finalBets(q.Bets) {
+			if bet.Total() <= 0 {
+				continue
+			}
+			byVector[betVector(bet)] = append(byVector[betVector(bet)], userID)
+
+			// Mostly on the right answer, just before it closed
+			correct, _ := question.Grade(bet)
+			if !q.ClosedAt.IsZero() && q.ClosedAt.Sub(bet.Timestamp) <= cfg.FlagLateWindow && correct*2 > bet.Total() {
+				late[userID] = append(late[userID], q.QuestionID)
+			}
+		}
+		for _, users := range byVector {
+			if len(users) < cfg.FlagIdenticalAccounts {
+				continue
+			}
+			sort.Strings(users)
+			for i := range users {
+				for j := i + 1; j < len(users); j++ {
+					pair := [2]string{users[i], users[j]}
+					pairs[pair] = append(pairs[pair], q.QuestionID)
+				}
+			}
+		}
+	}
+
+	groups := newUnionFind()
+	questions := make(map[string]map[string]bool)
+	for pair, matched := range pairs {
+		if len(matched) < cfg.FlagIdenticalQuestions {
+			continue
+		}
+		groups.union(pair[0], pair[1])
+		root := groups.find(pair[0])
+		if questions[root] == nil {
+			questions[root] = make(map[string]bool)
+		}
+		for _, id := range matched {
+			questions[root][id] = true
+		}
+	}
+	for _, users := range groups.sets() {
+		if len(users) < cfg.FlagIdenticalAccounts {
+			continue
+		}
+		matched := make(map[string]bool)
+		for _, user := range users {
+			for id := range questions[user] {
+				matched[id] = true
+			}
+		}
+		ids := sortedKeys(matched)
+		alert(AlertIdenticalBets, users, ids,
+			fmt.Sprintf("%d accounts placed identical bets on %d questions", len(users), len(ids)))
+	}
+
+	for userID, ids := range late {
+		if len(ids) >= cfg.FlagLateCount {
+			alert(AlertLateBets, []string{userID}, ids,
+				fmt.Sprintf("%d correct bets within %s of the question closing", len(ids), cfg.FlagLateWindow))
+		}
+	}
+
+	// Accounts sharing an address or a device
+	byIP := make(map[string]map[string]bool)
+	byDevice := make(map[string]map[string]bool)
+	for _, player := range record.Players {
+		if player.IP != "" {
+			if byIP[player.IP] == nil {
+				byIP[player.IP] = make(map[string]bool)
+			}
+			byIP[player.IP][player.UserID] = true
+		}
+		if player.DeviceID != "" {
+			if byDevice[player.DeviceID] == nil {
+				byDevice[player.DeviceID] = make(map[string]bool)
+			}
+			byDevice[player.DeviceID][player.UserID] = true
+		}
+	}
+	// A classroom or campus behind one NAT shares an address, so only a crowd
+	// counts; a shared device is flagged from two accounts
+	for ip, users := range byIP {
+		if len(users) >= cfg.FlagSharedIPMin {
+			alert(AlertSharedIP, sortedKeys(users), nil, fmt.Sprintf("%d accounts connected from %s", len(users), ip))
+		}
+	}
+	for _, users := range byDevice {
+		if len(users) > 1 {
+			alert(AlertSharedDevice, sortedKeys(users), nil, fmt.Sprintf("%d accounts played from the same device", len(users)))
+		}
+	}
+
+	// Stable order for the admin list
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if alerts[i].Kind != alerts[j].Kind {
+			return alerts[i].Kind < alerts[j].Kind
+		}
+		return strings.Join(alerts[i].UserIDs, ",") < strings.Join(alerts[j].UserIDs, ",")
+	})
+	return alerts
+}
+
+// asQuestion rebuilds the question's answer key for grading
+func (q *QuizQuestionRecord) asQuestion() *Question {
+	return &Question{
+		ID:             q.QuestionID,
+		Type:           q.Type,
+		Options:        q.Options,
+		CorrectIndex:   q.CorrectIndex,
+		CorrectIndices: q.CorrectIndices,
+		Numeric:        q.Numeric,
+		Answer:         q.Answer,
+		Region:         q.Region,
+	}
+}
+
+// finalBets is each player's last bet on a question, without cancelled ones
+func finalBets(bets []BetSubmission) map[string]*BetSubmission {
+	final := make(map[string]*BetSubmission)
+	for i := range bets {
+		if bets[i].Cancelled {
+			delete(final, bets[i].PlayerID)
+			continue
+		}
+		final[bets[i].PlayerID] = &bets[i]
+	}
+	return final
+}
+
+// betVector is a bet's stakes and answer as a comparable key
+func betVector(bet *BetSubmission) string {
+	var b strings.Builder
+	for _, amount := range bet.Bets {
+		fmt.Fprintf(&b, "%d,", ToUnits(amount))
+	}
+	if bet.Value != nil {
+		fmt.Fprintf(&b, "v%g", *bet.Value)
+	}
+	if bet.Point != nil {
+		fmt.Fprintf(&b, "p%g:%g", bet.Point.X, bet.Point.Y)
+	}
+	return b.String()
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unionFind groups accounts linked by matching bets
+type unionFind map[string]string
+
+func newUnionFind() unionFind {
+	return make(unionFind)
+}
+
+func (u unionFind) find(x string) string {
+	if _, ok := u[x]; !ok {
+		u[x] = x
+	}
+	for u[x] != x {
+		u[x] = u[u[x]]
+		x = u[x]
+	}
+	return x
+}
+
+func (u unionFind) union(a, b string) {
+	u[u.find(a)] = u.find(b)
+}
+
+// sets lists every group with its members sorted
+func (u unionFind) sets() [][]string {
+	byRoot := make(map[string][]string)
+	for x := range u {
+		root := u.find(x)
+		byRoot[root] = append(byRoot[root], x)
+	}
+	sets := make([][]string, 0, len(byRoot))
+	for _, members := range byRoot {
+		sort.Strings(members)
+		sets = append(sets, members)
+	}
+	return sets
+}
+
+// screenGame runs the integrity screen once the game's transcript is written,
+// then pays out unsettled, holding the payouts of flagged players when
+// quiz.hold_flagged_payouts is set. If the screen fails everyone is paid.
+func (h *QuizHub) screenGame(unsettled []*QuizPlayer) {
+	ctx := context.Background()
+	flagged := make(map[string]bool)
+
+	record, err := h.Store.Game(ctx, h.GameState.GameID)
+	if err != nil {
+		log.Printf("Quiz %s: integrity screen failed to load the game: %v\n", h.GameState.GameID, err)
+	} else {
+		alerts := AnalyzeGame(record, h.Config)
+		for i := range alerts {
+			alerts[i].Held = h.Config.HoldFlaggedPayouts
+			for _, userID := range alerts[i].UserIDs {
+				flagged[userID] = true
+			}
+		}
+		if err := h.Alerts.Insert(ctx, alerts); err != nil {
+			log.Printf("Quiz %s: failed to store integrity alerts: %v\n", h.GameState.GameID, err)
+			flagged = make(map[string]bool)
+		} else if len(alerts) > 0 {
+			log.Printf("Quiz %s: integrity screen raised %d alerts\n", h.GameState.GameID, len(alerts))
+		}
+	}
+
+	for _, player := range unsettled {
+		if flagged[player.UserID] && h.Config.HoldFlaggedPayouts {
+			h.holdPlayer(ctx, player)
+		} else {
+			h.settlePlayer(ctx, player, 0)
+		}
+	}
+}
+
+// holdPlayer records a flagged player's payout without crediting it
+func (h *QuizHub) holdPlayer(ctx context.Context, player *QuizPlayer) {
+	if h.Ledger == nil || player.LedgerEntry.IsZero() {
+		return
+	}
+
+	player.Mu.RLock()
+	payout := player.Tokens
+	player.Mu.RUnlock()
+
+	if err := h.Ledger.Hold(ctx, player.LedgerEntry, payout); err != nil {
+		log.Printf("Quiz ledger: failed to hold %s (%.2f tokens): %v\n", player.UserID, payout, err)
+		return
+	}
+	log.Printf("Quiz ledger: held %s's payout of %.2f tokens for review\n", player.UserID, payout)
+
+	h.Mu.RLock()
+	if player.Connected {
+		select {
+		case player.Send <- map[string]interface{}{
+			"type":    "payout_held",
+			"payout":  payout,
+			"message": "Your payout is being reviewed and will be credited once it is cleared",
+		}:
+		default:
+		}
+	}
+	h.Mu.RUnlock()
+}
+
+// clientIP is the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// deviceID is the identifier the client keeps for its device, if it sent one
+func deviceID(r *http.Request) string {
+	id := strings.TrimSpace(r.URL.Query().Get("device"))
+	if len(id) > 128 {
+		id = id[:128]
+	}
+	return id
+}
@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dilyxs/medMarket/config"
+)
+
+// TestSharedIP checks a classroom behind one NAT isn't flagged, while a crowd
+// of accounts on one address or two on one device is
+func TestSharedIP(t *testing.T) {
+	cfg := config.Default().Quiz
+
+	players := func(n int, ip, device string) []QuizGamePlayer {
+		list := make([]QuizGamePlayer, n)
+		for i := range list {
+			list[i] = QuizGamePlayer{UserID: fmt.Sprintf("%s-%d", ip, i), IP: ip, DeviceID: device}
+		}
+		return list
+	}
+	kinds := func(alerts []QuizAlert) map[string]int {
+		counts := make(map[string]int)
+		for _, alert := range alerts {
+			counts[alert.Kind]++
+		}
+		return counts
+	}
+
+	classroom := &QuizGameRecord{GameID: "classroom", Players: players(6, "10.0.0.1", "")}
+	if got := kinds(AnalyzeGame(classroom, cfg)); len(got) != 0 {
+		t.Errorf("6 accounts behind one NAT raised %v, want no alerts", got)
+	}
+
+	crowd := &QuizGameRecord{GameID: "crowd", Players: players(cfg.FlagSharedIPMin, "10.0.0.2", "")}
+	if got := kinds(AnalyzeGame(crowd, cfg)); got[AlertSharedIP] != 1 {
+		t.Errorf("%d accounts on one address raised %v, want one %s alert", cfg.FlagSharedIPMin, got, AlertSharedIP)
+	}
+
+	device := &QuizGameRecord{GameID: "device", Players: players(2, "10.0.0.3", "tablet")}
+	if got := kinds(AnalyzeGame(device, cfg)); got[AlertSharedDevice] != 1 || got[AlertSharedIP] != 0 {
+		t.Errorf("2 accounts on one device raised %v, want only a %s alert", got, AlertSharedDevice)
+	}
+}
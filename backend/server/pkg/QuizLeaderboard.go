@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Leaderboard periods
+const (
+	LeaderboardAllTime = "all"
+	LeaderboardWeekly  = "week" // since Monday 00:00 UTC
+)
+
+// Leaderboard rankings
+const (
+	RankByNet      = "net"       // net tokens won
+	RankByWins     = "wins"      // games won
+	RankByAccuracy = "accuracy"  // share of questions answered correctly
+	RankByStake    = "avg_stake" // average stake on the correct option
+)
+
+// LeaderboardEntry is one player's record over a period
+type LeaderboardEntry struct {
+	Rank            int     `json:"rank"`
+	UserID          string  `json:"user_id"`
+	Username        string  `json:"username"`
+	Games           int     `json:"games"`
+	Wins            int     `json:"wins"`
+	NetTokens       float64 `json:"net_tokens"`
+	Answered        int     `json:"answered"`
+	Correct         int     `json:"correct"`
+	Accuracy        float64 `json:"accuracy"`
+	AvgCorrectStake float64 `json:"avg_correct_stake"`
+}
+
+// LeaderboardSince returns when period starts, or the zero time for all time
+func LeaderboardSince(period string, now time.Time) (time.Time, error) {
+	switch period {
+	case LeaderboardAllTime:
+		return time.Time{}, nil
+	case LeaderboardWeekly:
+		now = now.UTC()
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		return time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, invalid(fmt.Errorf("period must be %s or %s", LeaderboardAllTime, LeaderboardWeekly))
+}
+
+// Leaderboard ranks every player of the games that ended since the given time
+// (all of them for the zero time). Ties are broken by net tokens, then user ID.
+func (s *QuizGameStore) Leaderboard(ctx context.Context, since time.Time, rankBy string) ([]LeaderboardEntry, error) {
+	var metric func(e *LeaderboardEntry) float64
+	switch rankBy {
+	case RankByNet:
+		metric = func(e *LeaderboardEntry) float64 { return e.NetTokens }
+	case RankByWins:
+		metric = func(e *LeaderboardEntry) float64 { return float64(e.Wins) }
+	case RankByAccuracy:
+		metric = func(e *LeaderboardEntry) float64 { return e.Accuracy }
+	case RankByStake:
+		metric = func(e *LeaderboardEntry) float64 { return e.AvgCorrectStake }
+	default:
+		return nil, invalid(fmt.Errorf("sort must be one of %s, %s, %s or %s", RankByNet, RankByWins, RankByAccuracy, RankByStake))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	match := bson.M{"status": QuizPhaseEnded}
+	if !since.IsZero() {
+		match["ended_at"] = bson.M{"$gte": since}
+	}
+
+	// Net tokens and wins. A player the host kicked can appear twice in one
+	// game, so fold each game down to one row per player first.
+	var players []struct {
+		UserID   string  `bson:"_id"`
+		Username string  `bson:"username"`
+		Games    int     `bson:"games"`
+		Wins     int     `bson:"wins"`
+		Net      float64 `bson:"net"`
+	}
+	cursor, err := s.Games.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$unwind": "$players"},
+		bson.M{"$group": bson.M{
+			"_id":      bson.M{"game": "$_id", "user": "$players.user_id"},
+			"username": bson.M{"$last": "$players.username"},
+			"net":      bson.M{"$sum": bson.M{"$subtract": bson.A{"$players.payout", "$players.buy_in"}}},
+			"won":      bson.M{"$first": bson.M{"$eq": bson.A{"$winner_id", "$players.user_id"}}},
+			"ended_at": bson.M{"$first": "$ended_at"},
+		}},
+		bson.M{"$sort": bson.M{"ended_at": 1}},
+		bson.M{"$group": bson.M{
+			"_id":      "$_id.user",
+			"username": bson.M{"$last": "$username"},
+			"games":    bson.M{"$sum": 1},
+			"wins":     bson.M{"$sum": bson.M{"$cond": bson.A{"$won", 1, 0}}},
+			"net":      bson.M{"$sum": "$net"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &players); err != nil {
+		return nil, err
+	}
+
+	// Accuracy and stake from every scored question; voided ones have no results
+	var answers []struct {
+		UserID       string  `bson:"_id"`
+		Answered     int     `bson:"answered"`
+		Correct      int     `bson:"correct"`
+		CorrectStake float64 `bson:"correct_stake"`
+	}
+	cursor, err = s.Games.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$unwind": "$questions"},
+		bson.M{"$match": bson.M{"questions.results": bson.M{"$type": "object"}}},
+		bson.M{"$project": bson.M{
+			"correct_index": "$questions.correct_index",
+			"results":       bson.M{"$objectToArray": "$questions.results.player_results"},
+		}},
+		bson.M{"$unwind": "$results"},
+		bson.M{"$group": bson.M{
+			"_id":      "$results.k",
+			"answered": bson.M{"$sum": 1},
+			"correct":  bson.M{"$sum": bson.M{"$cond": bson.A{"$results.v.won", 1, 0}}},
+			// Older records only have the stake on correct_index
+			"correct_stake": bson.M{"$sum": bson.M{"$cond": bson.A{
+				"$results.v.won",
+				bson.M{"$ifNull": bson.A{
+					"$results.v.correct_stake",
+					bson.M{"$arrayElemAt": bson.A{"$results.v.bets", "$correct_index"}},
+					0,
+				}},
+				0,
+			}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(players))
+	index := make(map[string]int, len(players))
+	for _, p := range players {
+		index[p.UserID] = len(entries)
+		entries = append(entries, LeaderboardEntry{
+			UserID:    p.UserID,
+			Username:  p.Username,
+			Games:     p.Games,
+			Wins:      p.Wins,
+			NetTokens: ToUnits(p.Net).Tokens(),
+		})
+	}
+	for _, a := range answers {
+		i, ok := index[a.UserID]
+		if !ok {
+			continue
+		}
+		entry := &entries[i]
+		entry.Answered = a.Answered
+		entry.Correct = a.Correct
+		if a.Answered > 0 {
+			entry.Accuracy = float64(a.Correct) / float64(a.Answered)
+		}
+		if a.Correct > 0 {
+			entry.AvgCorrectStake = ToUnits(a.CorrectStake / float64(a.Correct)).Tokens()
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if metric(a) != metric(b) {
+			return metric(a) > metric(b)
+		}
+		if a.NetTokens != b.NetTokens {
+			return a.NetTokens > b.NetTokens
+		}
+		return a.UserID < b.UserID
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries, nil
+}
+
+// AfterWrites runs fn on its own goroutine once every write queued so far has
+// been made. It reports false, and fn never runs, if the store is closed.
+func (s *QuizGameStore) AfterWrites(fn func()) bool {
+	return s.enqueue(func(ctx context.Context) error {
+		go fn()
+		return nil
+	})
+}
@@ -0,0 +1,306 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example.com/m/backend/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ledger entry statuses. An entry is created "in_game" together with the
+// buy-in debit and moves to "settled" together with the payout credit, each in
+// a single transaction, so a crash leaves every entry in a known state. A
+// payout flagged by the integrity screen is "held" until an admin releases it
+// (settled) or forfeits it to the house.
+const (
+	LedgerInGame    = "in_game"
+	LedgerSettled   = "settled"
+	LedgerRefunded  = "refunded"
+	LedgerHeld      = "held"
+	LedgerForfeited = "forfeited"
+)
+
+// ErrInsufficientTokens is returned when a player can't cover the buy-in
+var ErrInsufficientTokens = errors.New("insufficient tokens for buy-in")
+
+// QuizLedgerEntry records one player's stake in one game
+type QuizLedgerEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	GameID    string             `bson:"game_id" json:"game_id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	BuyIn     float64            `bson:"buy_in" json:"buy_in"`
+	Payout    float64            `bson:"payout" json:"payout"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	SettledAt time.Time          `bson:"settled_at,omitempty" json:"settled_at,omitempty"`
+	HeldAt    time.Time          `bson:"held_at,omitempty" json:"held_at,omitempty"`
+}
+
+// QuizLedger moves quiz tokens between users' MongoDB balances and the games
+// they play in
+type QuizLedger struct {
+	Users   *mongo.Collection
+	Entries *mongo.Collection
+	Games   *mongo.Collection // game records, read by Reconcile for the payouts they hold
+	Timeout time.Duration
+}
+
+// NewQuizLedger creates a ledger stored in the quiz_ledger collection next to users
+func NewQuizLedger(users *mongo.Collection, timeout time.Duration) *QuizLedger {
+	return &QuizLedger{
+		Users:   users,
+		Entries: users.Database().Collection("quiz_ledger"),
+		Games:   users.Database().Collection("quiz_games"),
+		Timeout: timeout,
+	}
+}
+
+func (l *QuizLedger) transaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	session, err := l.Users.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// BuyIn debits amount from the user's tokens and opens a ledger entry for the
+// game. It returns the entry ID used to settle the stake later.
+func (l *QuizLedger) BuyIn(ctx context.Context, gameID, userID string, amount float64) (primitive.ObjectID, error) {
+	entry := QuizLedgerEntry{
+		ID:        primitive.NewObjectID(),
+		GameID:    gameID,
+		UserID:    userID,
+		BuyIn:     amount,
+		Status:    LedgerInGame,
+		CreatedAt: time.Now(),
+	}
+
+	err := l.transaction(ctx, func(sc mongo.SessionContext) error {
+		balance, err := user.GetTokens(sc, l.Users, userID)
+		if err != nil {
+			return fmt.Errorf("failed to read token balance: %w", err)
+		}
+		if balance < amount {
+			return ErrInsufficientTokens
+		}
+		if err := user.SubtractTokens(sc, l.Users, userID, amount); err != nil {
+			return err
+		}
+		_, err = l.Entries.InsertOne(sc, entry)
+		return err
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	log.Printf("Quiz ledger: %s bought into %s for %.2f tokens\n", userID, gameID, amount)
+	return entry.ID, nil
+}
+
+// Settle credits payout back to the user and closes the entry. Settling an
+// entry that is no longer in_game is a no-op, so retries never double-credit.
+func (l *QuizLedger) Settle(ctx context.Context, entryID primitive.ObjectID, payout float64) error {
+	return l.close(ctx, entryID, payout, LedgerSettled)
+}
+
+// Refund returns the buy-in for a player who never made it into the game
+func (l *QuizLedger) Refund(ctx context.Context, entryID primitive.ObjectID, amount float64) error {
+	return l.close(ctx, entryID, amount, LedgerRefunded)
+}
+
+// Hold closes the entry with its payout recorded but not credited, until an
+// admin releases or forfeits it. Like Settle, it only moves in_game entries.
+func (l *QuizLedger) Hold(ctx context.Context, entryID primitive.ObjectID, payout float64) error {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	_, err := l.Entries.UpdateOne(ctx,
+		bson.M{"_id": entryID, "status": LedgerInGame},
+		bson.M{"$set": bson.M{
+			"status":  LedgerHeld,
+			"payout":  payout,
+			"held_at": time.Now(),
+		}},
+	)
+	return err
+}
+
+// Release credits a held payout of userID in gameID and settles the entry. It
+// returns the amount paid, 0 if nothing was held.
+func (l *QuizLedger) Release(ctx context.Context, gameID, userID string) (float64, error) {
+	var paid float64
+	err := l.transaction(ctx, func(sc mongo.SessionContext) error {
+		var entry QuizLedgerEntry
+		err := l.Entries.FindOneAndUpdate(sc,
+			bson.M{"game_id": gameID, "user_id": userID, "status": LedgerHeld},
+			bson.M{"$set": bson.M{"status": LedgerSettled, "settled_at": time.Now()}},
+		).Decode(&entry)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		paid = entry.Payout
+		if paid == 0 {
+			return nil
+		}
+		return user.AddTokens(sc, l.Users, entry.UserID, paid)
+	})
+	return paid, err
+}
+
+// Forfeit closes a held payout of userID in gameID without crediting it. It
+// returns the amount kept by the house, 0 if nothing was held.
+func (l *QuizLedger) Forfeit(ctx context.Context, gameID, userID string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	var entry QuizLedgerEntry
+	err := l.Entries.FindOneAndUpdate(ctx,
+		bson.M{"game_id": gameID, "user_id": userID, "status": LedgerHeld},
+		bson.M{"$set": bson.M{"status": LedgerForfeited, "settled_at": time.Now()}},
+	).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return entry.Payout, nil
+}
+
+// Held lists the payouts waiting for review, optionally for one game
+func (l *QuizLedger) Held(ctx context.Context, gameID string) ([]QuizLedgerEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	filter := bson.M{"status": LedgerHeld}
+	if gameID != "" {
+		filter["game_id"] = gameID
+	}
+	cursor, err := l.Entries.Find(ctx, filter, options.Find().SetSort(bson.M{"held_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]QuizLedgerEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (l *QuizLedger) close(ctx context.Context, entryID primitive.ObjectID, payout float64, status string) error {
+	return l.transaction(ctx, func(sc mongo.SessionContext) error {
+		var entry QuizLedgerEntry
+		err := l.Entries.FindOneAndUpdate(sc,
+			bson.M{"_id": entryID, "status": LedgerInGame},
+			bson.M{"$set": bson.M{
+				"status":     status,
+				"payout":     payout,
+				"settled_at": time.Now(),
+			}},
+		).Decode(&entry)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if payout == 0 {
+			return nil
+		}
+		return user.AddTokens(sc, l.Users, entry.UserID, payout)
+	})
+}
+
+// Reconcile closes every entry left in_game by a previous process. A game
+// recorded as ended stopped between finishing and paying out, so its entries
+// are settled with the payouts in its record; entries of aborted, unfinished
+// or unrecorded games are refunded. It must run before any game of this
+// process takes buy-ins.
+func (l *QuizLedger) Reconcile(ctx context.Context) (settled, refunded int, err error) {
+	findCtx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	cursor, err := l.Entries.Find(findCtx, bson.M{"status": LedgerInGame})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var entries []QuizLedgerEntry
+	if err := cursor.All(findCtx, &entries); err != nil {
+		return 0, 0, err
+	}
+
+	games := make(map[string]*QuizGameRecord)
+	for _, entry := range entries {
+		record, ok := games[entry.GameID]
+		if !ok {
+			record, err = l.gameRecord(ctx, entry.GameID)
+			if err != nil {
+				log.Printf("Quiz ledger: failed to load %s to reconcile %s: %v\n", entry.GameID, entry.UserID, err)
+				continue
+			}
+			games[entry.GameID] = record
+		}
+
+		amount, status := reconciledPayout(entry, record)
+		if err := l.close(ctx, entry.ID, amount, status); err != nil {
+			log.Printf("Quiz ledger: failed to reconcile %s in %s: %v\n", entry.UserID, entry.GameID, err)
+			continue
+		}
+		if status == LedgerSettled {
+			settled++
+		} else {
+			refunded++
+		}
+	}
+	return settled, refunded, nil
+}
+
+// gameRecord loads a game's status and players, nil if it was never recorded
+func (l *QuizLedger) gameRecord(ctx context.Context, gameID string) (*QuizGameRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	var record QuizGameRecord
+	err := l.Games.FindOne(ctx, bson.M{"_id": gameID},
+		options.FindOne().SetProjection(bson.M{"status": 1, "players": 1}),
+	).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// reconciledPayout is what an entry left in_game is closed with: the payout
+// recorded for the player when their game ended, otherwise their buy-in back
+func reconciledPayout(entry QuizLedgerEntry, record *QuizGameRecord) (float64, string) {
+	if record != nil && record.Status == QuizPhaseEnded {
+		for _, player := range record.Players {
+			if player.UserID == entry.UserID {
+				return player.Payout, LedgerSettled
+			}
+		}
+	}
+	return entry.BuyIn, LedgerRefunded
+}
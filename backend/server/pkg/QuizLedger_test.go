@@ -0,0 +1,34 @@
+package pkg
+
+import "testing"
+
+// TestReconciledPayout checks an entry left in_game by a game that ended is
+// settled with its recorded payout, and only interrupted games are refunded
+func TestReconciledPayout(t *testing.T) {
+	entry := QuizLedgerEntry{GameID: "game-1", UserID: "winner", BuyIn: 50, Status: LedgerInGame}
+	players := []QuizGamePlayer{
+		{UserID: "winner", BuyIn: 50, Payout: 180},
+		{UserID: "loser", BuyIn: 50, Payout: 0, Eliminated: true},
+	}
+
+	tests := []struct {
+		name   string
+		record *QuizGameRecord
+		payout float64
+		status string
+	}{
+		{"finished but unsettled", &QuizGameRecord{Status: QuizPhaseEnded, Players: players}, 180, LedgerSettled},
+		{"aborted", &QuizGameRecord{Status: QuizRecordAborted, Players: players}, 50, LedgerRefunded},
+		{"still running", &QuizGameRecord{Status: QuizPhaseRunning, Players: players}, 50, LedgerRefunded},
+		{"not in the record", &QuizGameRecord{Status: QuizPhaseEnded, Players: players[1:]}, 50, LedgerRefunded},
+		{"never recorded", nil, 50, LedgerRefunded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payout, status := reconciledPayout(entry, tt.record)
+			if payout != tt.payout || status != tt.status {
+				t.Errorf("reconciled with %.2f (%s), want %.2f (%s)", payout, status, tt.payout, tt.status)
+			}
+		})
+	}
+}
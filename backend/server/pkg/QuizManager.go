@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dilyxs/medMarket/config"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrGameNotFound = errors.New("quiz game not found")
+	ErrTooManyGames = errors.New("too many quiz games are open")
+)
+
+// GameArchivedReason is sent in the close frame when a finished game is closed
+const GameArchivedReason = "quiz game archived"
+
+// QuizGameInfo is the public summary of a game used by the lobby listing
+type QuizGameInfo struct {
+	GameID     string    `json:"game_id"`
+	HostID     string    `json:"host_id"`
+	Phase      string    `json:"phase"`
+	Rules      QuizRules `json:"rules"`
+	Players    int       `json:"players"`
+	Remaining  int       `json:"remaining_players"`
+	Spectators int       `json:"spectators"`
+	Jackpot    float64   `json:"jackpot"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	EndedAt    time.Time `json:"ended_at,omitempty"`
+}
+
+// Info summarises the game for listings
+func (h *QuizHub) Info() QuizGameInfo {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	remaining := 0
+	for _, player := range h.Players {
+		player.Mu.RLock()
+		if player.IsActive {
+			remaining++
+		}
+		player.Mu.RUnlock()
+	}
+
+	return QuizGameInfo{
+		GameID:     h.GameState.GameID,
+		HostID:     h.GameState.HostID,
+		Phase:      h.GameState.Phase,
+		Rules:      h.GameState.Rules,
+		Players:    len(h.Players),
+		Remaining:  remaining,
+		Spectators: len(h.Spectators),
+		Jackpot:    h.GameState.Jackpot,
+		CreatedAt:  h.GameState.CreatedAt,
+		StartedAt:  h.GameState.StartedAt,
+		EndedAt:    h.GameState.EndedAt,
+	}
+}
+
+// QuizManager runs any number of quiz games side by side. Each game is its own
+// QuizHub with its own goroutine; finished games are archived and closed.
+type QuizManager struct {
+	Games    map[string]*QuizHub
+	Archived []QuizGameInfo // most recent last
+	Ledger   *QuizLedger
+	Store    *QuizGameStore
+	Alerts   *QuizAlertStore
+	Frames   FrameSource // set before games are created
+	Mu       sync.RWMutex
+
+	usersCollection *mongo.Collection
+	config          config.QuizConfig
+	sockets         config.SocketConfig
+	ctx             context.Context
+	cancels         map[string]context.CancelCauseFunc
+	wg              sync.WaitGroup
+}
+
+// NewQuizManager creates a manager whose games stop when ctx is cancelled
+func NewQuizManager(ctx context.Context, usersCollection *mongo.Collection, cfg config.QuizConfig, sockets config.SocketConfig) *QuizManager {
+	var ledger *QuizLedger
+	var store *QuizGameStore
+	var alerts *QuizAlertStore
+	if usersCollection != nil {
+		ledger = NewQuizLedger(usersCollection, cfg.LedgerTimeout)
+		db := usersCollection.Database()
+		store = NewQuizGameStore(db.Collection("quiz_games"), db.Collection("quiz_frames"), cfg.LedgerTimeout, cfg.HistoryBuffer)
+		alerts = NewQuizAlertStore(db.Collection("quiz_alerts"), cfg.LedgerTimeout)
+	}
+
+	return &QuizManager{
+		Games:           make(map[string]*QuizHub),
+		Archived:        make([]QuizGameInfo, 0),
+		Ledger:          ledger,
+		Store:           store,
+		Alerts:          alerts,
+		usersCollection: usersCollection,
+		config:          cfg,
+		sockets:         sockets,
+		ctx:             ctx,
+		cancels:         make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// CreateGame opens a new lobby hosted by hostID and starts its hub. questions
+// pre-fill the queue and play back to back with gap between them once the host
+// starts the game; a zero gap uses the configured default. rules pick the
+// scoring mode, with an empty mode meaning the configured default.
+func (m *QuizManager) CreateGame(hostID string, questions []*Question, gap time.Duration, rules QuizRules) (*QuizHub, error) {
+	if err := rules.Normalize(m.config); err != nil {
+		return nil, err
+	}
+	scoring, err := NewScoringMode(rules, m.config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	if m.ctx.Err() != nil {
+		return nil, errors.New("server is shutting down")
+	}
+	if len(m.Games) >= m.config.MaxGames {
+		return nil, ErrTooManyGames
+	}
+
+	gameID := fmt.Sprintf("game-%d", time.Now().UnixNano())
+	hub := NewQuizHub(gameID, m.usersCollection, m.config, m.sockets)
+	hub.GameState.HostID = hostID
+	hub.GameState.QuestionQueue = append(hub.GameState.QuestionQueue, questions...)
+	hub.GameState.QuestionGap = gap
+	hub.GameState.Rules = rules
+	hub.Engine.Scoring = scoring
+	hub.Engine.MaxQuestions = rules.MaxQuestions
+	hub.OnEnded = m.gameEnded
+	hub.Store = m.Store
+	hub.Alerts = m.Alerts
+	hub.Frames = m.Frames
+	if m.Store != nil {
+		m.Store.RecordGame(hub.Info())
+	}
+
+	ctx, cancel := context.WithCancelCause(m.ctx)
+	m.Games[gameID] = hub
+	m.cancels[gameID] = cancel
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		hub.Start(ctx)
+	}()
+
+	log.Printf("Quiz %s opened by %s in %s mode with %d queued questions (%d open games)\n", gameID, hostID, rules.Mode, len(questions), len(m.Games))
+	return hub, nil
+}
+
+// Game returns an open game by ID
+func (m *QuizManager) Game(gameID string) (*QuizHub, error) {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+
+	hub, ok := m.Games[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	return hub, nil
+}
+
+// Latest returns the most recently created game that hasn't ended, for
+// clients that don't pick a game
+func (m *QuizManager) Latest() (*QuizHub, error) {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+
+	var latest *QuizHub
+	var latestInfo QuizGameInfo
+	for _, hub := range m.Games {
+		info := hub.Info()
+		if info.Phase == QuizPhaseEnded {
+			continue
+		}
+		if latest == nil || info.CreatedAt.After(latestInfo.CreatedAt) {
+			latest, latestInfo = hub, info
+		}
+	}
+	if latest == nil {
+		return nil, ErrGameNotFound
+	}
+	return latest, nil
+}
+
+// HostGame returns hostID's newest game that hasn't ended, opening a new lobby
+// if they have none
+func (m *QuizManager) HostGame(hostID string) (*QuizHub, error) {
+	for _, info := range m.List() {
+		if info.HostID == hostID && info.Phase != QuizPhaseEnded {
+			if hub, err := m.Game(info.GameID); err == nil {
+				return hub, nil
+			}
+		}
+	}
+	return m.CreateGame(hostID, nil, 0, DefaultRules(m.config))
+}
+
+// List returns every open game, newest first
+func (m *QuizManager) List() []QuizGameInfo {
+	m.Mu.RLock()
+	games := make([]QuizGameInfo, 0, len(m.Games))
+	for _, hub := range m.Games {
+		games = append(games, hub.Info())
+	}
+	m.Mu.RUnlock()
+
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].CreatedAt.After(games[j].CreatedAt)
+	})
+	return games
+}
+
+// Finished returns archived games, newest first
+func (m *QuizManager) Finished() []QuizGameInfo {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+
+	history := make([]QuizGameInfo, len(m.Archived))
+	for i, info := range m.Archived {
+		history[len(m.Archived)-1-i] = info
+	}
+	return history
+}
+
+// gameEnded schedules an ended game's archive and, once its history is
+// written, pushes the updated leaderboards
+func (m *QuizManager) gameEnded(hub *QuizHub) {
+	m.scheduleArchive(hub)
+	if m.Store != nil {
+		m.Store.AfterWrites(m.pushLeaderboards)
+	}
+}
+
+// scheduleArchive closes an ended game once players have had time to see the
+// final results
+func (m *QuizManager) scheduleArchive(hub *QuizHub) {
+	time.AfterFunc(m.config.ArchiveDelay, func() {
+		m.Archive(hub.CurrentGameID())
+	})
+}
+
+// pushLeaderboards sends the top all-time and weekly players by net tokens to
+// everyone in an open game
+func (m *QuizManager) pushLeaderboards() {
+	weekly, _ := LeaderboardSince(LeaderboardWeekly, time.Now())
+	boards := make(map[string][]LeaderboardEntry, 2)
+	for period, since := range map[string]time.Time{"all_time": {}, "weekly": weekly} {
+		entries, err := m.Store.Leaderboard(m.ctx, since, RankByNet)
+		if err != nil {
+			log.Printf("Failed to load quiz leaderboard: %v\n", err)
+			return
+		}
+		boards[period] = entries[:min(len(entries), m.config.LeaderboardSize)]
+	}
+
+	msg := map[string]interface{}{
+		"type":     "leaderboard",
+		"all_time": boards["all_time"],
+		"weekly":   boards["weekly"],
+	}
+	m.Mu.RLock()
+	for _, hub := range m.Games {
+		hub.broadcastToPlayers(msg)
+		hub.notifyBroadcaster(msg)
+	}
+	m.Mu.RUnlock()
+}
+
+// Archive removes a game from the open games, records its summary and closes
+// its connections
+func (m *QuizManager) Archive(gameID string) {
+	m.Mu.Lock()
+	hub, ok := m.Games[gameID]
+	if !ok {
+		m.Mu.Unlock()
+		return
+	}
+	cancel := m.cancels[gameID]
+	delete(m.Games, gameID)
+	delete(m.cancels, gameID)
+
+	m.Archived = append(m.Archived, hub.Info())
+	if over := len(m.Archived) - m.config.ArchiveSize; over > 0 {
+		m.Archived = m.Archived[over:]
+	}
+	m.Mu.Unlock()
+
+	cancel(errors.New(GameArchivedReason))
+	log.Printf("Quiz %s archived\n", gameID)
+}
+
+// Wait blocks until every game's hub has shut down and their history is written
+func (m *QuizManager) Wait() {
+	m.wg.Wait()
+	if m.Store != nil {
+		m.Store.Close()
+	}
+}
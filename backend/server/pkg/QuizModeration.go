@@ -0,0 +1,334 @@
+package pkg
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Host moderation commands, sent over /quiz-broadcaster
+const (
+	HostKickPlayer    = "kick_player"
+	HostVoidQuestion  = "void_question"
+	HostRemoveQueued  = "remove_queued"
+	HostReorderQueue  = "reorder_queue"
+	HostAdjustBalance = "adjust_balance"
+	HostEndGame       = "end_game"
+)
+
+// How end_game deals with the jackpot
+const (
+	JackpotRefund     = "refund"     // back to the players who lost it, in proportion
+	JackpotDistribute = "distribute" // split evenly between the players still in
+)
+
+// HostCommand is a control message from the host. Only the fields its Type
+// uses are set.
+type HostCommand struct {
+	Type        string
+	HostID      string
+	Admin       bool     // the host has the admin role
+	Seconds     int      // extend_question
+	PlayerID    string   // kick_player, adjust_balance
+	Ban         bool     // kick_player
+	Reason      string   // kick_player, void_question, adjust_balance
+	Amount      float64  // adjust_balance, negative to deduct
+	QuestionID  string   // remove_queued
+	QuestionIDs []string // reorder_queue, the whole queue in its new order
+	Jackpot     string   // end_game: refund or distribute
+}
+
+// handleHostCommand runs a host command on the hub loop and reports problems
+// back to the host
+func (h *QuizHub) handleHostCommand(cmd HostCommand) {
+	var problem string
+	switch cmd.Type {
+	case HostPauseQuestion, HostResumeQuestion, HostExtendQuestion, HostEndQuestion:
+		h.handleClockCommand(cmd)
+		return
+	case HostKickPlayer:
+		problem = h.kickPlayer(cmd)
+	case HostVoidQuestion:
+		problem = h.voidQuestion(cmd)
+	case HostRemoveQueued, HostReorderQueue:
+		problem = h.editQueue(cmd)
+	case HostAdjustBalance:
+		problem = h.adjustBalance(cmd)
+	case HostEndGame:
+		problem = h.endGameEarly(cmd)
+	case HostEndReview:
+		problem = h.endReview("")
+	default:
+		problem = "unknown command " + cmd.Type
+	}
+
+	if problem != "" {
+		h.notifyBroadcaster(map[string]interface{}{
+			"type":    "error",
+			"message": problem,
+		})
+		return
+	}
+	log.Printf("Quiz %s: host %s sent %s\n", h.CurrentGameID(), cmd.HostID, cmd.Type)
+}
+
+// closeVoided stops the open question without scoring it and refunds every
+// bet. Callers hold h.Mu and have checked that a question is open.
+func (h *QuizHub) closeVoided(reason string) *Question {
+	h.GameState.Timer.Stop()
+	refunds, err := h.Engine.Void()
+	if err != nil {
+		return nil
+	}
+	question := h.GameState.CurrentQuestion
+	h.GameState.CurrentQuestion = nil
+	h.Bets = make(map[string]*BetSubmission)
+	h.syncGame()
+
+	for playerID, refund := range refunds {
+		player := h.Players[playerID]
+		h.syncPlayer(player)
+		h.sendToPlayer(player, map[string]interface{}{
+			"type":        "bet_refunded",
+			"question_id": question.ID,
+			"refunded":    refund.Tokens(),
+			"new_balance": h.Engine.Players[playerID].Tokens.Tokens(),
+		})
+	}
+	if h.Store != nil {
+		h.Store.RecordVoid(h.GameState.GameID, question.ID, reason, time.Now())
+	}
+	return question
+}
+
+// kickPlayer removes a player, refunding their open bet and paying out their
+// stack. A kicked player may buy in again; a banned one may not.
+func (h *QuizHub) kickPlayer(cmd HostCommand) string {
+	h.Mu.Lock()
+	standing, _, err := h.Engine.Remove(cmd.PlayerID)
+	if err != nil {
+		h.Mu.Unlock()
+		return "player not found"
+	}
+	player := h.Players[cmd.PlayerID]
+	player.setStanding(standing)
+	delete(h.Players, cmd.PlayerID)
+	if _, ok := h.Engine.Bets[cmd.PlayerID]; !ok {
+		delete(h.Bets, cmd.PlayerID)
+	}
+
+	removed := "kicked"
+	if cmd.Ban {
+		removed = "banned"
+		h.Banned[player.UserID] = cmd.Reason
+	}
+
+	player.Mu.RLock()
+	h.Departed = append(h.Departed, QuizGamePlayer{
+		UserID:     player.UserID,
+		Username:   player.Username,
+		BuyIn:      h.Config.StartingTokens,
+		Payout:     player.Tokens,
+		Eliminated: true,
+		Removed:    removed,
+		JoinedAt:   player.JoinedAt,
+		IP:         player.IP,
+		DeviceID:   player.DeviceID,
+	})
+	player.Mu.RUnlock()
+
+	if player.Connected {
+		player.Connected = false
+		select {
+		case player.Send <- map[string]interface{}{
+			"type":    "kicked",
+			"banned":  cmd.Ban,
+			"reason":  cmd.Reason,
+			"message": "The host removed you from the quiz",
+		}:
+		default:
+		}
+		close(player.Send)
+	}
+	h.goSettle(player)
+	h.Mu.Unlock()
+
+	log.Printf("Quiz player %s %s by %s: %s\n", player.UserID, removed, cmd.HostID, cmd.Reason)
+
+	h.notifyBroadcaster(map[string]interface{}{
+		"type":      "player_removed",
+		"player_id": player.UserID,
+		"banned":    cmd.Ban,
+	})
+	return ""
+}
+
+// voidQuestion cancels the open question, refunds every bet and moves on
+// without eliminating anyone
+func (h *QuizHub) voidQuestion(cmd HostCommand) string {
+	h.Mu.Lock()
+	if !h.GameState.QuestionActive {
+		h.Mu.Unlock()
+		return "no question is open"
+	}
+	question := h.closeVoided(cmd.Reason)
+	remaining := h.Engine.Remaining()
+	h.Mu.Unlock()
+
+	voided := map[string]interface{}{
+		"type":        "question_voided",
+		"question_id": question.ID,
+		"reason":      cmd.Reason,
+	}
+	h.broadcastToPlayers(voided)
+	h.notifyBroadcaster(voided)
+
+	// Off the hub loop: it waits out the gap before the next question
+	go h.nextQuestion(remaining)
+	return ""
+}
+
+// editQueue removes one queued question or puts the whole queue in a new order
+func (h *QuizHub) editQueue(cmd HostCommand) string {
+	h.Mu.Lock()
+	queue := h.GameState.QuestionQueue
+	byID := make(map[string]*Question, len(queue))
+	for _, question := range queue {
+		byID[question.ID] = question
+	}
+
+	var updated []*Question
+	switch cmd.Type {
+	case HostRemoveQueued:
+		if byID[cmd.QuestionID] == nil {
+			h.Mu.Unlock()
+			return "question is not queued"
+		}
+		updated = make([]*Question, 0, len(queue)-1)
+		for _, question := range queue {
+			if question.ID != cmd.QuestionID {
+				updated = append(updated, question)
+			}
+		}
+
+	case HostReorderQueue:
+		if len(cmd.QuestionIDs) != len(queue) {
+			h.Mu.Unlock()
+			return "question_ids must list every queued question once"
+		}
+		updated = make([]*Question, 0, len(queue))
+		for _, id := range cmd.QuestionIDs {
+			question := byID[id]
+			if question == nil {
+				h.Mu.Unlock()
+				return "question_ids must list every queued question once"
+			}
+			delete(byID, id)
+			updated = append(updated, question)
+		}
+	}
+	h.GameState.QuestionQueue = updated
+	queued := make([]*Question, len(updated))
+	copy(queued, updated)
+	h.Mu.Unlock()
+
+	h.notifyBroadcaster(map[string]interface{}{
+		"type":   "queue_updated",
+		"queued": queued,
+	})
+	return ""
+}
+
+// adjustBalance credits or debits a player's in-game tokens. Every adjustment
+// needs a reason and is recorded on the game. Credits settle as real tokens,
+// so only admins may make them.
+func (h *QuizHub) adjustBalance(cmd HostCommand) string {
+	reason := strings.TrimSpace(cmd.Reason)
+	if reason == "" {
+		return "a reason is required"
+	}
+	amount := ToUnits(cmd.Amount)
+	if amount == 0 {
+		return "amount must not be zero"
+	}
+	if amount > 0 && !cmd.Admin {
+		return "crediting tokens requires the admin role"
+	}
+
+	h.Mu.Lock()
+	balance, err := h.Engine.Adjust(cmd.PlayerID, amount)
+	if err != nil {
+		h.Mu.Unlock()
+		return err.Error()
+	}
+	player := h.Players[cmd.PlayerID]
+	h.syncPlayer(player)
+
+	adjustment := QuizAdjustment{
+		PlayerID:   player.UserID,
+		HostID:     cmd.HostID,
+		Amount:     amount.Tokens(),
+		Reason:     reason,
+		NewBalance: balance.Tokens(),
+		At:         time.Now(),
+	}
+	if h.Store != nil {
+		h.Store.RecordAdjustment(h.GameState.GameID, adjustment)
+	}
+	h.sendToPlayer(player, map[string]interface{}{
+		"type":        "balance_adjusted",
+		"amount":      adjustment.Amount,
+		"reason":      reason,
+		"new_balance": adjustment.NewBalance,
+	})
+	h.Mu.Unlock()
+
+	log.Printf("Quiz player %s balance adjusted by %.2f by %s: %s\n", player.UserID, adjustment.Amount, cmd.HostID, reason)
+	h.notifyBroadcaster(map[string]interface{}{
+		"type":       "balance_adjusted",
+		"adjustment": adjustment,
+	})
+	return ""
+}
+
+// endGameEarly stops the game, voiding any open question. The jackpot is
+// either refunded to the players who lost it or split between the players
+// still in; shares owed to players who already left go to the house.
+func (h *QuizHub) endGameEarly(cmd HostCommand) string {
+	if cmd.Jackpot != JackpotRefund && cmd.Jackpot != JackpotDistribute {
+		return "jackpot must be refund or distribute"
+	}
+
+	h.Mu.Lock()
+	if h.GameState.Phase == QuizPhaseEnded {
+		h.Mu.Unlock()
+		return "game has already ended"
+	}
+	if h.GameState.QuestionActive {
+		h.closeVoided("game ended by host")
+	}
+	h.clearReview()
+
+	jackpot := h.Engine.Jackpot
+	released, house := h.Engine.ReleaseJackpot(cmd.Jackpot == JackpotDistribute)
+	h.syncGame()
+	h.syncPlayers()
+	h.Mu.Unlock()
+
+	payouts := make(map[string]float64, len(released))
+	for playerID, amount := range released {
+		payouts[playerID] = amount.Tokens()
+	}
+
+	log.Printf("Quiz %s ended early by %s (jackpot %s: %.2f paid, %.2f to the house)\n",
+		h.CurrentGameID(), cmd.HostID, cmd.Jackpot, (jackpot - house).Tokens(), house.Tokens())
+
+	h.finishGame("", house.Tokens(), map[string]interface{}{
+		"type":          "game_ended",
+		"reason":        "ended_by_host",
+		"jackpot":       cmd.Jackpot,
+		"payouts":       payouts,
+		"house_jackpot": house.Tokens(),
+	})
+	return ""
+}
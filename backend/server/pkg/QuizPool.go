@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"time"
+)
+
+// PoolOption is the money on one option of the live question
+type PoolOption struct {
+	Index   int     `json:"index"`
+	Total   float64 `json:"total"`
+	Bettors int     `json:"bettors"`
+	Odds    float64 `json:"odds"` // implied payout per token staked, 0 while nobody backs it or when several answers can be right
+}
+
+// PoolUpdate is pushed while a question is open so players can see where the
+// tokens are going
+type PoolUpdate struct {
+	Type       string       `json:"type"` // "pool_update"
+	QuestionID string       `json:"question_id"`
+	Total      float64      `json:"total"`
+	Bettors    int          `json:"bettors"`
+	Options    []PoolOption `json:"options"`
+	ClosesAt   int64        `json:"closes_at"` // Unix timestamp in ms, moves if the host extends the question
+}
+
+// poolUpdate aggregates the current question's bets. Numeric and hotspot
+// questions have one pool. Callers hold h.Mu.
+func (h *QuizHub) poolUpdate() PoolUpdate {
+	question := h.GameState.CurrentQuestion
+	totals := make([]TokenUnits, question.BetSlots())
+	bettors := make([]int, question.BetSlots())
+	total := TokenUnits(0)
+	for _, bet := range h.Bets {
+		for i, amount := range bet.Bets {
+			stake := ToUnits(amount)
+			if i >= len(totals) || stake <= 0 {
+				continue
+			}
+			totals[i] += stake
+			bettors[i]++
+			total += stake
+		}
+	}
+
+	// Odds follow the parimutuel split, so only that mode pays the rake
+	rake := 0.0
+	if h.GameState.Rules.Mode == ScoringParimutuel {
+		rake = h.Config.HouseRake
+	}
+
+	update := PoolUpdate{
+		Type:       "pool_update",
+		QuestionID: question.ID,
+		Total:      total.Tokens(),
+		Bettors:    len(h.Bets),
+		Options:    make([]PoolOption, len(totals)),
+		ClosesAt:   h.GameState.Deadline.UnixMilli(),
+	}
+	for i, option := range totals {
+		odds := 0.0
+		if option > 0 && question.Kind() == QuestionChoice {
+			odds = (float64(option) + float64(total-option)*(1-rake)) / float64(option)
+		}
+		update.Options[i] = PoolOption{
+			Index:   i,
+			Total:   option.Tokens(),
+			Bettors: bettors[i],
+			Odds:    odds,
+		}
+	}
+	return update
+}
+
+// runPoolUpdates pushes the pool every PoolUpdateInterval until question
+// closes. The host always gets it; players only in the last PoolReveal of the
+// question, when set, so early bets don't just follow the crowd.
+func (h *QuizHub) runPoolUpdates(question *Question) {
+	if h.Config.PoolUpdateInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.Config.PoolUpdateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.Mu.RLock()
+		live := h.GameState.QuestionActive && h.GameState.CurrentQuestion == question
+		var update PoolUpdate
+		var left time.Duration
+		if live {
+			update = h.poolUpdate()
+			left = h.timeLeft()
+		}
+		h.Mu.RUnlock()
+
+		if !live {
+			return
+		}
+
+		h.notifyBroadcaster(update)
+		if h.Config.PoolReveal == 0 || left <= h.Config.PoolReveal {
+			h.broadcastToPlayers(update)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Question types. An empty Type is a single-choice question.
+const (
+	QuestionChoice      = "choice"       // one correct option
+	QuestionMultiSelect = "multi_select" // stakes on any of the correct options count
+	QuestionNumeric     = "numeric"      // an estimate, scored by how close it is
+	QuestionHotspot     = "hotspot"      // a click on an image, graded against a region
+)
+
+// NumericRange is what players see of a numeric question: the bounds their
+// estimate must fall in and how close it has to be to earn anything
+type NumericRange struct {
+	Min       float64 `json:"min" bson:"min"`
+	Max       float64 `json:"max" bson:"max"`
+	Unit      string  `json:"unit,omitempty" bson:"unit,omitempty"`
+	Tolerance float64 `json:"tolerance" bson:"tolerance"` // credit falls from full at the answer to none this far away
+}
+
+// Point is a hotspot click in image pixels
+type Point struct {
+	X float64 `json:"x" bson:"x"`
+	Y float64 `json:"y" bson:"y"`
+}
+
+// QuestionFormat is the type and answer key of a question beyond its options
+// and CorrectIndex, as banks and game records store it
+type QuestionFormat struct {
+	Type           string        `bson:"type,omitempty" json:"type,omitempty"`
+	CorrectIndices []int         `bson:"correct_indices,omitempty" json:"correct_indices,omitempty"` // multi_select
+	Numeric        *NumericRange `bson:"numeric,omitempty" json:"numeric,omitempty"`
+	Answer         float64       `bson:"answer,omitempty" json:"answer,omitempty"` // numeric
+	Region         *Region       `bson:"region,omitempty" json:"region,omitempty"` // hotspot, in image pixels
+}
+
+// Format returns the question's type and answer key
+func (q *Question) Format() QuestionFormat {
+	return QuestionFormat{
+		Type:           q.Type,
+		CorrectIndices: q.CorrectIndices,
+		Numeric:        q.Numeric,
+		Answer:         q.Answer,
+		Region:         q.Region,
+	}
+}
+
+// Kind is the question's type, with single choice for an empty Type
+func (q *Question) Kind() string {
+	if q.Type == "" {
+		return QuestionChoice
+	}
+	return q.Type
+}
+
+// BetSlots is how many stakes a bet on the question holds: one per option, or
+// a single stake for numeric and hotspot answers
+func (q *Question) BetSlots() int {
+	switch q.Kind() {
+	case QuestionNumeric, QuestionHotspot:
+		return 1
+	}
+	return len(q.Options)
+}
+
+// ForClient is the question as players see it, without the answer
+func (q *Question) ForClient(start, deadline time.Time) QuestionForClient {
+	options := q.Options
+	if options == nil {
+		options = []string{}
+	}
+	var frame *QuestionFrame
+	if q.Frame != nil {
+		frame = q.Frame.forPlayers(q)
+	}
+	return QuestionForClient{
+		ID:        q.ID,
+		Type:      q.Kind(),
+		Question:  q.Question,
+		Options:   options,
+		Numeric:   q.Numeric,
+		ImageURL:  q.ImageURL,
+		Frame:     frame,
+		TimeLimit: q.TimeLimit,
+		StartTime: start.UnixMilli(),
+		Deadline:  deadline.UnixMilli(),
+	}
+}
+
+// validateOptions checks the 2-4 text options of choice questions
+func (q *Question) validateOptions() error {
+	if len(q.Options) < 2 || len(q.Options) > 4 {
+		return errors.New("must have 2-4 options")
+	}
+	for _, option := range q.Options {
+		if strings.TrimSpace(option) == "" {
+			return errors.New("options must not be empty")
+		}
+	}
+	return nil
+}
+
+// validateFormat checks the options and answer key for the question's type
+func (q *Question) validateFormat() error {
+	switch q.Kind() {
+	case QuestionChoice:
+		if err := q.validateOptions(); err != nil {
+			return err
+		}
+		if q.CorrectIndex < 0 || q.CorrectIndex >= len(q.Options) {
+			return fmt.Errorf("correct_index must be between 0 and %d", len(q.Options)-1)
+		}
+
+	case QuestionMultiSelect:
+		if err := q.validateOptions(); err != nil {
+			return err
+		}
+		if len(q.CorrectIndices) == 0 {
+			return errors.New("correct_indices must name at least one option")
+		}
+		seen := make(map[int]bool, len(q.CorrectIndices))
+		for _, index := range q.CorrectIndices {
+			if index < 0 || index >= len(q.Options) {
+				return fmt.Errorf("correct_indices must be between 0 and %d", len(q.Options)-1)
+			}
+			if seen[index] {
+				return errors.New("correct_indices must not repeat an option")
+			}
+			seen[index] = true
+		}
+
+	case QuestionNumeric:
+		if len(q.Options) > 0 {
+			return errors.New("numeric questions have no options")
+		}
+		if q.Numeric == nil || q.Numeric.Min >= q.Numeric.Max {
+			return errors.New("numeric questions need a min below their max")
+		}
+		if q.Numeric.Tolerance <= 0 {
+			return errors.New("tolerance must be positive")
+		}
+		if q.Answer < q.Numeric.Min || q.Answer > q.Numeric.Max {
+			return errors.New("answer must be between min and max")
+		}
+
+	case QuestionHotspot:
+		if len(q.Options) > 0 {
+			return errors.New("hotspot questions have no options")
+		}
+		if strings.TrimSpace(q.ImageURL) == "" && q.Frame == nil {
+			return errors.New("hotspot questions need an image_url or a broadcast frame")
+		}
+		if q.Region == nil || len(q.Region.Polygon) < 3 {
+			return errors.New("hotspot questions need a region polygon with at least 3 points")
+		}
+		for _, vertex := range q.Region.Polygon {
+			if len(vertex) != 2 {
+				return errors.New("region polygon points must be [x, y] pairs")
+			}
+		}
+
+	default:
+		return fmt.Errorf("type must be %s, %s, %s or %s", QuestionChoice, QuestionMultiSelect, QuestionNumeric, QuestionHotspot)
+	}
+	return nil
+}
+
+// checkAnswer returns why a bet's answer doesn't fit the question, or "" if it
+// does. Answers the question's type doesn't use are dropped.
+func (q *Question) checkAnswer(bet *BetSubmission) string {
+	if len(bet.Bets) > q.BetSlots() {
+		if q.BetSlots() == 1 {
+			return q.Kind() + " questions take a single stake"
+		}
+		return "more bets than options"
+	}
+
+	switch q.Kind() {
+	case QuestionNumeric:
+		bet.Point = nil
+		if bet.Value == nil {
+			return "an estimate is required"
+		}
+		if *bet.Value < q.Numeric.Min || *bet.Value > q.Numeric.Max {
+			return fmt.Sprintf("estimate must be between %g and %g", q.Numeric.Min, q.Numeric.Max)
+		}
+	case QuestionHotspot:
+		bet.Value = nil
+		if bet.Point == nil {
+			return "a point on the image is required"
+		}
+	default:
+		bet.Value, bet.Point = nil, nil
+	}
+	return ""
+}
+
+// Credit is the share of a numeric or hotspot stake that counts as correct:
+// falling linearly to nothing at Tolerance away from a numeric answer, and all
+// or nothing for a click inside the hotspot region
+func (q *Question) Credit(bet *BetSubmission) float64 {
+	switch q.Kind() {
+	case QuestionNumeric:
+		if bet.Value == nil {
+			return 0
+		}
+		return max(0, 1-math.Abs(*bet.Value-q.Answer)/q.Numeric.Tolerance)
+	case QuestionHotspot:
+		if bet.Point == nil || !insidePolygon(*bet.Point, q.Region.Polygon) {
+			return 0
+		}
+		return 1
+	}
+	return 0
+}
+
+// Grade splits a bet into the stake on the correct answer and the rest. A
+// partly right numeric estimate keeps that share of its stake.
+func (q *Question) Grade(bet *BetSubmission) (correct, wrong TokenUnits) {
+	switch q.Kind() {
+	case QuestionNumeric, QuestionHotspot:
+		stake := bet.Total()
+		kept := TokenUnits(math.Round(float64(stake) * q.Credit(bet)))
+		return kept, stake - kept
+
+	case QuestionMultiSelect:
+		right := make(map[int]bool, len(q.CorrectIndices))
+		for _, index := range q.CorrectIndices {
+			right[index] = true
+		}
+		for i, b := range bet.Bets {
+			if right[i] {
+				correct += ToUnits(b)
+			} else {
+				wrong += ToUnits(b)
+			}
+		}
+		return correct, wrong
+	}
+
+	for i, b := range bet.Bets {
+		if i == q.CorrectIndex {
+			correct = ToUnits(b)
+		} else {
+			wrong += ToUnits(b)
+		}
+	}
+	return correct, wrong
+}
+
+// revealAnswer adds the answer key of non-choice questions to results
+func (q *Question) revealAnswer(results *QuizResults) {
+	switch q.Kind() {
+	case QuestionMultiSelect:
+		results.CorrectIndices = q.CorrectIndices
+	case QuestionNumeric:
+		answer := q.Answer
+		results.Answer = &answer
+	case QuestionHotspot:
+		results.Region = q.Region
+	}
+}
+
+// insidePolygon reports whether p falls inside polygon, a list of [x, y]
+// vertices such as a segmentation mask's outline
+func insidePolygon(p Point, polygon [][]int) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := float64(polygon[i][0]), float64(polygon[i][1])
+		xj, yj := float64(polygon[j][0]), float64(polygon[j][1])
+		if (yi > p.Y) != (yj > p.Y) && p.X < (xj-xi)*(p.Y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// decodeFormat reads the correct_indices, numeric and region fields of a
+// submit_question message
+func (q *Question) decodeFormat(msg map[string]interface{}) error {
+	if msg["correct_indices"] != nil {
+		if err := remarshal(msg["correct_indices"], &q.CorrectIndices); err != nil {
+			return fmt.Errorf("correct_indices: %w", err)
+		}
+	}
+	if msg["numeric"] != nil {
+		q.Numeric = &NumericRange{}
+		if err := remarshal(msg["numeric"], q.Numeric); err != nil {
+			return fmt.Errorf("numeric: %w", err)
+		}
+	}
+	if msg["region"] != nil {
+		q.Region = &Region{}
+		if err := remarshal(msg["region"], q.Region); err != nil {
+			return fmt.Errorf("region: %w", err)
+		}
+	}
+	return nil
+}
+
+// remarshal decodes one field of a WebSocket message read into a map
+func remarshal(value interface{}, into interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"log"
+	"time"
+)
+
+// HostEndReview moves on from the review before its time is up
+const HostEndReview = "end_review"
+
+// QuestionReview is shown between a question's results and the next question:
+// the answer, why it is right and how the players bet
+type QuestionReview struct {
+	Type           string       `json:"type"` // "review"
+	QuestionID     string       `json:"question_id"`
+	Question       string       `json:"question"`
+	Options        []string     `json:"options"`
+	CorrectIndex   int          `json:"correct_index"`
+	CorrectIndices []int        `json:"correct_indices,omitempty"`
+	Answer         *float64     `json:"answer,omitempty"`
+	Region         *Region      `json:"region,omitempty"`
+	Explanation    string       `json:"explanation,omitempty"`
+	ReferenceURL   string       `json:"reference_url,omitempty"`
+	Total          float64      `json:"total"`
+	Bettors        int          `json:"bettors"`
+	Distribution   []PoolOption `json:"distribution"` // tokens and bettors per option, one entry for numeric and hotspot
+	EndsAt         int64        `json:"ends_at"`      // Unix timestamp in ms; the host can end it sooner
+}
+
+// startReview shows the review of question to players and the host, then
+// moves on to the next question once quiz.review_duration has passed
+func (h *QuizHub) startReview(question *Question, results *QuizResults, distribution PoolUpdate) {
+	review := &QuestionReview{
+		Type:           "review",
+		QuestionID:     question.ID,
+		Question:       question.Question,
+		Options:        question.Options,
+		CorrectIndex:   results.CorrectIndex,
+		CorrectIndices: results.CorrectIndices,
+		Answer:         results.Answer,
+		Region:         results.Region,
+		Explanation:    question.Explanation,
+		ReferenceURL:   question.ReferenceURL,
+		Total:          distribution.Total,
+		Bettors:        distribution.Bettors,
+		Distribution:   distribution.Options,
+		EndsAt:         time.Now().Add(h.Config.ReviewDuration).UnixMilli(),
+	}
+	if review.Options == nil {
+		review.Options = []string{}
+	}
+
+	h.Mu.Lock()
+	h.clearReview()
+	h.GameState.Review = review
+	h.GameState.ReviewTimer = time.AfterFunc(h.Config.ReviewDuration, func() {
+		h.endReview(question.ID)
+	})
+	h.Mu.Unlock()
+
+	h.broadcastToPlayers(review)
+	h.notifyBroadcaster(review)
+}
+
+// endReview closes the review of questionID, or whichever is showing for "",
+// and plays the next question. It returns why it couldn't.
+func (h *QuizHub) endReview(questionID string) string {
+	h.Mu.Lock()
+	review := h.GameState.Review
+	if review == nil || (questionID != "" && review.QuestionID != questionID) {
+		h.Mu.Unlock()
+		return "no review is showing"
+	}
+	if err := h.Engine.EndReview(); err != nil {
+		h.Mu.Unlock()
+		return err.Error()
+	}
+	h.syncGame()
+	h.clearReview()
+	remaining := h.Engine.Remaining()
+	h.Mu.Unlock()
+
+	ended := map[string]interface{}{
+		"type":        "review_ended",
+		"question_id": review.QuestionID,
+	}
+	h.broadcastToPlayers(ended)
+	h.notifyBroadcaster(ended)
+	log.Printf("Quiz %s: review of %s ended\n", h.CurrentGameID(), review.QuestionID)
+
+	// Off the hub loop: it waits out the gap before the next question
+	go h.nextQuestion(remaining)
+	return ""
+}
+
+// clearReview drops the review being shown without moving on. Callers hold
+// h.Mu.
+func (h *QuizHub) clearReview() {
+	if h.GameState.ReviewTimer != nil {
+		h.GameState.ReviewTimer.Stop()
+		h.GameState.ReviewTimer = nil
+	}
+	h.GameState.Review = nil
+}
+
+// ReviewedQuestion is one question of a finished game as a player saw it:
+// the answer, their final bet and what it earned them
+type ReviewedQuestion struct {
+	QuestionID   string        `json:"question_id"`
+	Question     string        `json:"question"`
+	Options      []string      `json:"options"`
+	CorrectIndex int           `json:"correct_index"`
+	Explanation  string        `json:"explanation,omitempty"`
+	ReferenceURL string        `json:"reference_url,omitempty"`
+	ImageURL     string        `json:"image_url,omitempty"`
+	HasFrame     bool          `json:"has_frame,omitempty"`
+	VoidReason   string        `json:"void_reason,omitempty"`
+	Bet          *PlayerResult `json:"bet,omitempty"` // nil if they sat the question out; a voided question's bet was refunded
+
+	QuestionFormat
+}
+
+// Review lists every question of the game with userID's bet on it. Cancelled
+// bets don't count, and a voided question only shows the stake refunded.
+func (r *QuizGameRecord) Review(userID string) []ReviewedQuestion {
+	reviewed := make([]ReviewedQuestion, 0, len(r.Questions))
+	for _, q := range r.Questions {
+		entry := ReviewedQuestion{
+			QuestionID:     q.QuestionID,
+			Question:       q.Question,
+			Options:        q.Options,
+			CorrectIndex:   q.CorrectIndex,
+			Explanation:    q.Explanation,
+			ReferenceURL:   q.ReferenceURL,
+			ImageURL:       q.ImageURL,
+			HasFrame:       q.HasFrame,
+			VoidReason:     q.VoidReason,
+			QuestionFormat: q.QuestionFormat,
+		}
+		if entry.Options == nil {
+			entry.Options = []string{}
+		}
+
+		if result, ok := q.Results.playerResult(userID); ok {
+			entry.Bet = &result
+		} else if last := lastBet(q.Bets, userID); last != nil && !last.Cancelled {
+			entry.Bet = &PlayerResult{
+				Bets:           last.Bets,
+				Value:          last.Value,
+				Point:          last.Point,
+				TokensReturned: last.Total().Tokens(),
+			}
+		}
+		reviewed = append(reviewed, entry)
+	}
+	return reviewed
+}
+
+// playerResult is one player's result, if the question was scored and they
+// bet on it
+func (r *QuizResults) playerResult(userID string) (PlayerResult, bool) {
+	if r == nil {
+		return PlayerResult{}, false
+	}
+	result, ok := r.PlayerResults[userID]
+	return result, ok
+}
+
+// lastBet is the submission of userID that counted, the last one they sent
+func lastBet(bets []BetSubmission, userID string) *BetSubmission {
+	for i := len(bets) - 1; i >= 0; i-- {
+		if bets[i].PlayerID == userID {
+			return &bets[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dilyxs/medMarket/config"
+	"github.com/dilyxs/medMarket/quizengine"
+)
+
+// Scoring mode names accepted by QuizRules.Mode
+const (
+	ScoringElimination = quizengine.ScoringElimination
+	ScoringPoints      = quizengine.ScoringPoints
+	ScoringParimutuel  = quizengine.ScoringParimutuel
+	ScoringLives       = quizengine.ScoringLives
+)
+
+// QuizRules are the per-game scoring settings chosen when a game is created
+type QuizRules struct {
+	Mode         string `json:"mode" bson:"mode"`
+	Lives        int    `json:"lives,omitempty" bson:"lives,omitempty"`                 // lives mode only
+	MaxQuestions int    `json:"max_questions,omitempty" bson:"max_questions,omitempty"` // 0 plays until the mode ends the game
+}
+
+// DefaultRules returns the rules used when the host doesn't pick any
+func DefaultRules(cfg config.QuizConfig) QuizRules {
+	return QuizRules{Mode: cfg.ScoringMode}
+}
+
+// Normalize fills mode-specific defaults and checks the rules
+func (r *QuizRules) Normalize(cfg config.QuizConfig) error {
+	if r.Mode == "" {
+		r.Mode = cfg.ScoringMode
+	}
+	if r.MaxQuestions < 0 {
+		return invalid(errors.New("max_questions must not be negative"))
+	}
+
+	switch r.Mode {
+	case ScoringElimination, ScoringParimutuel:
+		r.Lives = 0
+	case ScoringPoints:
+		// Nobody is knocked out, so the game needs a length
+		r.Lives = 0
+		if r.MaxQuestions == 0 {
+			r.MaxQuestions = cfg.PointsRounds
+		}
+	case ScoringLives:
+		if r.Lives < 0 {
+			return invalid(errors.New("lives must be positive"))
+		}
+		if r.Lives == 0 {
+			r.Lives = cfg.Lives
+		}
+	default:
+		return invalid(fmt.Errorf("unknown scoring mode %q", r.Mode))
+	}
+	return nil
+}
+
+// NewScoringMode returns the mode for normalized rules
+func NewScoringMode(rules QuizRules, cfg config.QuizConfig) (quizengine.ScoringMode, error) {
+	switch rules.Mode {
+	case ScoringElimination:
+		return quizengine.EliminationMode{}, nil
+	case ScoringPoints:
+		return quizengine.PointsMode{PerAnswer: cfg.PointsPerAnswer, SpeedBonus: cfg.SpeedBonus}, nil
+	case ScoringParimutuel:
+		return quizengine.ParimutuelMode{Rake: cfg.HouseRake}, nil
+	case ScoringLives:
+		return quizengine.LivesMode{Lives: rules.Lives}, nil
+	}
+	return nil, invalid(fmt.Errorf("unknown scoring mode %q", rules.Mode))
+}
@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// QuizSpectator watches a game without buying in: questions, pools, results
+// and reviews, but no bets. Players who are eliminated stay connected as
+// players and watch the same way.
+type QuizSpectator struct {
+	UserID    string
+	Username  string
+	Conn      *websocket.Conn
+	Send      chan interface{}
+	Connected bool // guarded by the hub's Mu; Send is closed once false
+}
+
+// addSpectator registers a spectator, replacing their earlier connection
+func (h *QuizHub) addSpectator(spectator *QuizSpectator) {
+	h.Mu.Lock()
+	if _, banned := h.Banned[spectator.UserID]; banned {
+		h.Mu.Unlock()
+		select {
+		case spectator.Send <- map[string]interface{}{
+			"type":    "error",
+			"message": "you have been banned from this game",
+		}:
+		default:
+		}
+		close(spectator.Send)
+		return
+	}
+	if previous, ok := h.Spectators[spectator.UserID]; ok && previous.Connected {
+		previous.Connected = false
+		close(previous.Send)
+	}
+	spectator.Connected = true
+	h.Spectators[spectator.UserID] = spectator
+	h.Mu.Unlock()
+
+	log.Printf("Quiz spectator %s (%s) joined (%d watching)\n", spectator.Username, spectator.UserID, h.spectatorCount())
+	h.sendGameStateToSpectator(spectator)
+}
+
+// removeSpectator drops a spectator whose connection closed
+func (h *QuizHub) removeSpectator(spectator *QuizSpectator) {
+	h.Mu.Lock()
+	if current, ok := h.Spectators[spectator.UserID]; ok && current == spectator {
+		delete(h.Spectators, spectator.UserID)
+		if spectator.Connected {
+			spectator.Connected = false
+			close(spectator.Send)
+		}
+	}
+	h.Mu.Unlock()
+	log.Printf("Quiz spectator %s left\n", spectator.UserID)
+}
+
+func (h *QuizHub) spectatorCount() int {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+	return len(h.Spectators)
+}
+
+// sendGameStateToSpectator catches a spectator up on the game so far
+func (h *QuizHub) sendGameStateToSpectator(spectator *QuizSpectator) {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	remaining := 0
+	for _, player := range h.Players {
+		if player.IsActive {
+			remaining++
+		}
+	}
+	state := map[string]interface{}{
+		"type":              "game_state",
+		"game_id":           h.GameState.GameID,
+		"phase":             h.GameState.Phase,
+		"game_active":       h.GameState.GameActive,
+		"jackpot":           h.GameState.Jackpot,
+		"rules":             h.GameState.Rules,
+		"spectating":        true,
+		"remaining_players": remaining,
+	}
+	if h.GameState.QuestionActive && h.GameState.CurrentQuestion != nil && h.timeLeft() > 0 {
+		state["clock"] = h.clockMessage()
+		state["current_question"] = h.GameState.CurrentQuestion.ForClient(h.GameState.QuestionStartTime, h.GameState.Deadline)
+	}
+	if h.GameState.Review != nil {
+		state["review"] = h.GameState.Review
+	}
+
+	if spectator.Connected {
+		select {
+		case spectator.Send <- state:
+		default:
+		}
+	}
+}
+
+// broadcastToSpectators sends msg to everyone watching. Callers hold h.Mu.
+func (h *QuizHub) broadcastToSpectators(msg interface{}) {
+	for _, spectator := range h.Spectators {
+		if !spectator.Connected {
+			continue
+		}
+		select {
+		case spectator.Send <- msg:
+		default:
+			// Skip if channel full
+		}
+	}
+}
+
+func (s *QuizSpectator) ReadPump(hub *QuizHub) {
+	defer func() {
+		hub.UnregisterSpectator <- s
+		s.Conn.Close()
+	}()
+
+	s.Conn.SetReadDeadline(time.Now().Add(hub.Sockets.ReadTimeout))
+	s.Conn.SetPongHandler(func(string) error {
+		s.Conn.SetReadDeadline(time.Now().Add(hub.Sockets.ReadTimeout))
+		return nil
+	})
+
+	for {
+		var msg map[string]interface{}
+		if err := s.Conn.ReadJSON(&msg); err != nil {
+			break
+		}
+
+		msgType, _ := msg["type"].(string)
+		switch msgType {
+		case "submit_bet", "cancel_bet":
+			hub.Mu.RLock()
+			if s.Connected {
+				select {
+				case s.Send <- map[string]interface{}{
+					"type":    "bet_rejected",
+					"message": "spectators can't bet; join the next game to play",
+				}:
+				default:
+				}
+			}
+			hub.Mu.RUnlock()
+		}
+	}
+}
+
+func (s *QuizSpectator) WritePump(hub *QuizHub) {
+	ticker := time.NewTicker(hub.Sockets.PingInterval)
+	defer func() {
+		ticker.Stop()
+		s.Conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-s.Send:
+			if !ok {
+				s.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			s.Conn.SetWriteDeadline(time.Now().Add(hub.Sockets.WriteTimeout))
+			if err := s.Conn.WriteJSON(msg); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			s.Conn.SetWriteDeadline(time.Now().Add(hub.Sockets.WriteTimeout))
+			if err := s.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ConnectQuizSpectator lets a user watch the game without buying in
+func ConnectQuizSpectator(hub *QuizHub, w http.ResponseWriter, r *http.Request, userID, username string) {
+	hub.Mu.RLock()
+	gameActive := hub.GameState.GameActive
+	_, banned := hub.Banned[userID]
+	hub.Mu.RUnlock()
+
+	if banned {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "you have been banned from this game"})
+		return
+	}
+	if !gameActive {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "game has ended"})
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	spectator := &QuizSpectator{
+		UserID:   userID,
+		Username: username,
+		Conn:     conn,
+		Send:     make(chan interface{}, hub.Config.PlayerSendBuffer),
+	}
+
+	hub.RegisterSpectator <- spectator
+
+	go spectator.WritePump(hub)
+	go spectator.ReadPump(hub)
+}
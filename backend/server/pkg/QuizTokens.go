@@ -0,0 +1,15 @@
+package pkg
+
+import "github.com/dilyxs/medMarket/quizengine"
+
+// TokenScale is how many TokenUnits make one quiz token
+const TokenScale = quizengine.TokenScale
+
+// TokenUnits are quiz tokens in millionths, the engine's unit for every
+// stake, payout and balance
+type TokenUnits = quizengine.TokenUnits
+
+// ToUnits rounds a token amount to the nearest unit
+func ToUnits(tokens float64) TokenUnits {
+	return quizengine.ToUnits(tokens)
+}
@@ -0,0 +1,442 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dilyxs/medMarket/config"
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+// AnnotationPacket is sent to WebRTC viewers over the "annotations" data channel.
+// Timestamp is the capture time (Unix ms) of the JPEG frame the annotations
+// were made from, not an RTP timestamp: the two feeds aren't synchronised, so
+// overlays can drift from the video by the difference in their latency.
+type AnnotationPacket struct {
+	Timestamp int64              `json:"timestamp"`
+	Metadata  AnnotationMetadata `json:"metadata"`
+}
+
+// SFUViewer is a viewer receiving the broadcast through WebRTC
+type SFUViewer struct {
+	ID          int
+	Conn        *websocket.Conn
+	Peer        *webrtc.PeerConnection
+	Annotations *webrtc.DataChannel
+}
+
+// SFUHub forwards the broadcaster's video track to every viewer without
+// re-encoding it. Only one publisher is active at a time.
+type SFUHub struct {
+	API           *webrtc.API
+	Config        webrtc.Configuration
+	VideoTrack    *webrtc.TrackLocalStaticRTP
+	Publisher     *webrtc.PeerConnection
+	PublisherID   string
+	PublisherSSRC webrtc.SSRC
+	Viewers       map[int]*SFUViewer
+	Sockets       config.SocketConfig
+	Mu            sync.RWMutex
+}
+
+// NewSFUHub creates an SFU that only negotiates VP8 so the forwarded track can
+// be created up front and viewers may join before the broadcaster publishes.
+func NewSFUHub(iceServers []string, sockets config.SocketConfig) (*SFUHub, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+
+	videoTrack, err := webrtc.NewTrackLocalStaticRTP(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		"video",
+		"medmarket-broadcast",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	config := webrtc.Configuration{}
+	if len(iceServers) > 0 {
+		config.ICEServers = []webrtc.ICEServer{{URLs: iceServers}}
+	}
+
+	return &SFUHub{
+		API:        webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)),
+		Config:     config,
+		VideoTrack: videoTrack,
+		Viewers:    make(map[int]*SFUViewer),
+		Sockets:    sockets,
+	}, nil
+}
+
+// Publish accepts an SDP offer from hostID and returns the publisher connection
+// with its answer. A different active publisher is only replaced (and closed)
+// when takeover is set; otherwise ErrHostActive is returned.
+func (s *SFUHub) Publish(hostID string, takeover bool, offer webrtc.SessionDescription) (*webrtc.PeerConnection, *webrtc.SessionDescription, error) {
+	s.Mu.RLock()
+	conflict := s.Publisher != nil && s.PublisherID != hostID
+	s.Mu.RUnlock()
+	if conflict && !takeover {
+		return nil, nil, ErrHostActive
+	}
+
+	pc, err := s.API.NewPeerConnection(s.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		log.Printf("SFU publisher track started: codec=%s ssrc=%d", remote.Codec().MimeType, remote.SSRC())
+
+		s.Mu.Lock()
+		s.PublisherSSRC = remote.SSRC()
+		s.Mu.Unlock()
+		s.RequestKeyframe()
+
+		for {
+			packet, _, err := remote.ReadRTP()
+			if err != nil {
+				log.Printf("SFU publisher track ended: %v", err)
+				return
+			}
+			if err := s.VideoTrack.WriteRTP(packet); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+				log.Printf("SFU forward error: %v", err)
+				return
+			}
+		}
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("SFU publisher connection state: %s", state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			s.Mu.Lock()
+			if s.Publisher == pc {
+				s.Publisher = nil
+				s.PublisherID = ""
+				s.PublisherSSRC = 0
+			}
+			s.Mu.Unlock()
+		}
+	})
+
+	answer, err := negotiateAnswer(pc, offer)
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	s.Mu.Lock()
+	previous := s.Publisher
+	s.Publisher = pc
+	s.PublisherID = hostID
+	s.Mu.Unlock()
+
+	if previous != nil {
+		log.Println("SFU replacing previous publisher")
+		previous.Close()
+	}
+
+	return pc, answer, nil
+}
+
+// Unpublish closes the publisher connection if it is still the active one
+func (s *SFUHub) Unpublish(pc *webrtc.PeerConnection) {
+	s.Mu.Lock()
+	if s.Publisher != pc {
+		s.Mu.Unlock()
+		return
+	}
+	s.Publisher = nil
+	s.PublisherID = ""
+	s.PublisherSSRC = 0
+	s.Mu.Unlock()
+
+	pc.Close()
+}
+
+// RequestKeyframe asks the publisher for a keyframe so newly joined viewers
+// don't have to wait for the next natural one.
+func (s *SFUHub) RequestKeyframe() {
+	s.Mu.RLock()
+	publisher := s.Publisher
+	ssrc := s.PublisherSSRC
+	s.Mu.RUnlock()
+
+	if publisher == nil || ssrc == 0 {
+		return
+	}
+
+	if err := publisher.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)}}); err != nil {
+		log.Printf("SFU keyframe request failed: %v", err)
+	}
+}
+
+// Subscribe creates a peer connection for a viewer and returns the offer that
+// must be delivered to it. The viewer's answer is applied with Answer.
+func (s *SFUHub) Subscribe(viewerID int, conn *websocket.Conn) (*SFUViewer, *webrtc.SessionDescription, error) {
+	pc, err := s.API.NewPeerConnection(s.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sender, err := pc.AddTrack(s.VideoTrack)
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	// Read incoming RTCP so interceptors run; forward PLIs to the publisher
+	go func() {
+		for {
+			packets, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, packet := range packets {
+				if _, ok := packet.(*rtcp.PictureLossIndication); ok {
+					s.RequestKeyframe()
+				}
+			}
+		}
+	}()
+
+	ordered := false
+	maxRetransmits := uint16(0)
+	annotations, err := pc.CreateDataChannel("annotations", &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	})
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	viewer := &SFUViewer{
+		ID:          viewerID,
+		Conn:        conn,
+		Peer:        pc,
+		Annotations: annotations,
+	}
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			s.RequestKeyframe()
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			s.RemoveViewer(viewer)
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+	<-gatherComplete
+
+	s.Mu.Lock()
+	s.Viewers[viewerID] = viewer
+	s.Mu.Unlock()
+
+	return viewer, pc.LocalDescription(), nil
+}
+
+// Answer applies the viewer's SDP answer
+func (v *SFUViewer) Answer(answer webrtc.SessionDescription) error {
+	return v.Peer.SetRemoteDescription(answer)
+}
+
+// RemoveViewer drops a viewer from the hub and closes its peer connection
+func (s *SFUHub) RemoveViewer(viewer *SFUViewer) {
+	s.Mu.Lock()
+	current, ok := s.Viewers[viewer.ID]
+	if ok && current == viewer {
+		delete(s.Viewers, viewer.ID)
+	}
+	s.Mu.Unlock()
+
+	if ok && current == viewer {
+		viewer.Peer.Close()
+		log.Printf("SFU viewer %d removed", viewer.ID)
+	}
+}
+
+// PublishAnnotations sends frame metadata to every viewer over its data channel
+func (s *SFUHub) PublishAnnotations(frame VideoFrameWithAnnotations) {
+	payload, err := json.Marshal(AnnotationPacket{
+		Timestamp: frame.Timestamp,
+		Metadata:  frame.Metadata,
+	})
+	if err != nil {
+		log.Printf("SFU failed to encode annotations: %v", err)
+		return
+	}
+
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	for _, viewer := range s.Viewers {
+		if viewer.Annotations.ReadyState() != webrtc.DataChannelStateOpen {
+			continue
+		}
+		if err := viewer.Annotations.Send(payload); err != nil {
+			log.Printf("SFU annotation send failed for viewer %d: %v", viewer.ID, err)
+		}
+	}
+}
+
+// Close hangs up the publisher and every viewer, sending viewers a close frame
+func (s *SFUHub) Close(reason string) {
+	s.Mu.Lock()
+	publisher := s.Publisher
+	s.Publisher = nil
+	s.PublisherID = ""
+	s.PublisherSSRC = 0
+	viewers := make([]*SFUViewer, 0, len(s.Viewers))
+	for id, viewer := range s.Viewers {
+		viewers = append(viewers, viewer)
+		delete(s.Viewers, id)
+	}
+	s.Mu.Unlock()
+
+	for _, viewer := range viewers {
+		sendCloseFrame(viewer.Conn, reason)
+		viewer.Peer.Close()
+	}
+	if publisher != nil {
+		publisher.Close()
+	}
+}
+
+func negotiateAnswer(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		return nil, err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Non-trickle ICE: wait for all candidates so signaling is one round trip
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return nil, err
+	}
+	<-gatherComplete
+
+	return pc.LocalDescription(), nil
+}
+
+// WebSocket signaling handlers
+
+// ConnectSFUBroadcaster expects the broadcaster to send its SDP offer as
+// {"type":"offer","sdp":"..."} and replies with the answer. The socket stays
+// open for the duration of the broadcast; closing it stops publishing.
+func ConnectSFUBroadcaster(sfu *SFUHub, w http.ResponseWriter, r *http.Request, hostID string, takeover bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("SFU broadcaster WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	var offer webrtc.SessionDescription
+	if err := conn.ReadJSON(&offer); err != nil {
+		log.Printf("SFU broadcaster sent invalid offer: %v", err)
+		return
+	}
+	if offer.Type != webrtc.SDPTypeOffer {
+		conn.WriteJSON(map[string]string{"type": "error", "message": "expected offer"})
+		return
+	}
+
+	publisher, answer, err := sfu.Publish(hostID, takeover, offer)
+	if errors.Is(err, ErrHostActive) {
+		conn.WriteJSON(map[string]string{"type": "error", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("SFU publish failed: %v", err)
+		conn.WriteJSON(map[string]string{"type": "error", "message": "failed to negotiate"})
+		return
+	}
+	defer sfu.Unpublish(publisher)
+
+	conn.SetWriteDeadline(time.Now().Add(sfu.Sockets.WriteTimeout))
+	if err := conn.WriteJSON(answer); err != nil {
+		return
+	}
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// ConnectSFUViewer sends the viewer an SDP offer containing the broadcast track
+// and an "annotations" data channel, then waits for {"type":"answer",...}.
+func ConnectSFUViewer(sfu *SFUHub, w http.ResponseWriter, r *http.Request, viewerID int) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("SFU viewer WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	viewer, offer, err := sfu.Subscribe(viewerID, conn)
+	if err != nil {
+		log.Printf("SFU subscribe failed for viewer %d: %v", viewerID, err)
+		conn.WriteJSON(map[string]string{"type": "error", "message": "failed to negotiate"})
+		return
+	}
+	defer sfu.RemoveViewer(viewer)
+
+	conn.SetWriteDeadline(time.Now().Add(sfu.Sockets.WriteTimeout))
+	if err := conn.WriteJSON(offer); err != nil {
+		return
+	}
+
+	var answer webrtc.SessionDescription
+	if err := conn.ReadJSON(&answer); err != nil {
+		log.Printf("SFU viewer %d sent invalid answer: %v", viewerID, err)
+		return
+	}
+	if err := viewer.Answer(answer); err != nil {
+		log.Printf("SFU viewer %d answer rejected: %v", viewerID, err)
+		return
+	}
+
+	log.Printf("SFU viewer %d negotiated", viewerID)
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dilyxs/medMarket/config"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// completeOffer creates an offer and waits for ICE gathering, matching the
+// SFU's non-trickle signaling
+func completeOffer(t *testing.T, pc *webrtc.PeerConnection) webrtc.SessionDescription {
+	t.Helper()
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatalf("set local offer: %v", err)
+	}
+	<-gathered
+	return *pc.LocalDescription()
+}
+
+// TestSFULoopback publishes a VP8 track through the hub to one subscriber on
+// the same machine, then checks the subscriber gets the forwarded RTP and an
+// annotations message.
+func TestSFULoopback(t *testing.T) {
+	hub, err := NewSFUHub(nil, config.Default().Sockets)
+	if err != nil {
+		t.Fatalf("new hub: %v", err)
+	}
+	defer hub.Close("test done")
+
+	// Publisher: sends a VP8 track to the hub
+	publisher, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("publisher peer: %v", err)
+	}
+	defer publisher.Close()
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "test")
+	if err != nil {
+		t.Fatalf("local track: %v", err)
+	}
+	if _, err := publisher.AddTrack(track); err != nil {
+		t.Fatalf("add track: %v", err)
+	}
+	pc, answer, err := hub.Publish("host", false, completeOffer(t, publisher))
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := publisher.SetRemoteDescription(*answer); err != nil {
+		t.Fatalf("publisher answer: %v", err)
+	}
+	if _, _, err := hub.Publish("other-host", false, completeOffer(t, publisher)); err != ErrHostActive {
+		t.Fatalf("second publisher: got %v, want ErrHostActive", err)
+	}
+
+	// Subscriber: answers the hub's offer and listens for video and annotations
+	subscriber, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("subscriber peer: %v", err)
+	}
+	defer subscriber.Close()
+
+	video := make(chan string, 1)
+	subscriber.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := remote.ReadRTP(); err == nil {
+			video <- remote.Codec().MimeType
+		}
+	})
+	opened := make(chan struct{})
+	packets := make(chan []byte, 16)
+	subscriber.OnDataChannel(func(channel *webrtc.DataChannel) {
+		if channel.Label() != "annotations" {
+			return
+		}
+		channel.OnOpen(func() { close(opened) })
+		channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+			select {
+			case packets <- msg.Data:
+			default:
+			}
+		})
+	})
+
+	viewer, offer, err := hub.Subscribe(1, nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := subscriber.SetRemoteDescription(*offer); err != nil {
+		t.Fatalf("subscriber offer: %v", err)
+	}
+	reply, err := subscriber.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("subscriber answer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(subscriber)
+	if err := subscriber.SetLocalDescription(reply); err != nil {
+		t.Fatalf("set subscriber answer: %v", err)
+	}
+	<-gathered
+	if err := viewer.Answer(*subscriber.LocalDescription()); err != nil {
+		t.Fatalf("apply viewer answer: %v", err)
+	}
+
+	// Keep sending frames until the subscriber has seen one
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+
+	timeout := time.After(10 * time.Second)
+	select {
+	case mime := <-video:
+		if mime != webrtc.MimeTypeVP8 {
+			t.Fatalf("forwarded codec %s, want %s", mime, webrtc.MimeTypeVP8)
+		}
+	case <-timeout:
+		t.Fatal("subscriber never received the forwarded track")
+	}
+
+	select {
+	case <-opened:
+	case <-timeout:
+		t.Fatal("annotations channel never opened")
+	}
+
+	// The channel is unreliable, so publish until a packet gets through
+	frame := VideoFrameWithAnnotations{
+		Timestamp: 1700000000000,
+		Metadata:  AnnotationMetadata{FrameIndex: 7, MasksDetected: 1},
+	}
+	for {
+		hub.PublishAnnotations(frame)
+		select {
+		case data := <-packets:
+			var packet AnnotationPacket
+			if err := json.Unmarshal(data, &packet); err != nil {
+				t.Fatalf("decode annotations: %v", err)
+			}
+			if packet.Timestamp != frame.Timestamp || packet.Metadata.FrameIndex != 7 || packet.Metadata.MasksDetected != 1 {
+				t.Fatalf("got annotations %+v, want %+v", packet, frame)
+			}
+			hub.Unpublish(pc)
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("subscriber never received annotations")
+		}
+	}
+}
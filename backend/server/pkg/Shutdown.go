@@ -0,0 +1,28 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ShutdownReason is sent in the close frame to every socket when the server stops
+const ShutdownReason = "server shutting down"
+
+// HostTakeoverReason is sent to a host whose session an admin took over
+const HostTakeoverReason = "host taken over by an admin"
+
+// ErrHostActive is returned when a second host connects without taking over
+var ErrHostActive = errors.New("another host is already connected")
+
+// sendCloseFrame tells the peer why the connection is going away and closes it.
+// WriteControl is safe to call while a write pump is running on the same conn.
+func sendCloseFrame(conn *websocket.Conn, reason string) {
+	if conn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
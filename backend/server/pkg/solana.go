@@ -6,11 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 )
 
-const SolanaRPC = "https://api.mainnet-beta.solana.com"
-
 type VerifyDepositRequest struct {
 	Signature        string `json:"signature"`
 	ExpectedLamports int64  `json:"expected_lamports"`
@@ -68,8 +65,8 @@ func rpcCall(method string, params []interface{}) (json.RawMessage, error) {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Post(SolanaRPC, "application/json", bytes.NewBuffer(body))
+	client := &http.Client{Timeout: solanaConfig.RPCTimeout}
+	resp, err := client.Post(solanaConfig.VerifyRPC, "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
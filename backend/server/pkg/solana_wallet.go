@@ -5,27 +5,36 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"os"
 	"time"
 
+	"github.com/dilyxs/medMarket/config"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
+// solanaConfig is set once at startup by ConfigureSolana
+var solanaConfig = config.Default().Solana
+
+// ConfigureSolana sets the RPC endpoints, treasury keys and test mode used by
+// the Solana helpers. Call it before serving requests.
+func ConfigureSolana(cfg config.SolanaConfig) {
+	solanaConfig = cfg
+}
+
 // IsTestMode returns true if running in test mode (no real Solana transactions)
 func IsTestMode() bool {
-	return os.Getenv("SOLANA_TEST_MODE") == "true"
+	return solanaConfig.TestMode
 }
 
 // Solana wallet functions
 
-// LoadWalletFromEnv loads the treasury wallet keypair from the SOL_TREASURY_SECRET_KEY env var
-// The env var should contain the raw JSON array from app-bank.json
-func LoadWalletFromEnv() (solana.PrivateKey, error) {
-	keyStr := os.Getenv("SOL_TREASURY_SECRET_KEY")
+// LoadTreasuryWallet loads the treasury wallet keypair from solana.treasury_secret_key
+// (SOL_TREASURY_SECRET_KEY), which holds the raw JSON array from app-bank.json
+func LoadTreasuryWallet() (solana.PrivateKey, error) {
+	keyStr := solanaConfig.TreasurySecretKey
 	if keyStr == "" {
-		return nil, fmt.Errorf("SOL_TREASURY_SECRET_KEY env var not set")
+		return nil, fmt.Errorf("SOL_TREASURY_SECRET_KEY not configured")
 	}
 
 	var keyBytes []uint8
@@ -43,18 +52,14 @@ func LoadWalletFromEnv() (solana.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// GetReceiverAddress returns the treasury SOL receiver address from env
+// GetReceiverAddress returns the treasury SOL receiver address
 func GetReceiverAddress() string {
-	return os.Getenv("SOL_RECEIVER_ADDRESS")
+	return solanaConfig.ReceiverAddress
 }
 
-// GetSolanaRPC returns the Solana RPC endpoint from env
+// GetSolanaRPC returns the Solana RPC endpoint
 func GetSolanaRPC() string {
-	rpc := os.Getenv("SOLANA_RPC")
-	if rpc == "" {
-		rpc = "https://api.devnet.solana.com"
-	}
-	return rpc
+	return solanaConfig.RPC
 }
 
 // GetRPCClient returns a Solana RPC client
@@ -95,7 +100,7 @@ func GetBalance(address string) (uint64, error) {
 	}
 
 	client := GetRPCClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), solanaConfig.RPCTimeout)
 	defer cancel()
 
 	pubKey := solana.MustPublicKeyFromBase58(address)
@@ -110,7 +115,7 @@ func GetBalance(address string) (uint64, error) {
 // GetSignatureStatuses retrieves the status of one or more signatures
 func GetSignatureStatuses(signatures []string) (map[string]interface{}, error) {
 	client := GetRPCClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), solanaConfig.RPCTimeout)
 	defer cancel()
 
 	solSigs := make([]solana.Signature, len(signatures))
@@ -162,7 +167,7 @@ func QueryRecentTransactions(address string, limit int) ([]map[string]interface{
 	}
 
 	client := GetRPCClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), solanaConfig.RPCTimeout)
 	defer cancel()
 
 	pubKey := solana.MustPublicKeyFromBase58(address)
@@ -223,11 +228,11 @@ func SendTransaction(toAddress string, amountLamports uint64, memo string) (stri
 	}
 
 	client := GetRPCClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), solanaConfig.RPCTimeout)
 	defer cancel()
 
 	// Load treasury keypair
-	treasury, err := LoadWalletFromEnv()
+	treasury, err := LoadTreasuryWallet()
 	if err != nil {
 		return "", fmt.Errorf("failed to load treasury wallet: %w", err)
 	}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dilyxs/medMarket/auth"
+	"github.com/dilyxs/medMarket/pkg"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// canHost reports whether user may host or start game
+func canHost(user *auth.User, game *pkg.QuizHub) bool {
+	return user.Role.AtLeast(auth.RoleAdmin) || game.Info().HostID == user.UserID
+}
+
+// respondGameError maps manager errors to HTTP statuses
+func respondGameError(w http.ResponseWriter, err error) {
+	var invalid *pkg.ValidationError
+	switch {
+	case errors.Is(err, pkg.ErrGameNotFound):
+		http.Error(w, `{"error": "quiz game not found"}`, http.StatusNotFound)
+	case errors.As(err, &invalid):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": invalid.Error()})
+	case errors.Is(err, pkg.ErrTooManyGames):
+		http.Error(w, `{"error": "too many quiz games are open"}`, http.StatusServiceUnavailable)
+	default:
+		http.Error(w, `{"error": "failed to open quiz game"}`, http.StatusInternalServerError)
+	}
+}
+
+// HandleListGames lists open lobbies and running games plus recently finished ones
+// GET /api/quiz/games
+func HandleListGames(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"games":    games.List(),
+		"archived": games.Finished(),
+	})
+}
+
+// HandleGetGame returns one open game
+// GET /api/quiz/games/{id}
+func HandleGetGame(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	game, err := games.Game(mux.Vars(r)["id"])
+	if err != nil {
+		respondGameError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(game.Info())
+}
+
+// HandleCreateGame opens a new lobby hosted by the caller. The queue can be
+// pre-filled from a bank (optionally filtered by tag) or a playlist; queued
+// questions auto-advance once the game starts. mode picks the scoring mode
+// (elimination, points, parimutuel or lives).
+// POST /api/quiz/games - optional body {"bank_id", "tag", "playlist_id", "gap_seconds", "mode", "lives", "max_questions"}
+func HandleCreateGame(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager, banks *pkg.QuestionBankStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		BankID     string `json:"bank_id"`
+		Tag        string `json:"tag"`
+		PlaylistID string `json:"playlist_id"`
+		GapSeconds *int   `json:"gap_seconds"`
+		pkg.QuizRules
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.BankID != "" && req.PlaylistID != "" {
+		http.Error(w, `{"error": "use either bank_id or playlist_id"}`, http.StatusBadRequest)
+		return
+	}
+	if req.GapSeconds != nil && *req.GapSeconds < 0 {
+		http.Error(w, `{"error": "gap_seconds must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	var questions []*pkg.Question
+	gap := time.Duration(0)
+	switch {
+	case req.BankID != "":
+		bank, err := banks.GetBank(r.Context(), req.BankID)
+		if err != nil {
+			respondBankError(w, err)
+			return
+		}
+		questions = pkg.QuestionsFromBank(bank, req.Tag)
+
+	case req.PlaylistID != "":
+		playlist, err := banks.GetPlaylist(r.Context(), req.PlaylistID)
+		if err != nil {
+			respondBankError(w, err)
+			return
+		}
+		questions, err = banks.QuestionsForPlaylist(r.Context(), playlist)
+		if err != nil {
+			respondBankError(w, err)
+			return
+		}
+		gap = time.Duration(playlist.GapSeconds) * time.Second
+	}
+	if (req.BankID != "" || req.PlaylistID != "") && len(questions) == 0 {
+		http.Error(w, `{"error": "no questions to queue"}`, http.StatusBadRequest)
+		return
+	}
+	if req.GapSeconds != nil {
+		gap = time.Duration(*req.GapSeconds) * time.Second
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	game, err := games.CreateGame(user.UserID, questions, gap, req.QuizRules)
+	if err != nil {
+		respondGameError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(game.Info())
+}
+
+// HandleStartGame moves a lobby into the running phase. Hosts can also send
+// {"type": "start_game"} on their socket.
+// POST /api/quiz/games/{id}/start
+func HandleStartGame(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, _ := auth.UserFromContext(r.Context())
+	game, err := games.Game(mux.Vars(r)["id"])
+	if err != nil {
+		respondGameError(w, err)
+		return
+	}
+	if !canHost(user, game) {
+		http.Error(w, `{"error": "only the host can start this game"}`, http.StatusForbidden)
+		return
+	}
+	if game.Info().Phase != pkg.QuizPhaseLobby {
+		http.Error(w, `{"error": "game has already started"}`, http.StatusConflict)
+		return
+	}
+
+	select {
+	case game.StartGame <- user.UserID:
+	default:
+		http.Error(w, `{"error": "game start already requested"}`, http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"game_id": game.CurrentGameID(),
+		"status":  "starting",
+	})
+}
+
+// HandleGameHistory lists the caller's past games; admins can pass ?user_id=
+// GET /api/quiz/history?limit=20
+func HandleGameHistory(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if games.Store == nil {
+		http.Error(w, `{"error": "quiz history is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	userID := user.UserID
+	if other := r.URL.Query().Get("user_id"); other != "" && other != userID {
+		if !user.Role.AtLeast(auth.RoleAdmin) {
+			http.Error(w, `{"error": "only admins can view other users' history"}`, http.StatusForbidden)
+			return
+		}
+		userID = other
+	}
+
+	limit := int64(20)
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 || parsed > 100 {
+			http.Error(w, `{"error": "limit must be between 1 and 100"}`, http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	history, err := games.Store.GamesForUser(r.Context(), userID, limit)
+	if err != nil {
+		http.Error(w, `{"error": "failed to load quiz history"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"games":   history,
+	})
+}
+
+// readableGame loads the game in the URL if the caller may review it: its
+// players, its host and admins, once the game is over. Otherwise it writes the
+// error and returns nil.
+func readableGame(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) *pkg.QuizGameRecord {
+	if games.Store == nil {
+		http.Error(w, `{"error": "quiz history is not available"}`, http.StatusServiceUnavailable)
+		return nil
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	record, err := games.Store.Game(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, `{"error": "quiz game not found"}`, http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, `{"error": "failed to load quiz game"}`, http.StatusInternalServerError)
+		return nil
+	}
+
+	if record.HostID != user.UserID && !record.HasPlayer(user.UserID) && !user.Role.AtLeast(auth.RoleAdmin) {
+		http.Error(w, `{"error": "you did not take part in this game"}`, http.StatusForbidden)
+		return nil
+	}
+	if !record.Finished() {
+		http.Error(w, `{"error": "quiz game is still running"}`, http.StatusConflict)
+		return nil
+	}
+	return record
+}
+
+// HandleGameTranscript returns a finished game including correct answers and
+// every bet. Only the game's players, its host and admins can read it.
+// GET /api/quiz/history/{id}
+func HandleGameTranscript(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record := readableGame(w, r, games)
+	if record == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(record)
+}
+
+// HandleGameReview lists every question of a game with the answer, its
+// explanation and the caller's bet. The game's host and admins can pass
+// ?user_id= to review one of its players.
+// GET /api/quiz/history/{id}/review
+func HandleGameReview(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record := readableGame(w, r, games)
+	if record == nil {
+		return
+	}
+
+	user, _ := auth.UserFromContext(r.Context())
+	userID := user.UserID
+	if requested := r.URL.Query().Get("user_id"); requested != "" && requested != userID {
+		if record.HostID != user.UserID && !user.Role.AtLeast(auth.RoleAdmin) {
+			http.Error(w, `{"error": "only the host can review other players"}`, http.StatusForbidden)
+			return
+		}
+		userID = requested
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"game_id":   record.GameID,
+		"user_id":   userID,
+		"status":    record.Status,
+		"questions": record.Review(userID),
+	})
+}
+
+// HandleQuestionFrame returns the broadcast frame a question was asked about,
+// with any segmentation regions attached to it. The image is base64 JPEG.
+// GET /api/quiz/history/{id}/frames/{question_id}
+func HandleQuestionFrame(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record := readableGame(w, r, games)
+	if record == nil {
+		return
+	}
+	frame, err := games.Store.Frame(r.Context(), record.GameID, mux.Vars(r)["question_id"])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, `{"error": "question has no frame"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "failed to load frame"}`, http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(frame)
+}
+
+// HandleLeaderboard ranks players across every finished game, all time or
+// since the start of the week
+// GET /api/quiz/leaderboard?period=all|week&sort=net|wins|accuracy|avg_stake&limit=20&offset=0
+func HandleLeaderboard(w http.ResponseWriter, r *http.Request, games *pkg.QuizManager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if games.Store == nil {
+		http.Error(w, `{"error": "quiz history is not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = pkg.LeaderboardAllTime
+	}
+	rankBy := query.Get("sort")
+	if rankBy == "" {
+		rankBy = pkg.RankByNet
+	}
+
+	limit := 20
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			http.Error(w, `{"error": "limit must be between 1 and 100"}`, http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, `{"error": "offset must not be negative"}`, http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	since, err := pkg.LeaderboardSince(period, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	entries, err := games.Store.Leaderboard(r.Context(), since, rankBy)
+	var invalid *pkg.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "failed to load quiz leaderboard"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":  period,
+		"sort":    rankBy,
+		"since":   since,
+		"total":   len(entries),
+		"entries": entries[min(offset, len(entries)):min(offset+limit, len(entries))],
+	})
+}
+
+// RegisterQuizRoutes registers the quiz lobby routes under /api/quiz
+func RegisterQuizRoutes(router *mux.Router, games *pkg.QuizManager, banks *pkg.QuestionBankStore, roles *auth.RoleStore) *mux.Router {
+	quiz := router.PathPrefix("/api/quiz").Subrouter()
+
+	quiz.HandleFunc("/games", func(w http.ResponseWriter, r *http.Request) {
+		HandleListGames(w, r, games)
+	}).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetGame(w, r, games)
+	}).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/games", roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+		HandleCreateGame(w, r, games, banks)
+	})).Methods(http.MethodPost)
+
+	quiz.HandleFunc("/games/{id}/start", roles.RequireRole(auth.RoleInstructor, func(w http.ResponseWriter, r *http.Request) {
+		HandleStartGame(w, r, games)
+	})).Methods(http.MethodPost)
+
+	// Any signed-in user; RequireRole loads the role used for the admin checks
+	quiz.HandleFunc("/history", roles.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		HandleGameHistory(w, r, games)
+	})).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/history/{id}", roles.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		HandleGameTranscript(w, r, games)
+	})).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/history/{id}/review", roles.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		HandleGameReview(w, r, games)
+	})).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/history/{id}/frames/{question_id}", roles.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		HandleQuestionFrame(w, r, games)
+	})).Methods(http.MethodGet)
+
+	quiz.HandleFunc("/leaderboard", roles.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		HandleLeaderboard(w, r, games)
+	})).Methods(http.MethodGet)
+
+	return quiz
+}
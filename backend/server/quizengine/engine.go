@@ -0,0 +1,580 @@
+package quizengine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Engine states. A game is in the lobby, then running until it has ended.
+const (
+	StateLobby        = "lobby"         // players join and questions queue up
+	StateWaiting      = "waiting"       // running with no question open, until the gap passes or the host sends one
+	StateQuestionOpen = "question_open" // bets are taken until the deadline
+	StateSettling     = "settling"      // the question has closed and its bets are being scored
+	StateReview       = "review"        // the answer and distribution are shown before the next question
+	StateEnded        = "ended"
+)
+
+var (
+	// ErrNotPlaying is returned for bets from someone who isn't seated in the
+	// game or has been eliminated
+	ErrNotPlaying = errors.New("player is not in the game")
+
+	// ErrNoQuestion is returned for events that need an open question
+	ErrNoQuestion = errors.New("no question is open")
+)
+
+// StateError is returned for an event the game's current state doesn't allow
+type StateError struct {
+	Event string
+	State string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("can't %s while the game is %s", e.Event, e.State)
+}
+
+// Player is a seated player's standing in the game
+type Player struct {
+	ID       string
+	Tokens   TokenUnits
+	Active   bool         // false once eliminated or removed
+	Stakes   []TokenUnits // their latest bet, per option
+	Points   float64      // points mode score
+	Lives    int          // lives mode strikes left
+	JoinedAt time.Time
+}
+
+// Bet is a player's stake on each option of a question, or the one stake on a
+// numeric or hotspot answer
+type Bet struct {
+	PlayerID   string
+	QuestionID string
+	Stakes     []TokenUnits
+	Placed     time.Time // server receive time
+}
+
+// Total is the whole stake across every option
+func (b Bet) Total() TokenUnits {
+	total := TokenUnits(0)
+	for _, stake := range b.Stakes {
+		total += stake
+	}
+	return total
+}
+
+// Grade is how much of a bet counted as correct and how much as wrong. The
+// caller grades each bet against its question before settling.
+type Grade struct {
+	Correct TokenUnits
+	Wrong   TokenUnits
+}
+
+// Engine holds a game's rules: which events each state allows, bets,
+// scoring, elimination, the jackpot and the winner. It works on plain values,
+// does no locking, logging or I/O and never reads the clock, so the caller
+// serialises every call, passes the time in and sends the messages for what
+// changed.
+type Engine struct {
+	State        string
+	Players      map[string]*Player // userID -> player
+	Bets         map[string]Bet     // playerID -> bet on the open question
+	Scoring      ScoringMode
+	BuyIn        TokenUnits    // a new player's starting stack
+	BetLockIn    time.Duration // bets are final this close to the deadline
+	Reviews      bool          // each question's results are followed by a review
+	MaxQuestions int           // 0 plays until the scoring mode ends the game
+
+	StartedAt       time.Time
+	EndedAt         time.Time
+	QuestionID      string // the open question, until it is settled or voided
+	Opened          time.Time
+	Limit           time.Duration
+	Deadline        time.Time     // when the open question closes; extended by the host
+	Paused          bool          // the host has stopped the clock
+	PausedRemaining time.Duration // time left when the clock was paused
+	QuestionsPlayed int
+	Jackpot         TokenUnits
+	JackpotShares   map[string]TokenUnits // what each player has lost into the jackpot, for refunds
+}
+
+// New creates an engine in the lobby. Scoring is elimination until the
+// caller picks a mode.
+func New(buyIn TokenUnits, betLockIn time.Duration, reviews bool) *Engine {
+	return &Engine{
+		State:         StateLobby,
+		Players:       make(map[string]*Player),
+		Bets:          make(map[string]Bet),
+		Scoring:       EliminationMode{},
+		BuyIn:         buyIn,
+		BetLockIn:     betLockIn,
+		Reviews:       reviews,
+		JackpotShares: make(map[string]TokenUnits),
+	}
+}
+
+// require checks that the game is in one of states before event
+func (e *Engine) require(event string, states ...string) error {
+	for _, state := range states {
+		if e.State == state {
+			return nil
+		}
+	}
+	return &StateError{Event: event, State: e.State}
+}
+
+// Join seats a player. Someone rejoining keeps their stack, bets and status,
+// and Join reports that they were already seated; a new player gets the
+// buy-in, but only while the game is in the lobby.
+func (e *Engine) Join(playerID string, now time.Time) (rejoined bool, err error) {
+	if _, ok := e.Players[playerID]; ok {
+		return true, nil
+	}
+	if err := e.require("join", StateLobby); err != nil {
+		return false, err
+	}
+	player := &Player{ID: playerID, Tokens: e.BuyIn, Active: true, JoinedAt: now}
+	e.Scoring.Join(player)
+	e.Players[playerID] = player
+	return false, nil
+}
+
+// Remove takes a player out of the game, refunding their bet on the open
+// question. It returns their final standing, eliminated with their stack.
+func (e *Engine) Remove(playerID string) (Player, TokenUnits, error) {
+	player, ok := e.Players[playerID]
+	if !ok {
+		return Player{}, 0, ErrNotPlaying
+	}
+
+	refund := TokenUnits(0)
+	if bet, ok := e.Bets[playerID]; ok && e.State == StateQuestionOpen {
+		refund = bet.Total()
+		delete(e.Bets, playerID)
+	}
+
+	player.Tokens += refund
+	player.Active = false
+	player.Stakes = nil
+	delete(e.Players, playerID)
+	return *player, refund, nil
+}
+
+// Adjust credits or debits a player's tokens, returning their new balance
+func (e *Engine) Adjust(playerID string, amount TokenUnits) (TokenUnits, error) {
+	player, ok := e.Players[playerID]
+	if !ok {
+		return 0, errors.New("player not found")
+	}
+	if e.State == StateEnded {
+		return 0, errors.New("game has ended")
+	}
+
+	balance := player.Tokens + amount
+	if balance < 0 {
+		return 0, fmt.Errorf("player only has %.2f tokens", player.Tokens.Tokens())
+	}
+	player.Tokens = balance
+	return balance, nil
+}
+
+// Remaining counts the players still in
+func (e *Engine) Remaining() int {
+	remaining := 0
+	for _, player := range e.Players {
+		if player.Active {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Start runs the game
+func (e *Engine) Start(now time.Time) error {
+	if err := e.require("start", StateLobby); err != nil {
+		return err
+	}
+	e.StartedAt = now
+	e.State = StateWaiting
+	return nil
+}
+
+// Open opens question questionID for limit if the game is waiting for one.
+// It reports false when the question should queue instead.
+func (e *Engine) Open(questionID string, limit time.Duration, now time.Time) (bool, error) {
+	if e.State == StateEnded {
+		return false, &StateError{Event: "submit a question", State: StateEnded}
+	}
+	if e.State != StateWaiting {
+		return false, nil
+	}
+
+	e.QuestionID = questionID
+	e.Opened = now
+	e.Limit = limit
+	e.Deadline = now.Add(limit)
+	e.Paused = false
+	e.Bets = make(map[string]Bet)
+	e.State = StateQuestionOpen
+	return true, nil
+}
+
+// TimeLeft is how long the open question has before it closes
+func (e *Engine) TimeLeft(now time.Time) time.Duration {
+	if e.Paused {
+		return e.PausedRemaining
+	}
+	return e.Deadline.Sub(now)
+}
+
+// BetsLocked reports whether the open question is inside its lock-in window,
+// when bets can no longer be placed, changed or cancelled
+func (e *Engine) BetsLocked(now time.Time) bool {
+	return e.TimeLeft(now) < e.BetLockIn
+}
+
+// checkTiming returns why a bet or cancellation sent at placed can't be taken
+// for the open question
+func (e *Engine) checkTiming(questionID string, placed, now time.Time) error {
+	switch {
+	case e.State != StateQuestionOpen:
+		return ErrNoQuestion
+	case questionID != e.QuestionID:
+		return errors.New("bet is for a question that is no longer open")
+	case e.Paused:
+		return errors.New("question is paused")
+	case !placed.Before(e.Deadline):
+		return errors.New("question has closed")
+	case e.BetsLocked(now):
+		return errors.New("bets are locked in")
+	}
+	return nil
+}
+
+// CheckBet returns why a player's bet on questionID, sent at placed, can't be
+// taken. The caller checks the answer against the question's type in between
+// CheckBet and Bet.
+func (e *Engine) CheckBet(playerID, questionID string, placed, now time.Time) error {
+	player, ok := e.Players[playerID]
+	if !ok {
+		return ErrNotPlaying
+	}
+	if !player.Active {
+		return errors.New("you have been eliminated and can only watch")
+	}
+	return e.checkTiming(questionID, placed, now)
+}
+
+// BetReceipt is what placing or cancelling a bet changed
+type BetReceipt struct {
+	Stake    TokenUnits
+	Refund   TokenUnits // stake of the bet it replaced or cancelled
+	Replaced bool
+	Balance  TokenUnits
+}
+
+// Bet places a bet, or replaces the player's earlier bet on the same
+// question. The earlier stake is refunded in the same step, so the balance
+// only ever reflects the latest bet.
+func (e *Engine) Bet(bet Bet, now time.Time) (BetReceipt, error) {
+	if err := e.CheckBet(bet.PlayerID, bet.QuestionID, bet.Placed, now); err != nil {
+		return BetReceipt{}, err
+	}
+	receipt := BetReceipt{}
+	for _, stake := range bet.Stakes {
+		if stake < 0 {
+			return receipt, errors.New("bets must not be negative")
+		}
+		receipt.Stake += stake
+	}
+
+	previous, replacing := e.Bets[bet.PlayerID]
+	if replacing {
+		receipt.Refund = previous.Total()
+		receipt.Replaced = true
+	}
+
+	player := e.Players[bet.PlayerID]
+	balance := player.Tokens + receipt.Refund
+	if receipt.Stake > balance {
+		return receipt, fmt.Errorf("insufficient tokens (has %.2f, tried to bet %.2f)", balance.Tokens(), receipt.Stake.Tokens())
+	}
+	player.Tokens = balance - receipt.Stake
+	player.Stakes = bet.Stakes
+	receipt.Balance = player.Tokens
+
+	e.Bets[bet.PlayerID] = bet
+	return receipt, nil
+}
+
+// Cancel withdraws a player's bet on the open question and refunds it
+func (e *Engine) Cancel(playerID, questionID string, placed, now time.Time) (BetReceipt, error) {
+	player, ok := e.Players[playerID]
+	if !ok || !player.Active {
+		return BetReceipt{}, ErrNotPlaying
+	}
+	if err := e.checkTiming(questionID, placed, now); err != nil {
+		return BetReceipt{}, err
+	}
+	previous, ok := e.Bets[playerID]
+	if !ok {
+		return BetReceipt{}, errors.New("no bet to cancel")
+	}
+
+	receipt := BetReceipt{Refund: previous.Total()}
+	player.Tokens += receipt.Refund
+	player.Stakes = nil
+	receipt.Balance = player.Tokens
+	delete(e.Bets, playerID)
+	return receipt, nil
+}
+
+// Pause stops the open question's clock
+func (e *Engine) Pause(now time.Time) error {
+	if e.State != StateQuestionOpen {
+		return ErrNoQuestion
+	}
+	if e.Paused {
+		return errors.New("question is already paused")
+	}
+	e.PausedRemaining = max(0, e.Deadline.Sub(now))
+	e.Paused = true
+	return nil
+}
+
+// Resume restarts a paused question's clock with the time it had left
+func (e *Engine) Resume(now time.Time) error {
+	if e.State != StateQuestionOpen {
+		return ErrNoQuestion
+	}
+	if !e.Paused {
+		return errors.New("question is not paused")
+	}
+	e.Paused = false
+	e.Deadline = now.Add(e.PausedRemaining)
+	return nil
+}
+
+// Extend gives the open question extra time
+func (e *Engine) Extend(extra time.Duration) error {
+	if e.State != StateQuestionOpen {
+		return ErrNoQuestion
+	}
+	if extra <= 0 {
+		return errors.New("seconds must be positive")
+	}
+	if e.Paused {
+		e.PausedRemaining += extra
+	} else {
+		e.Deadline = e.Deadline.Add(extra)
+	}
+	return nil
+}
+
+// EndQuestion brings the open question's deadline forward to now
+func (e *Engine) EndQuestion(now time.Time) error {
+	if e.State != StateQuestionOpen {
+		return ErrNoQuestion
+	}
+	e.Paused = false
+	e.Deadline = now
+	return nil
+}
+
+// Close stops taking bets on the open question once its deadline has passed.
+// It reports false while the question is paused or has time left, and once
+// it has closed.
+func (e *Engine) Close(now time.Time) bool {
+	if e.State != StateQuestionOpen {
+		return false
+	}
+	if e.Paused || now.Before(e.Deadline) {
+		return false
+	}
+	e.State = StateSettling
+	return true
+}
+
+// Void cancels the open question without scoring it and refunds every bet.
+// It returns each player's refund.
+func (e *Engine) Void() (map[string]TokenUnits, error) {
+	if e.State != StateQuestionOpen {
+		return nil, ErrNoQuestion
+	}
+
+	refunds := make(map[string]TokenUnits, len(e.Bets))
+	for playerID, bet := range e.Bets {
+		player, ok := e.Players[playerID]
+		if !ok {
+			continue
+		}
+		refund := bet.Total()
+		player.Tokens += refund
+		player.Stakes = nil
+		refunds[playerID] = refund
+	}
+
+	e.Bets = make(map[string]Bet)
+	e.QuestionID = ""
+	e.Paused = false
+	e.State = StateWaiting
+	return refunds, nil
+}
+
+// Result is one player's outcome on a settled question
+type Result struct {
+	Won          bool
+	Returned     TokenUnits
+	Lost         TokenUnits
+	Balance      TokenUnits
+	PointsEarned float64    // points mode
+	Points       float64    // points mode
+	Lives        int        // lives mode
+	Odds         float64    // parimutuel: tokens paid per token on the correct option
+	Winnings     TokenUnits // parimutuel: share of the wrong pool
+}
+
+// Settlement is the outcome of scoring a question
+type Settlement struct {
+	Results      map[string]Result // playerID -> result, for every player who was still in
+	Eliminated   []string
+	Remaining    int
+	Jackpot      TokenUnits // after the question's losses, before any payout
+	Rake         TokenUnits // parimutuel: kept by the house
+	Odds         float64    // parimutuel
+	Ended        bool
+	WinnerID     string
+	HouseJackpot TokenUnits // kept by the house when the game ended without a winner
+}
+
+// Settle scores the closed question with each bet's grade. The game goes on
+// to the review, or waits for the next question; a game that is over stays
+// settling until Finish.
+func (e *Engine) Settle(grades map[string]Grade) (Settlement, error) {
+	if err := e.require("settle", StateSettling); err != nil {
+		return Settlement{}, err
+	}
+
+	settlement := Settlement{
+		Results:    make(map[string]Result),
+		Eliminated: make([]string, 0),
+	}
+	outcome := e.Scoring.Score(&ScoringRound{
+		Opened:        e.Opened,
+		Limit:         e.Limit,
+		Players:       e.Players,
+		Bets:          e.Bets,
+		Grades:        grades,
+		Settlement:    &settlement,
+		Jackpot:       &e.Jackpot,
+		JackpotShares: e.JackpotShares,
+	})
+	e.QuestionsPlayed++
+
+	// Stop after max_questions; the mode's leader takes the jackpot
+	if !outcome.Ended && e.MaxQuestions > 0 && e.QuestionsPlayed >= e.MaxQuestions {
+		outcome = RoundOutcome{Ended: true, Winner: e.Scoring.Leader(e.Players)}
+	}
+	settlement.Remaining = e.Remaining()
+	settlement.Jackpot = e.Jackpot
+	settlement.Ended = outcome.Ended
+
+	if winner := outcome.Winner; winner != nil {
+		winner.Tokens += e.Jackpot
+		settlement.WinnerID = winner.ID
+
+		result := settlement.Results[winner.ID]
+		result.Won = true
+		result.Returned += e.Jackpot
+		result.Balance = winner.Tokens
+		settlement.Results[winner.ID] = result
+		e.clearJackpot()
+	} else if outcome.Ended {
+		settlement.HouseJackpot = e.Jackpot
+		e.clearJackpot()
+	}
+
+	e.QuestionID = ""
+	switch {
+	case settlement.Ended:
+	case e.Reviews:
+		e.State = StateReview
+	default:
+		e.State = StateWaiting
+	}
+	return settlement, nil
+}
+
+// EndReview moves on from the review to wait for the next question
+func (e *Engine) EndReview() error {
+	if e.State != StateReview {
+		return errors.New("no review is showing")
+	}
+	e.State = StateWaiting
+	return nil
+}
+
+// ReleaseJackpot pays the jackpot out of a game the host is ending: refunded
+// to the players who lost it, in proportion, or with distribute split evenly
+// between the players still in. Shares owed to players who already left go
+// to the house, which it returns with each player's payout.
+func (e *Engine) ReleaseJackpot(distribute bool) (map[string]TokenUnits, TokenUnits) {
+	shares := make(map[string]TokenUnits)
+	pool := TokenUnits(0)
+	for playerID, share := range e.JackpotShares {
+		if _, ok := e.Players[playerID]; ok {
+			shares[playerID] = share
+			pool += share
+		}
+	}
+	if distribute {
+		active := make(map[string]TokenUnits)
+		for playerID, player := range e.Players {
+			if player.Active {
+				active[playerID] = 1
+			}
+		}
+		// With nobody left in, it falls back to a refund
+		if len(active) > 0 {
+			shares, pool = active, e.Jackpot
+		}
+	}
+
+	house := e.Jackpot
+	payouts := SplitPool(min(pool, house), shares)
+	for playerID, amount := range payouts {
+		e.Players[playerID].Tokens += amount
+		house -= amount
+	}
+	e.clearJackpot()
+	return payouts, house
+}
+
+func (e *Engine) clearJackpot() {
+	e.Jackpot = 0
+	e.JackpotShares = make(map[string]TokenUnits)
+}
+
+// Finish ends the game
+func (e *Engine) Finish(now time.Time) error {
+	if e.State == StateEnded {
+		return &StateError{Event: "finish", State: StateEnded}
+	}
+	e.EndedAt = now
+	e.State = StateEnded
+	return nil
+}
+
+// InFlight is each player's stake on the open question, owed back to them if
+// the game stops before it is scored
+func (e *Engine) InFlight() map[string]TokenUnits {
+	inFlight := make(map[string]TokenUnits)
+	if e.State != StateQuestionOpen {
+		return inFlight
+	}
+	for playerID, bet := range e.Bets {
+		inFlight[playerID] = bet.Total()
+	}
+	return inFlight
+}
@@ -0,0 +1,439 @@
+package quizengine
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// tokens is n whole tokens in units
+func tokens(n int64) TokenUnits {
+	return TokenUnits(n * TokenScale)
+}
+
+// newGame seats players a second apart with a buy-in of 100 and starts the game
+func newGame(t *testing.T, scoring ScoringMode, maxQuestions int, players ...string) *Engine {
+	t.Helper()
+	e := New(tokens(100), 0, false)
+	e.Scoring = scoring
+	e.MaxQuestions = maxQuestions
+	for i, id := range players {
+		if _, err := e.Join(id, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("join %s: %v", id, err)
+		}
+	}
+	if err := e.Start(start); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return e
+}
+
+// play opens a 30 second question, places each player's bet as a stake on
+// the correct option and one on a wrong one, and settles it
+func play(t *testing.T, e *Engine, bets map[string]Grade) Settlement {
+	t.Helper()
+	questionID := "q" + string(rune('1'+e.QuestionsPlayed))
+	opened := start.Add(time.Minute * time.Duration(e.QuestionsPlayed+1))
+	if ok, err := e.Open(questionID, 30*time.Second, opened); !ok || err != nil {
+		t.Fatalf("open %s: %v, %v", questionID, ok, err)
+	}
+	for playerID, grade := range bets {
+		bet := Bet{
+			PlayerID:   playerID,
+			QuestionID: questionID,
+			Stakes:     []TokenUnits{grade.Correct, grade.Wrong},
+			Placed:     opened.Add(3 * time.Second),
+		}
+		if _, err := e.Bet(bet, bet.Placed); err != nil {
+			t.Fatalf("bet for %s: %v", playerID, err)
+		}
+	}
+	if !e.Close(opened.Add(30 * time.Second)) {
+		t.Fatalf("close %s: still open", questionID)
+	}
+	settlement, err := e.Settle(bets)
+	if err != nil {
+		t.Fatalf("settle %s: %v", questionID, err)
+	}
+	return settlement
+}
+
+func TestElimination(t *testing.T) {
+	tests := []struct {
+		name       string
+		bets       map[string]Grade
+		eliminated []string
+		balances   map[string]TokenUnits
+		ended      bool
+		winner     string
+	}{
+		{
+			name: "correct stakes survive",
+			bets: map[string]Grade{
+				"a": {Correct: tokens(20), Wrong: tokens(10)},
+				"b": {Correct: tokens(50)},
+				"c": {Wrong: tokens(40)},
+			},
+			eliminated: []string{"c"},
+			balances:   map[string]TokenUnits{"a": tokens(90), "b": tokens(100), "c": tokens(60)},
+		},
+		{
+			name: "sitting a question out is elimination",
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10)},
+				"b": {Correct: tokens(10)},
+			},
+			eliminated: []string{"c"},
+			balances:   map[string]TokenUnits{"a": tokens(100), "b": tokens(100), "c": tokens(100)},
+		},
+		{
+			name: "last player standing wins the jackpot",
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10)},
+				"b": {Wrong: tokens(40)},
+				"c": {Wrong: tokens(25)},
+			},
+			eliminated: []string{"b", "c"},
+			balances:   map[string]TokenUnits{"a": tokens(165), "b": tokens(60), "c": tokens(75)},
+			ended:      true,
+			winner:     "a",
+		},
+		{
+			name: "nobody left means the house wins",
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(10)},
+				"b": {Wrong: tokens(20)},
+			},
+			eliminated: []string{"a", "b", "c"},
+			balances:   map[string]TokenUnits{"a": tokens(90), "b": tokens(80), "c": tokens(100)},
+			ended:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newGame(t, EliminationMode{}, 0, "a", "b", "c")
+			settlement := play(t, e, tt.bets)
+
+			if len(settlement.Eliminated) != len(tt.eliminated) {
+				t.Fatalf("eliminated %v, want %v", settlement.Eliminated, tt.eliminated)
+			}
+			for _, id := range tt.eliminated {
+				if e.Players[id].Active {
+					t.Errorf("%s is still active", id)
+				}
+			}
+			for id, want := range tt.balances {
+				if got := e.Players[id].Tokens; got != want {
+					t.Errorf("%s has %d units, want %d", id, got, want)
+				}
+			}
+			if settlement.Ended != tt.ended || settlement.WinnerID != tt.winner {
+				t.Errorf("ended %v with winner %q, want %v with %q", settlement.Ended, settlement.WinnerID, tt.ended, tt.winner)
+			}
+			if settlement.Remaining != e.Remaining() {
+				t.Errorf("settlement counts %d remaining, engine %d", settlement.Remaining, e.Remaining())
+			}
+		})
+	}
+}
+
+func TestJackpot(t *testing.T) {
+	tests := []struct {
+		name    string
+		scoring ScoringMode
+		bets    map[string]Grade
+		jackpot TokenUnits            // left in the jackpot after the question
+		shares  map[string]TokenUnits // fed by each player
+		house   TokenUnits            // kept by the house at the end
+		won     TokenUnits            // paid to the winner on top of their returns
+	}{
+		{
+			name:    "elimination feeds wrong stakes",
+			scoring: EliminationMode{},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10), Wrong: tokens(5)},
+				"b": {Correct: tokens(10), Wrong: tokens(15)},
+				"c": {Wrong: tokens(30)},
+			},
+			jackpot: tokens(50),
+			shares:  map[string]TokenUnits{"a": tokens(5), "b": tokens(15), "c": tokens(30)},
+		},
+		{
+			name:    "lives keep players in but still feed the jackpot",
+			scoring: LivesMode{Lives: 2},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(10)},
+				"b": {Wrong: tokens(20)},
+				"c": {Correct: tokens(5), Wrong: tokens(5)},
+			},
+			jackpot: tokens(35),
+			shares:  map[string]TokenUnits{"a": tokens(10), "b": tokens(20), "c": tokens(5)},
+		},
+		{
+			name:    "parimutuel with a winner pays the wrong pool out instead",
+			scoring: ParimutuelMode{Rake: 0.1},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10)},
+				"b": {Wrong: tokens(30)},
+			},
+			jackpot: 0,
+			shares:  map[string]TokenUnits{},
+		},
+		{
+			name:    "parimutuel with nobody right feeds the whole wrong pool",
+			scoring: ParimutuelMode{Rake: 0.1},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(10)},
+				"b": {Wrong: tokens(30)},
+			},
+			jackpot: tokens(40),
+			shares:  map[string]TokenUnits{"a": tokens(10), "b": tokens(30)},
+		},
+		{
+			name:    "the last player standing takes the jackpot",
+			scoring: EliminationMode{},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10), Wrong: tokens(10)},
+				"b": {Wrong: tokens(30)},
+			},
+			won: tokens(40),
+		},
+		{
+			name:    "the house keeps the jackpot when everyone is out",
+			scoring: EliminationMode{},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(10)},
+				"b": {Wrong: tokens(30)},
+			},
+			house: tokens(40),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players := []string{"a", "b"}
+			if len(tt.bets) == 3 {
+				players = append(players, "c")
+			}
+			e := newGame(t, tt.scoring, 0, players...)
+			settlement := play(t, e, tt.bets)
+
+			if e.Jackpot != tt.jackpot {
+				t.Errorf("jackpot is %d units, want %d", e.Jackpot, tt.jackpot)
+			}
+			if settlement.HouseJackpot != tt.house {
+				t.Errorf("house kept %d units, want %d", settlement.HouseJackpot, tt.house)
+			}
+			if tt.shares != nil {
+				if len(e.JackpotShares) != len(tt.shares) {
+					t.Errorf("jackpot shares %v, want %v", e.JackpotShares, tt.shares)
+				}
+				for id, want := range tt.shares {
+					if got := e.JackpotShares[id]; got != want {
+						t.Errorf("%s fed %d units, want %d", id, got, want)
+					}
+				}
+			}
+			if tt.won > 0 {
+				winner := settlement.Results[settlement.WinnerID]
+				if settlement.WinnerID == "" || winner.Returned != tt.won+tt.bets[settlement.WinnerID].Correct {
+					t.Errorf("winner %q returned %d units, want the jackpot of %d on top", settlement.WinnerID, winner.Returned, tt.won)
+				}
+				if winner.Balance != e.Players[settlement.WinnerID].Tokens {
+					t.Errorf("winner's result shows %d units, engine has %d", winner.Balance, e.Players[settlement.WinnerID].Tokens)
+				}
+			}
+
+			// Every unit bought in is held by a player, the jackpot or the house
+			held := e.Jackpot + settlement.HouseJackpot + settlement.Rake
+			for _, player := range e.Players {
+				held += player.Tokens
+			}
+			if want := tokens(100) * TokenUnits(len(players)); held != want {
+				t.Errorf("%d units accounted for, want %d", held, want)
+			}
+		})
+	}
+}
+
+func TestReleaseJackpot(t *testing.T) {
+	tests := []struct {
+		name       string
+		distribute bool
+		kick       string
+		payouts    map[string]TokenUnits
+		house      TokenUnits
+	}{
+		{
+			name:    "refund in proportion to what each lost",
+			payouts: map[string]TokenUnits{"a": tokens(10), "b": tokens(30)},
+		},
+		{
+			name:       "distribute evenly between the players still in",
+			distribute: true,
+			payouts:    map[string]TokenUnits{"a": tokens(20), "c": tokens(20)},
+		},
+		{
+			name:    "a departed player's share goes to the house",
+			kick:    "b",
+			payouts: map[string]TokenUnits{"a": tokens(10)},
+			house:   tokens(30),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newGame(t, LivesMode{Lives: 1}, 0, "a", "b", "c")
+			play(t, e, map[string]Grade{
+				"a": {Correct: tokens(10), Wrong: tokens(10)},
+				"b": {Wrong: tokens(30)},
+				"c": {Correct: tokens(10)},
+			})
+			if tt.kick != "" {
+				if _, _, err := e.Remove(tt.kick); err != nil {
+					t.Fatalf("remove %s: %v", tt.kick, err)
+				}
+			}
+
+			before := make(map[string]TokenUnits)
+			for id, player := range e.Players {
+				before[id] = player.Tokens
+			}
+			payouts, house := e.ReleaseJackpot(tt.distribute)
+
+			if house != tt.house {
+				t.Errorf("house kept %d units, want %d", house, tt.house)
+			}
+			if len(payouts) != len(tt.payouts) {
+				t.Errorf("payouts %v, want %v", payouts, tt.payouts)
+			}
+			for id, want := range tt.payouts {
+				if payouts[id] != want {
+					t.Errorf("%s was paid %d units, want %d", id, payouts[id], want)
+				}
+				if got := e.Players[id].Tokens - before[id]; got != want {
+					t.Errorf("%s's balance rose %d units, want %d", id, got, want)
+				}
+			}
+			if e.Jackpot != 0 || len(e.JackpotShares) != 0 {
+				t.Errorf("jackpot left at %d units with shares %v", e.Jackpot, e.JackpotShares)
+			}
+		})
+	}
+}
+
+// TestJoin checks a new player is only seated in the lobby, while a seated
+// player can rejoin a game that has ended to see the results
+func TestJoin(t *testing.T) {
+	e := newGame(t, EliminationMode{}, 0, "a", "b")
+	if _, err := e.Join("late", start.Add(10*time.Second)); err == nil {
+		t.Error("a new player joined a running game")
+	}
+
+	play(t, e, map[string]Grade{"a": {Correct: tokens(10)}, "b": {Wrong: tokens(10)}})
+	if err := e.Finish(start.Add(time.Hour)); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if _, err := e.Join("late", start.Add(2*time.Hour)); err == nil {
+		t.Error("a new player joined a game that has ended")
+	}
+	if _, ok := e.Players["late"]; ok {
+		t.Error("a refused player was seated")
+	}
+	if rejoined, err := e.Join("a", start.Add(2*time.Hour)); !rejoined || err != nil {
+		t.Errorf("seated player rejoining the ended game: %v, %v", rejoined, err)
+	}
+}
+
+func TestWinnerSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		scoring ScoringMode
+		bets    map[string]Grade
+		winner  string
+	}{
+		{
+			name:    "elimination: most tokens",
+			scoring: EliminationMode{},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10), Wrong: tokens(20)},
+				"b": {Correct: tokens(10)},
+			},
+			winner: "b",
+		},
+		{
+			name:    "elimination: a tie goes to the first to join",
+			scoring: EliminationMode{},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10)},
+				"b": {Correct: tokens(10)},
+			},
+			winner: "a",
+		},
+		{
+			name:    "points: highest score",
+			scoring: PointsMode{PerAnswer: 100, SpeedBonus: 50},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(50)},
+				"b": {Correct: tokens(5)},
+			},
+			winner: "b",
+		},
+		{
+			name:    "points: a tie goes to the first to join",
+			scoring: PointsMode{PerAnswer: 100},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10)},
+				"b": {Correct: tokens(10)},
+			},
+			winner: "a",
+		},
+		{
+			name:    "lives: most lives left",
+			scoring: LivesMode{Lives: 3},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(1)},
+				"b": {Correct: tokens(1), Wrong: tokens(50)},
+			},
+			winner: "b",
+		},
+		{
+			name:    "lives: a tie goes to the most tokens",
+			scoring: LivesMode{Lives: 3},
+			bets: map[string]Grade{
+				"a": {Correct: tokens(10), Wrong: tokens(5)},
+				"b": {Correct: tokens(10)},
+			},
+			winner: "b",
+		},
+		{
+			name:    "parimutuel: most tokens",
+			scoring: ParimutuelMode{},
+			bets: map[string]Grade{
+				"a": {Wrong: tokens(10)},
+				"b": {Correct: tokens(10)},
+			},
+			winner: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One question, so the mode's leader wins when it ends
+			e := newGame(t, tt.scoring, 1, "a", "b")
+			settlement := play(t, e, tt.bets)
+
+			if !settlement.Ended {
+				t.Fatal("game didn't end after max_questions")
+			}
+			if settlement.WinnerID != tt.winner {
+				t.Errorf("winner %q, want %q", settlement.WinnerID, tt.winner)
+			}
+			if !settlement.Results[tt.winner].Won {
+				t.Errorf("winner's result isn't marked won")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package quizengine
+
+import "time"
+
+// Scoring mode names
+const (
+	ScoringElimination = "elimination"
+	ScoringPoints      = "points"
+	ScoringParimutuel  = "parimutuel"
+	ScoringLives       = "lives"
+)
+
+// ScoringRound is everything a scoring mode needs to settle one question
+type ScoringRound struct {
+	Opened        time.Time     // when the question opened
+	Limit         time.Duration // its time limit, for the speed bonus
+	Players       map[string]*Player
+	Bets          map[string]Bet
+	Grades        map[string]Grade
+	Settlement    *Settlement
+	Jackpot       *TokenUnits
+	JackpotShares map[string]TokenUnits
+}
+
+// feedJackpot moves a stake a player lost into the jackpot
+func (r *ScoringRound) feedJackpot(playerID string, stake TokenUnits) {
+	if stake <= 0 {
+		return
+	}
+	*r.Jackpot += stake
+	r.JackpotShares[playerID] += stake
+}
+
+// eliminate knocks player out of the game
+func (r *ScoringRound) eliminate(player *Player) {
+	player.Active = false
+	r.Settlement.Eliminated = append(r.Settlement.Eliminated, player.ID)
+}
+
+// RoundOutcome tells the engine whether the game is over and who won. A nil
+// Winner on an ended game means the house keeps the jackpot.
+type RoundOutcome struct {
+	Ended  bool
+	Winner *Player
+}
+
+// ScoringMode settles each question's bets and decides when the game ends
+type ScoringMode interface {
+	Name() string
+	// Join sets up a player joining for the first time
+	Join(player *Player)
+	// Score pays out a question, filling in a Result for every active player
+	Score(round *ScoringRound) RoundOutcome
+	// Leader is the winner when the game stops before the mode ends it
+	Leader(players map[string]*Player) *Player
+}
+
+// lastStanding ends the game when at most one player is still active
+func lastStanding(players map[string]*Player) RoundOutcome {
+	remaining := 0
+	var last *Player
+	for _, player := range players {
+		if player.Active {
+			remaining++
+			last = player
+		}
+	}
+	switch remaining {
+	case 0:
+		return RoundOutcome{Ended: true}
+	case 1:
+		return RoundOutcome{Ended: true, Winner: last}
+	}
+	return RoundOutcome{}
+}
+
+// richestActive picks the active player with the most tokens. Ties go to the
+// player who joined first.
+func richestActive(players map[string]*Player) *Player {
+	var leader *Player
+	for _, player := range players {
+		if !player.Active {
+			continue
+		}
+		if leader == nil || player.Tokens > leader.Tokens ||
+			(player.Tokens == leader.Tokens && player.JoinedAt.Before(leader.JoinedAt)) {
+			leader = player
+		}
+	}
+	return leader
+}
+
+// EliminationMode is sudden death: a player without tokens on the correct
+// option is out. Wrong stakes feed the jackpot, which goes to the last player
+// standing.
+type EliminationMode struct{}
+
+func (EliminationMode) Name() string { return ScoringElimination }
+
+func (EliminationMode) Join(player *Player) {}
+
+func (EliminationMode) Score(round *ScoringRound) RoundOutcome {
+	for playerID, player := range round.Players {
+		if !player.Active {
+			continue
+		}
+
+		grade := round.Grades[playerID]
+		round.feedJackpot(playerID, grade.Wrong)
+		if grade.Correct == 0 {
+			// All their money goes to jackpot
+			round.eliminate(player)
+		} else {
+			// Player survives - return correct bet, jackpot gets wrong bets
+			player.Tokens += grade.Correct
+		}
+
+		round.Settlement.Results[playerID] = Result{
+			Won:      grade.Correct > 0,
+			Returned: grade.Correct,
+			Lost:     grade.Wrong,
+			Balance:  player.Tokens,
+		}
+	}
+	return lastStanding(round.Players)
+}
+
+func (EliminationMode) Leader(players map[string]*Player) *Player {
+	return richestActive(players)
+}
+
+// PointsMode never knocks anyone out. Every stake is returned; the share
+// placed on the correct option earns points, plus a bonus for answering
+// quickly. The highest score after the last question wins.
+type PointsMode struct {
+	PerAnswer  float64
+	SpeedBonus float64 // for a bet placed the instant the question opens
+}
+
+func (PointsMode) Name() string { return ScoringPoints }
+
+func (PointsMode) Join(player *Player) {}
+
+func (m PointsMode) Score(round *ScoringRound) RoundOutcome {
+	for playerID, player := range round.Players {
+		if !player.Active {
+			continue
+		}
+
+		grade := round.Grades[playerID]
+		player.Tokens += grade.Correct + grade.Wrong
+
+		earned := 0.0
+		if grade.Correct > 0 {
+			share := float64(grade.Correct) / float64(grade.Correct+grade.Wrong)
+			remaining := 1 - float64(round.Bets[playerID].Placed.Sub(round.Opened))/float64(round.Limit)
+			remaining = max(0, min(1, remaining))
+			earned = share * (m.PerAnswer + m.SpeedBonus*remaining)
+			player.Points += earned
+		}
+
+		round.Settlement.Results[playerID] = Result{
+			Won:          grade.Correct > 0,
+			Returned:     grade.Correct + grade.Wrong,
+			Balance:      player.Tokens,
+			PointsEarned: earned,
+			Points:       player.Points,
+		}
+	}
+	return RoundOutcome{}
+}
+
+// Leader is the highest score, then the most tokens, then the earliest joiner
+func (PointsMode) Leader(players map[string]*Player) *Player {
+	var leader *Player
+	for _, player := range players {
+		if !player.Active {
+			continue
+		}
+		if leader == nil || player.Points > leader.Points ||
+			(player.Points == leader.Points && player.Tokens > leader.Tokens) ||
+			(player.Points == leader.Points && player.Tokens == leader.Tokens && player.JoinedAt.Before(leader.JoinedAt)) {
+			leader = player
+		}
+	}
+	return leader
+}
+
+// ParimutuelMode pools each question's stakes: after the house rake, the
+// wrong pool is split among the correct bettors in proportion to their stakes
+// on the correct option. If nobody was right the whole wrong pool goes to the
+// jackpot. A player who runs out of tokens is out, and the last player with
+// tokens takes the jackpot.
+type ParimutuelMode struct {
+	Rake float64 // share of the wrong pool kept by the house
+}
+
+func (ParimutuelMode) Name() string { return ScoringParimutuel }
+
+func (ParimutuelMode) Join(player *Player) {}
+
+func (m ParimutuelMode) Score(round *ScoringRound) RoundOutcome {
+	stakes := make(map[string]TokenUnits)
+	lost := make(map[string]TokenUnits)
+	correctPool, wrongPool := TokenUnits(0), TokenUnits(0)
+	for playerID, player := range round.Players {
+		if !player.Active {
+			continue
+		}
+		grade := round.Grades[playerID]
+		if grade.Correct > 0 {
+			stakes[playerID] = grade.Correct
+			correctPool += grade.Correct
+		}
+		wrongPool += grade.Wrong
+		lost[playerID] = grade.Wrong
+	}
+
+	rake, winnings := TokenUnits(0), TokenUnits(0)
+	odds := 0.0
+	if correctPool == 0 {
+		for playerID, amount := range lost {
+			round.feedJackpot(playerID, amount)
+		}
+	} else {
+		rake, _ = wrongPool.MulDiv(ToUnits(m.Rake), TokenScale)
+		winnings = wrongPool - rake
+		odds = float64(correctPool+winnings) / float64(correctPool)
+	}
+	shares := SplitPool(winnings, stakes)
+	round.Settlement.Rake = rake
+	round.Settlement.Odds = odds
+
+	for playerID, player := range round.Players {
+		if !player.Active {
+			continue
+		}
+
+		stake, won := stakes[playerID]
+		payout := stake + shares[playerID]
+		player.Tokens += payout
+		if player.Tokens <= 0 {
+			round.eliminate(player)
+		}
+
+		result := Result{
+			Won:      won,
+			Returned: payout,
+			Lost:     lost[playerID],
+			Balance:  player.Tokens,
+		}
+		if won {
+			result.Odds = odds
+			result.Winnings = shares[playerID]
+		}
+		round.Settlement.Results[playerID] = result
+	}
+	return lastStanding(round.Players)
+}
+
+func (ParimutuelMode) Leader(players map[string]*Player) *Player {
+	return richestActive(players)
+}
+
+// LivesMode is elimination with strikes: missing the correct option costs a
+// life instead of the game, and a player is out when their lives run out.
+type LivesMode struct {
+	Lives int
+}
+
+func (LivesMode) Name() string { return ScoringLives }
+
+func (m LivesMode) Join(player *Player) {
+	player.Lives = m.Lives
+}
+
+func (LivesMode) Score(round *ScoringRound) RoundOutcome {
+	for playerID, player := range round.Players {
+		if !player.Active {
+			continue
+		}
+
+		grade := round.Grades[playerID]
+		round.feedJackpot(playerID, grade.Wrong)
+		player.Tokens += grade.Correct
+		if grade.Correct == 0 {
+			player.Lives--
+			if player.Lives <= 0 {
+				round.eliminate(player)
+			}
+		}
+
+		round.Settlement.Results[playerID] = Result{
+			Won:      grade.Correct > 0,
+			Returned: grade.Correct,
+			Lost:     grade.Wrong,
+			Balance:  player.Tokens,
+			Lives:    player.Lives,
+		}
+	}
+	return lastStanding(round.Players)
+}
+
+// Leader is the player with the most lives left, then the most tokens
+func (LivesMode) Leader(players map[string]*Player) *Player {
+	var leader *Player
+	for _, player := range players {
+		if !player.Active {
+			continue
+		}
+		if leader == nil || player.Lives > leader.Lives ||
+			(player.Lives == leader.Lives && player.Tokens > leader.Tokens) {
+			leader = player
+		}
+	}
+	return leader
+}
@@ -0,0 +1,76 @@
+package quizengine
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// TokenScale is how many TokenUnits make one quiz token
+const TokenScale = 1_000_000
+
+// TokenUnits are quiz tokens in millionths. Pools are split in units so the
+// payouts add up to exactly what was staked, the way SOL amounts are handled
+// in lamports.
+type TokenUnits int64
+
+// ToUnits rounds a token amount to the nearest unit
+func ToUnits(tokens float64) TokenUnits {
+	return TokenUnits(math.Round(tokens * TokenScale))
+}
+
+// Tokens converts units back to a token amount
+func (u TokenUnits) Tokens() float64 {
+	return float64(u) / TokenScale
+}
+
+// MulDiv returns u*num/den rounded down and the remainder, without overflowing
+func (u TokenUnits) MulDiv(num, den TokenUnits) (TokenUnits, TokenUnits) {
+	product := new(big.Int).Mul(big.NewInt(int64(u)), big.NewInt(int64(num)))
+	quotient, remainder := product.QuoRem(product, big.NewInt(int64(den)), new(big.Int))
+	return TokenUnits(quotient.Int64()), TokenUnits(remainder.Int64())
+}
+
+// SplitPool shares pool between stakes in proportion to their size. Shares
+// are rounded down and the leftover units go one each to the largest
+// remainders, so the shares always sum to pool.
+func SplitPool(pool TokenUnits, stakes map[string]TokenUnits) map[string]TokenUnits {
+	total := TokenUnits(0)
+	for _, stake := range stakes {
+		total += stake
+	}
+	shares := make(map[string]TokenUnits, len(stakes))
+	if total <= 0 || pool <= 0 {
+		return shares
+	}
+
+	type share struct {
+		id        string
+		stake     TokenUnits
+		remainder TokenUnits
+	}
+	order := make([]share, 0, len(stakes))
+	leftover := pool
+	for id, stake := range stakes {
+		amount, remainder := pool.MulDiv(stake, total)
+		shares[id] = amount
+		leftover -= amount
+		order = append(order, share{id, stake, remainder})
+	}
+
+	// Ties go to the larger stake, then by ID so the split is repeatable
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].remainder != order[j].remainder {
+			return order[i].remainder > order[j].remainder
+		}
+		if order[i].stake != order[j].stake {
+			return order[i].stake > order[j].stake
+		}
+		return order[i].id < order[j].id
+	})
+	for i := 0; leftover > 0; i++ {
+		shares[order[i%len(order)].id]++
+		leftover--
+	}
+	return shares
+}
@@ -9,6 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"example.com/m/backend/pkg/user"
+	"github.com/dilyxs/medMarket/auth"
+	"github.com/dilyxs/medMarket/config"
 	"github.com/dilyxs/medMarket/pkg"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gorilla/mux"
@@ -17,10 +20,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-const (
-	LAMPORTS_PER_SOL = 1_000_000_000
-	WITHDRAWAL_FEE   = 0.00005 // SOL
-)
+const LAMPORTS_PER_SOL = 1_000_000_000
 
 // DepositRequest represents a deposit request
 type DepositRequest struct {
@@ -112,7 +112,9 @@ func HandleDeposit(w http.ResponseWriter, r *http.Request, usersCollection *mong
 
 // HandleWithdraw handles withdrawal requests
 // POST /api/withdraw - creates and broadcasts a withdrawal transaction
-func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mongo.Collection) {
+func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mongo.Collection, cfg config.Config) {
+	withdrawalFee := cfg.Solana.WithdrawalFee
+
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
@@ -120,10 +122,16 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 		return
 	}
 
+	sessionUser, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
 	// Parse request
 	type WithdrawRequest struct {
-		UserID    string `json:"user_id"`
-		Amount    string `json:"amount"` // in SOL
+		UserID    string `json:"user_id"` // ignored if it differs from the session user
+		Amount    string `json:"amount"`  // in SOL
 		ToAddress string `json:"to_address"`
 	}
 
@@ -156,11 +164,16 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 	}
 
 	// Get user balance from Mongo
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.Mongo.RequestTimeout)
 	defer cancel()
 
+	if req.UserID != "" && req.UserID != sessionUser.UserID {
+		http.Error(w, `{"error": "user_id does not match session"}`, http.StatusForbidden)
+		return
+	}
+
 	// Convert user ID from string to ObjectId
-	userObjectID, err := primitive.ObjectIDFromHex(req.UserID)
+	userObjectID, err := primitive.ObjectIDFromHex(sessionUser.UserID)
 	if err != nil {
 		http.Error(w, `{"error": "invalid user id"}`, http.StatusBadRequest)
 		return
@@ -179,11 +192,11 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 	}
 
 	// Include fee in total amount required
-	totalDebit := amount + WITHDRAWAL_FEE
+	totalDebit := amount + withdrawalFee
 
 	// Check sufficient balance
 	if userBalance < totalDebit {
-		http.Error(w, fmt.Sprintf(`{"error": "insufficient balance. have %.4f, need %.4f (including %.4f fee)"}`, userBalance, totalDebit, WITHDRAWAL_FEE), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf(`{"error": "insufficient balance. have %.4f, need %.4f (including %.4f fee)"}`, userBalance, totalDebit, withdrawalFee), http.StatusBadRequest)
 		return
 	}
 
@@ -206,7 +219,7 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 				"address":    req.ToAddress,
 				"signature":  signature,
 				"timestamp":  time.Now(),
-				"fee":        WITHDRAWAL_FEE,
+				"fee":        withdrawalFee,
 			},
 		},
 	})
@@ -238,7 +251,7 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 	response := map[string]interface{}{
 		"status":      "pending",
 		"amount":      amount,
-		"fee":         WITHDRAWAL_FEE,
+		"fee":         withdrawalFee,
 		"to_address":  req.ToAddress,
 		"signature":   signature,
 		"new_balance": newBalance,
@@ -252,8 +265,8 @@ func HandleWithdraw(w http.ResponseWriter, r *http.Request, usersCollection *mon
 }
 
 // HandleUnlockAssistant handles payment for unlocking the AI assistant
-// POST /api/unlock-assistant - charges 0.4 SOL to unlock assistant
-func HandleUnlockAssistant(w http.ResponseWriter, r *http.Request, usersCollection *mongo.Collection) {
+// POST /api/unlock-assistant - charges solana.assistant_cost SOL to unlock assistant
+func HandleUnlockAssistant(w http.ResponseWriter, r *http.Request, usersCollection *mongo.Collection, cfg config.Config) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
@@ -261,43 +274,39 @@ func HandleUnlockAssistant(w http.ResponseWriter, r *http.Request, usersCollecti
 		return
 	}
 
-	type UnlockRequest struct {
-		UserID string `json:"user_id"`
-	}
-
-	var req UnlockRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error": "invalid request"}`, http.StatusBadRequest)
+	sessionUser, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "authentication required"}`, http.StatusUnauthorized)
 		return
 	}
 
-	const ASSISTANT_COST = 0.4
+	assistantCost := cfg.Solana.AssistantCost
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.Mongo.RequestTimeout)
 	defer cancel()
 
 	// Get user
-	var user bson.M
-	err := usersCollection.FindOne(ctx, bson.M{"_id": req.UserID}).Decode(&user)
+	var account bson.M
+	err := usersCollection.FindOne(ctx, user.Filter(sessionUser.UserID)).Decode(&account)
 	if err != nil {
 		http.Error(w, `{"error": "user not found"}`, http.StatusNotFound)
 		return
 	}
 
 	userBalance := 0.0
-	if balance, exists := user["balance"]; exists {
+	if balance, exists := account["balance"]; exists {
 		userBalance, _ = balance.(float64)
 	}
 
 	// Check sufficient balance
-	if userBalance < ASSISTANT_COST {
-		http.Error(w, fmt.Sprintf(`{"error": "insufficient balance. have %.4f SOL, need %.4f SOL"}`, userBalance, ASSISTANT_COST), http.StatusBadRequest)
+	if userBalance < assistantCost {
+		http.Error(w, fmt.Sprintf(`{"error": "insufficient balance. have %.4f SOL, need %.4f SOL"}`, userBalance, assistantCost), http.StatusBadRequest)
 		return
 	}
 
 	// Deduct payment
-	newBalance := userBalance - ASSISTANT_COST
-	_, err = usersCollection.UpdateOne(ctx, bson.M{"_id": req.UserID}, bson.M{
+	newBalance := userBalance - assistantCost
+	_, err = usersCollection.UpdateOne(ctx, user.Filter(sessionUser.UserID), bson.M{
 		"$set": bson.M{
 			"balance": newBalance,
 			"assistant_unlocked_at": time.Now(),
@@ -311,7 +320,7 @@ func HandleUnlockAssistant(w http.ResponseWriter, r *http.Request, usersCollecti
 
 	response := map[string]interface{}{
 		"status":      "unlocked",
-		"cost":        ASSISTANT_COST,
+		"cost":        assistantCost,
 		"new_balance": newBalance,
 		"message":     "Assistant unlocked! You can now use AI features.",
 	}
@@ -319,16 +328,16 @@ func HandleUnlockAssistant(w http.ResponseWriter, r *http.Request, usersCollecti
 }
 
 // RegisterSolanaRoutes registers Solana-related routes
-func RegisterSolanaRoutes(router *mux.Router, usersCollection *mongo.Collection) {
+func RegisterSolanaRoutes(router *mux.Router, usersCollection *mongo.Collection, cfg config.Config) {
 	router.HandleFunc("/api/deposit", func(w http.ResponseWriter, r *http.Request) {
 		HandleDeposit(w, r, usersCollection)
 	}).Methods(http.MethodGet, http.MethodPost)
 
-	router.HandleFunc("/api/withdraw", func(w http.ResponseWriter, r *http.Request) {
-		HandleWithdraw(w, r, usersCollection)
-	}).Methods(http.MethodPost)
+	router.HandleFunc("/api/withdraw", auth.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		HandleWithdraw(w, r, usersCollection, cfg)
+	})).Methods(http.MethodPost)
 
-	router.HandleFunc("/api/unlock-assistant", func(w http.ResponseWriter, r *http.Request) {
-		HandleUnlockAssistant(w, r, usersCollection)
-	}).Methods(http.MethodPost)
+	router.HandleFunc("/api/unlock-assistant", auth.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		HandleUnlockAssistant(w, r, usersCollection, cfg)
+	})).Methods(http.MethodPost)
 }
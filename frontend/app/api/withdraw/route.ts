@@ -1,6 +1,6 @@
 import { NextResponse } from "next/server";
 import { ObjectId } from "mongodb";
-import { getUserFromRequest } from "@/lib/auth";
+import { getSessionToken, getUserFromRequest } from "@/lib/auth";
 import { getDb } from "@/lib/mongo";
 
 export async function POST(request: Request) {
@@ -48,7 +48,11 @@ export async function POST(request: Request) {
     
     const solanaResponse = await fetch(`${backendUrl}/api/withdraw`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: {
+        'Content-Type': 'application/json',
+        // Backend verifies the same session token instead of trusting user_id
+        'Authorization': `Bearer ${getSessionToken(request)}`,
+      },
       body: JSON.stringify({
         user_id: userId.toString(),
         amount: amount.toString(),
@@ -14,6 +14,20 @@ interface Question {
   created_at: string;
 }
 
+interface PoolOption {
+  index: number;
+  total: number;
+  bettors: number;
+  odds: number;
+}
+
+interface PoolUpdate {
+  question_id: string;
+  total: number;
+  bettors: number;
+  options: PoolOption[];
+}
+
 interface QueuedQuestion extends Question {
   queue_position: number;
 }
@@ -25,10 +39,30 @@ export function QuizBroadcaster() {
   const [options, setOptions] = useState(["", ""]);
   const [correctIndex, setCorrectIndex] = useState(0);
   const [timeLimit, setTimeLimit] = useState(30);
+  const [questionType, setQuestionType] = useState<"choice" | "multi_select" | "numeric" | "hotspot">("choice");
+  const [correctIndices, setCorrectIndices] = useState<number[]>([]);
+  const [numeric, setNumeric] = useState({ min: "0", max: "100", unit: "", tolerance: "10", answer: "" });
+  const [imageUrl, setImageUrl] = useState("");
+  // Polygon from the segmentation output, e.g. [[120,80],[200,90],[160,170]]
+  const [regionPolygon, setRegionPolygon] = useState("");
+  // Attach the frame being broadcast when the question is submitted
+  const [explanation, setExplanation] = useState("");
+  const [referenceUrl, setReferenceUrl] = useState("");
+  // Question whose explanation and answer distribution players are looking at
+  const [reviewing, setReviewing] = useState<{ question_id: string; ends_at: number } | null>(null);
+  const [attachFrame, setAttachFrame] = useState(false);
+  const [attachRegions, setAttachRegions] = useState(false);
+  const [regionIndex, setRegionIndex] = useState("");
   const [queuedQuestions, setQueuedQuestions] = useState<QueuedQuestion[]>([]);
   const [isQuestionLive, setIsQuestionLive] = useState(false);
   const [gameEnded, setGameEnded] = useState(false);
   const [remainingPlayers, setRemainingPlayers] = useState(0);
+  const [phase, setPhase] = useState<"lobby" | "running" | "ended">("lobby");
+  const [pool, setPool] = useState<PoolUpdate | null>(null);
+  const [clock, setClock] = useState<{ remaining_ms: number; paused: boolean } | null>(null);
+  const [targetPlayer, setTargetPlayer] = useState("");
+  const [modReason, setModReason] = useState("");
+  const [adjustAmount, setAdjustAmount] = useState(0);
   const wsRef = useRef<WebSocket | null>(null);
 
   useEffect(() => {
@@ -45,16 +79,66 @@ export function QuizBroadcaster() {
         console.log("Broadcaster received:", data);
         
         switch (data.type) {
+          case "game_state":
+            setPhase(data.phase);
+            setRemainingPlayers(data.players || 0);
+            setGameEnded(data.phase === "ended");
+            // Games launched from a bank or playlist arrive with their queue filled
+            setQueuedQuestions((data.queued || []).map((q: Question, i: number) => ({ ...q, queue_position: i + 1 })));
+            setReviewing(data.review ?? null);
+            break;
+
+          case "game_started":
+            setPhase("running");
+            setRemainingPlayers(data.players || 0);
+            break;
+
           case "question_queued":
             setQueuedQuestions(prev => [...prev, { ...data.question, queue_position: data.queue_position }]);
             break;
             
+          case "pool_update":
+            setPool(data);
+            break;
+
+          case "queue_updated":
+            setQueuedQuestions((data.queued || []).map((q: Question, i: number) => ({ ...q, queue_position: i + 1 })));
+            break;
+
+          case "question_voided":
+            setIsQuestionLive(false);
+            setClock(null);
+            setPool(null);
+            break;
+
+          case "player_removed":
+          case "balance_adjusted":
+            console.log("Moderation:", data);
+            break;
+
+          case "error":
+            alert(data.message);
+            break;
+
+          case "tick":
+            setClock({ remaining_ms: data.remaining_ms, paused: data.paused });
+            break;
+
           case "question_live":
             setIsQuestionLive(true);
+            setPool(null);
             // Remove from queue if it was queued
             setQueuedQuestions(prev => prev.slice(1));
             break;
             
+          case "review":
+            setReviewing({ question_id: data.question_id, ends_at: data.ends_at });
+            break;
+
+          case "review_ended":
+            setReviewing(null);
+            break;
+
           case "ready_for_question":
             setIsQuestionLive(false);
             setRemainingPlayers(data.remaining_players || 0);
@@ -62,10 +146,12 @@ export function QuizBroadcaster() {
             
           case "results":
             console.log("Question results:", data);
+            setClock(null);
             setRemainingPlayers(data.remaining_players);
             break;
             
           case "game_ended":
+            setPhase("ended");
             setGameEnded(true);
             setIsQuestionLive(false);
             setQueuedQuestions([]);
@@ -116,6 +202,14 @@ export function QuizBroadcaster() {
     setOptions(newOptions);
   };
 
+  const toggleCorrectIndex = (index: number) => {
+    setCorrectIndices(correctIndices.includes(index)
+      ? correctIndices.filter(i => i !== index)
+      : [...correctIndices, index].sort((a, b) => a - b));
+  };
+
+  const hasOptions = questionType === "choice" || questionType === "multi_select";
+
   const handleSubmit = () => {
     // Validate
     const filledOptions = options.filter(opt => opt.trim() !== "");
@@ -125,15 +219,64 @@ export function QuizBroadcaster() {
       return;
     }
     
-    if (filledOptions.length < 2) {
+    if (hasOptions && filledOptions.length < 2) {
       alert("Please provide at least 2 options");
       return;
     }
     
-    if (correctIndex >= filledOptions.length) {
+    if (questionType === "choice" && correctIndex >= filledOptions.length) {
       alert("Invalid correct answer selection");
       return;
     }
+
+    if (questionType === "multi_select" && (correctIndices.length === 0 || correctIndices.some(i => i >= filledOptions.length))) {
+      alert("Select at least one correct option");
+      return;
+    }
+
+    const format: Record<string, unknown> = {};
+    if (questionType === "multi_select") {
+      format.correct_indices = correctIndices;
+    }
+    if (questionType === "numeric") {
+      const [min, max, tolerance, answer] = [numeric.min, numeric.max, numeric.tolerance, numeric.answer].map(parseFloat);
+      if ([min, max, tolerance, answer].some(isNaN) || min >= max || tolerance <= 0 || answer < min || answer > max) {
+        alert("Numeric questions need min < max, a positive tolerance and an answer in range");
+        return;
+      }
+      format.numeric = { min, max, unit: numeric.unit.trim(), tolerance };
+      format.answer = answer;
+    }
+    if (attachFrame) {
+      format.attach_frame = true;
+      format.attach_regions = attachRegions;
+    }
+    // A hotspot on the broadcast frame can take one of its segmentation regions
+    const frameRegion = questionType === "hotspot" && attachFrame && regionIndex.trim() !== "";
+    if (frameRegion) {
+      const index = parseInt(regionIndex, 10);
+      if (isNaN(index) || index < 0) {
+        alert("Region index must be 0 or more");
+        return;
+      }
+      format.region_index = index;
+    }
+    if (questionType === "hotspot" && !frameRegion) {
+      let polygon: unknown;
+      try {
+        polygon = JSON.parse(regionPolygon);
+      } catch {
+        polygon = null;
+      }
+      if ((!imageUrl.trim() && !attachFrame) || !Array.isArray(polygon) || polygon.length < 3) {
+        alert("Hotspot questions need an image URL or the broadcast frame, and a region polygon with at least 3 points");
+        return;
+      }
+      format.region = { polygon };
+    }
+    if (questionType === "hotspot" && imageUrl.trim() && !attachFrame) {
+      format.image_url = imageUrl.trim();
+    }
     
     if (timeLimit < 5 || timeLimit > 300) {
       alert("Time limit must be between 5 and 300 seconds");
@@ -148,19 +291,56 @@ export function QuizBroadcaster() {
     // Send question to backend
     ws.send(JSON.stringify({
       type: "submit_question",
+      question_type: questionType,
       question: question.trim(),
-      options: filledOptions,
+      options: hasOptions ? filledOptions : [],
       correct_index: correctIndex,
-      time_limit: timeLimit
+      time_limit: timeLimit,
+      explanation: explanation.trim(),
+      reference_url: referenceUrl.trim(),
+      ...format,
     }));
     
     // Reset form
     setQuestion("");
     setOptions(["", ""]);
     setCorrectIndex(0);
+    setCorrectIndices([]);
+    setNumeric({ ...numeric, answer: "" });
+    setRegionPolygon("");
+    setRegionIndex("");
+    setExplanation("");
+    setReferenceUrl("");
     setTimeLimit(30);
   };
 
+  const handleStart = () => {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+      alert("Not connected to server");
+      return;
+    }
+    ws.send(JSON.stringify({ type: "start_game" }));
+  };
+
+  // Clock and moderation commands, e.g. pause_question or kick_player
+  const sendQuestionCommand = (type: string, extra: Record<string, unknown> = {}) => {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+      alert("Not connected to server");
+      return;
+    }
+    ws.send(JSON.stringify({ type, ...extra }));
+  };
+
+  const moveQueued = (index: number, offset: number) => {
+    const ids = queuedQuestions.map(q => q.id);
+    const target = index + offset;
+    if (target < 0 || target >= ids.length) {
+      return;
+    }
+    [ids[index], ids[target]] = [ids[target], ids[index]];
+    sendQuestionCommand("reorder_queue", { question_ids: ids });
+  };
+
   return (
     <div className="flex flex-col gap-4 h-full overflow-y-auto">
       <div className="flex items-center justify-between">
@@ -188,17 +368,93 @@ export function QuizBroadcaster() {
             <div className="flex justify-between items-center text-sm">
               <span className="text-muted-foreground">Status:</span>
               <span className={`font-medium ${isQuestionLive ? 'text-red-500' : 'text-green-600'}`}>
-                {isQuestionLive ? 'Question Live' : 'Ready for Question'}
+                {phase === 'lobby' ? 'Lobby' : isQuestionLive ? 'Question Live' : 'Ready for Question'}
               </span>
             </div>
             <div className="flex justify-between items-center text-sm mt-1">
               <span className="text-muted-foreground">Players:</span>
               <span className="font-medium">{remainingPlayers}</span>
             </div>
+            {isQuestionLive && (
+              <div className="mt-3">
+                <div className="flex justify-between items-center text-sm">
+                  <span className="text-muted-foreground">Time left:</span>
+                  <span className="font-medium">
+                    {clock ? (clock.paused ? "Paused" : `${Math.ceil(clock.remaining_ms / 1000)}s`) : "-"}
+                  </span>
+                </div>
+                <div className="grid grid-cols-3 gap-2 mt-2">
+                  <Button
+                    variant="outline"
+                    onClick={() => sendQuestionCommand(clock?.paused ? "resume_question" : "pause_question")}
+                  >
+                    {clock?.paused ? "Resume" : "Pause"}
+                  </Button>
+                  <Button variant="outline" onClick={() => sendQuestionCommand("extend_question", { seconds: 10 })}>
+                    +10s
+                  </Button>
+                  <Button variant="outline" onClick={() => sendQuestionCommand("end_question")}>
+                    End Now
+                  </Button>
+                </div>
+                <Button
+                  variant="outline"
+                  className="w-full mt-2"
+                  onClick={() => sendQuestionCommand("void_question", { reason: modReason })}
+                >
+                  Void Question & Refund Bets
+                </Button>
+              </div>
+            )}
+            {reviewing && (
+              <div className="mt-3">
+                <div className="text-sm text-muted-foreground">
+                  Players are reviewing the answer until {new Date(reviewing.ends_at).toLocaleTimeString()}
+                </div>
+                <Button variant="outline" className="w-full mt-2" onClick={() => sendQuestionCommand("end_review")}>
+                  Next Question
+                </Button>
+              </div>
+            )}
+            {isQuestionLive && pool && (
+              <div className="mt-2 space-y-1 text-xs">
+                <div className="text-muted-foreground">
+                  Pool: {pool.total.toFixed(2)} tokens from {pool.bettors} bettors
+                </div>
+                {pool.options.map((option) => (
+                  <div key={option.index} className="flex justify-between">
+                    <span>{String.fromCharCode(65 + option.index)}</span>
+                    <span>
+                      {option.total.toFixed(2)} • {option.bettors} • {option.odds > 0 ? `${option.odds.toFixed(2)}x` : "-"}
+                    </span>
+                  </div>
+                ))}
+              </div>
+            )}
+            {phase === 'lobby' && (
+              <Button onClick={handleStart} disabled={!connected} className="w-full mt-3">
+                Start Game
+              </Button>
+            )}
           </Card>
 
           {/* Question Form */}
           <Card className="p-4 space-y-4">
+            <div>
+              <Label htmlFor="questionType">Question Type</Label>
+              <select
+                id="questionType"
+                value={questionType}
+                onChange={(e) => setQuestionType(e.target.value as typeof questionType)}
+                className="w-full mt-1 px-3 py-2 border border-border rounded-md bg-background text-foreground"
+              >
+                <option value="choice">Single choice</option>
+                <option value="multi_select">Multi-select</option>
+                <option value="numeric">Numeric estimate</option>
+                <option value="hotspot">Image hotspot</option>
+              </select>
+            </div>
+
             <div>
               <Label htmlFor="question">Question</Label>
               <Input
@@ -210,6 +466,88 @@ export function QuizBroadcaster() {
               />
             </div>
 
+            {questionType === "numeric" && (
+              <div className="grid grid-cols-3 gap-2">
+                {(["min", "max", "answer", "tolerance", "unit"] as const).map((field) => (
+                  <div key={field}>
+                    <Label htmlFor={`numeric-${field}`} className="capitalize">{field}</Label>
+                    <Input
+                      id={`numeric-${field}`}
+                      type={field === "unit" ? "text" : "number"}
+                      value={numeric[field]}
+                      onChange={(e) => setNumeric({ ...numeric, [field]: e.target.value })}
+                      className="mt-1"
+                    />
+                  </div>
+                ))}
+              </div>
+            )}
+
+            <div className="space-y-1">
+              <label className="flex items-center gap-2 text-sm text-foreground">
+                <input
+                  type="checkbox"
+                  checked={attachFrame}
+                  onChange={(e) => setAttachFrame(e.target.checked)}
+                />
+                Attach current broadcast frame
+              </label>
+              {attachFrame && (
+                <label className="flex items-center gap-2 text-sm text-foreground">
+                  <input
+                    type="checkbox"
+                    checked={attachRegions}
+                    onChange={(e) => setAttachRegions(e.target.checked)}
+                  />
+                  Include segmentation regions
+                </label>
+              )}
+            </div>
+
+            {questionType === "hotspot" && (
+              <div className="space-y-2">
+                {attachFrame && (
+                  <div>
+                    <Label htmlFor="regionIndex">Target region index (blank to draw a polygon)</Label>
+                    <Input
+                      id="regionIndex"
+                      type="number"
+                      min="0"
+                      placeholder="0"
+                      value={regionIndex}
+                      onChange={(e) => setRegionIndex(e.target.value)}
+                      className="mt-1"
+                    />
+                  </div>
+                )}
+                {!attachFrame && (
+                <div>
+                  <Label htmlFor="imageUrl">Image URL</Label>
+                  <Input
+                    id="imageUrl"
+                    placeholder="https://..."
+                    value={imageUrl}
+                    onChange={(e) => setImageUrl(e.target.value)}
+                    className="mt-1"
+                  />
+                </div>
+                )}
+                {!(attachFrame && regionIndex.trim() !== "") && (
+                <div>
+                  <Label htmlFor="regionPolygon">Region polygon (from the segmentation output)</Label>
+                  <Input
+                    id="regionPolygon"
+                    placeholder="[[120,80],[200,90],[160,170]]"
+                    value={regionPolygon}
+                    onChange={(e) => setRegionPolygon(e.target.value)}
+                    className="mt-1 font-mono text-xs"
+                  />
+                </div>
+                )}
+              </div>
+            )}
+
+            {hasOptions && (
             <div>
               <div className="flex items-center justify-between mb-2">
                 <Label>Answer Options ({options.length}/4)</Label>
@@ -251,8 +589,10 @@ export function QuizBroadcaster() {
                 ))}
               </div>
             </div>
+            )}
 
             <div className="grid grid-cols-2 gap-4">
+              {questionType === "choice" && (
               <div>
                 <Label htmlFor="correctAnswer">Correct Answer</Label>
                 <select
@@ -268,6 +608,47 @@ export function QuizBroadcaster() {
                   ))}
                 </select>
               </div>
+              )}
+
+              {questionType === "multi_select" && (
+              <div>
+                <Label>Correct Answers</Label>
+                <div className="flex gap-3 mt-2">
+                  {options.map((_, index) => (
+                    <label key={index} className="flex items-center gap-1 text-sm">
+                      <input
+                        type="checkbox"
+                        checked={correctIndices.includes(index)}
+                        onChange={() => toggleCorrectIndex(index)}
+                      />
+                      {String.fromCharCode(65 + index)}
+                    </label>
+                  ))}
+                </div>
+              </div>
+              )}
+
+              <div>
+                <Label htmlFor="explanation">Explanation (shown after the question)</Label>
+                <Input
+                  id="explanation"
+                  placeholder="Why the answer is right..."
+                  value={explanation}
+                  onChange={(e) => setExplanation(e.target.value)}
+                  className="mt-1"
+                />
+              </div>
+
+              <div>
+                <Label htmlFor="referenceUrl">Reference link</Label>
+                <Input
+                  id="referenceUrl"
+                  placeholder="https://..."
+                  value={referenceUrl}
+                  onChange={(e) => setReferenceUrl(e.target.value)}
+                  className="mt-1"
+                />
+              </div>
 
               <div>
                 <Label htmlFor="timeLimit">Time Limit (seconds)</Label>
@@ -285,13 +666,63 @@ export function QuizBroadcaster() {
 
             <Button
               onClick={handleSubmit}
-              disabled={!connected || !question.trim() || options.filter(o => o.trim()).length < 2}
+              disabled={!connected || !question.trim() || (hasOptions && options.filter(o => o.trim()).length < 2)}
               className="w-full"
             >
-              {isQuestionLive ? 'Queue Question' : 'Submit Question'}
+              {isQuestionLive || phase === 'lobby' ? 'Queue Question' : 'Submit Question'}
             </Button>
           </Card>
 
+          {/* Moderation */}
+          {phase !== 'ended' && (
+            <Card className="p-4 space-y-2">
+              <h3 className="text-sm font-semibold text-foreground">Moderation</h3>
+              <Input placeholder="Player ID" value={targetPlayer} onChange={(e) => setTargetPlayer(e.target.value)} />
+              <Input placeholder="Reason" value={modReason} onChange={(e) => setModReason(e.target.value)} />
+              <div className="grid grid-cols-2 gap-2">
+                <Button
+                  variant="outline"
+                  disabled={!targetPlayer}
+                  onClick={() => sendQuestionCommand("kick_player", { player_id: targetPlayer, reason: modReason })}
+                >
+                  Kick
+                </Button>
+                <Button
+                  variant="outline"
+                  disabled={!targetPlayer}
+                  onClick={() => sendQuestionCommand("kick_player", { player_id: targetPlayer, reason: modReason, ban: true })}
+                >
+                  Ban
+                </Button>
+              </div>
+              <div className="flex gap-2">
+                <Input
+                  type="number"
+                  step="0.1"
+                  value={adjustAmount}
+                  onChange={(e) => setAdjustAmount(parseFloat(e.target.value) || 0)}
+                  className="w-28"
+                />
+                <Button
+                  variant="outline"
+                  className="flex-1"
+                  disabled={!targetPlayer || !modReason.trim() || adjustAmount === 0}
+                  onClick={() => sendQuestionCommand("adjust_balance", { player_id: targetPlayer, amount: adjustAmount, reason: modReason })}
+                >
+                  Adjust Balance
+                </Button>
+              </div>
+              <div className="grid grid-cols-2 gap-2">
+                <Button variant="outline" onClick={() => sendQuestionCommand("end_game", { jackpot: "refund" })}>
+                  End Game (Refund Jackpot)
+                </Button>
+                <Button variant="outline" onClick={() => sendQuestionCommand("end_game", { jackpot: "distribute" })}>
+                  End Game (Split Jackpot)
+                </Button>
+              </div>
+            </Card>
+          )}
+
           {/* Queued Questions */}
           {queuedQuestions.length > 0 && (
             <Card className="p-4">
@@ -301,7 +732,14 @@ export function QuizBroadcaster() {
               <div className="space-y-2">
                 {queuedQuestions.map((q, index) => (
                   <div key={q.id} className="p-2 bg-muted rounded text-sm">
-                    <div className="font-medium">#{index + 1}: {q.question}</div>
+                    <div className="flex justify-between gap-2">
+                      <div className="font-medium">#{index + 1}: {q.question}</div>
+                      <div className="flex gap-1 text-xs">
+                        <button onClick={() => moveQueued(index, -1)} disabled={index === 0}>↑</button>
+                        <button onClick={() => moveQueued(index, 1)} disabled={index === queuedQuestions.length - 1}>↓</button>
+                        <button onClick={() => sendQuestionCommand("remove_queued", { question_id: q.id })}>✕</button>
+                      </div>
+                    </div>
                     <div className="text-xs text-muted-foreground mt-1">
                       {q.options.length} options • {q.time_limit}s
                     </div>
@@ -7,10 +7,55 @@ import { Card } from "@/components/ui/card";
 
 interface QuizQuestion {
   id: string;
+  type: "choice" | "multi_select" | "numeric" | "hotspot";
   question: string;
   options: string[];
+  numeric?: { min: number; max: number; unit?: string; tolerance: number };
+  image_url?: string;
+  frame?: QuestionFrame;
   time_limit: number;
   start_time: number;
+  deadline: number;
+}
+
+interface QuestionFrame {
+  image: string; // base64 JPEG
+  captured_at: number;
+  frame_index: number;
+  regions?: { polygon: number[][] }[];
+}
+
+// A broadcast frame attached to a question, with its segmentation regions
+// outlined in the frame's own pixel coordinates
+function FrameImage({ frame, onClick }: { frame: QuestionFrame; onClick?: (e: React.MouseEvent<HTMLImageElement>) => void }) {
+  const [size, setSize] = useState<{ width: number; height: number } | null>(null);
+
+  return (
+    <div className="relative">
+      <img
+        src={`data:image/jpeg;base64,${frame.image}`}
+        alt={`Broadcast frame ${frame.frame_index}`}
+        onLoad={(e) => setSize({ width: e.currentTarget.naturalWidth, height: e.currentTarget.naturalHeight })}
+        onClick={onClick}
+        className={`w-full rounded-lg ${onClick ? "cursor-crosshair" : ""}`}
+      />
+      {size && frame.regions && frame.regions.length > 0 && (
+        <svg
+          viewBox={`0 0 ${size.width} ${size.height}`}
+          className="absolute inset-0 w-full h-full pointer-events-none"
+        >
+          {frame.regions.map((region, index) => (
+            <polygon
+              key={index}
+              points={region.polygon.map(([x, y]) => `${x},${y}`).join(" ")}
+              className="fill-primary/20 stroke-primary"
+              strokeWidth={2}
+            />
+          ))}
+        </svg>
+      )}
+    </div>
+  );
 }
 
 interface BetState {
@@ -24,6 +69,51 @@ interface PlayerResult {
   tokens_returned: number;
   tokens_lost: number;
   new_balance: number;
+  points_earned?: number;
+  points?: number;
+  lives?: number;
+  odds?: number;
+  winnings?: number;
+  credit?: number;
+}
+
+interface PoolOption {
+  index: number;
+  total: number;
+  bettors: number;
+  odds: number;
+}
+
+interface PoolUpdate {
+  question_id: string;
+  total: number;
+  bettors: number;
+  options: PoolOption[];
+}
+
+// Shown between a question's results and the next question
+interface QuestionReview {
+  question_id: string;
+  question: string;
+  options: string[];
+  correct_index: number;
+  correct_indices?: number[];
+  answer?: number;
+  explanation?: string;
+  reference_url?: string;
+  total: number;
+  bettors: number;
+  distribution: PoolOption[];
+  ends_at: number;
+}
+
+interface LeaderboardEntry {
+  rank: number;
+  user_id: string;
+  username: string;
+  games: number;
+  wins: number;
+  net_tokens: number;
 }
 
 interface QuizResults {
@@ -36,6 +126,17 @@ interface QuizResults {
   player_results: { [key: string]: PlayerResult };
 }
 
+// A random ID kept in this browser, sent when joining so the server can spot
+// several accounts playing from one device
+function deviceId(): string {
+  let id = localStorage.getItem("quizDeviceId");
+  if (!id) {
+    id = crypto.randomUUID();
+    localStorage.setItem("quizDeviceId", id);
+  }
+  return id;
+}
+
 export function QuizPanel() {
   const [ws, setWs] = useState<WebSocket | null>(null);
   const [connected, setConnected] = useState(false);
@@ -43,15 +144,35 @@ export function QuizPanel() {
   const [tokens, setTokens] = useState(50);
   const [bets, setBets] = useState<number[]>([]);
   const [betSubmitted, setBetSubmitted] = useState(false);
+  const [staked, setStaked] = useState(0); // confirmed stake, refunded if the bet is changed
+  const [betError, setBetError] = useState("");
   const [timeRemaining, setTimeRemaining] = useState(0);
   const [isActive, setIsActive] = useState(true);
   const [isEliminated, setIsEliminated] = useState(false);
+  // Eliminated players and latecomers watch without betting
+  const [spectating, setSpectating] = useState(false);
   const [jackpot, setJackpot] = useState(0);
   const [remainingPlayers, setRemainingPlayers] = useState(0);
   const [lastResult, setLastResult] = useState<PlayerResult | null>(null);
   const [gameEnded, setGameEnded] = useState(false);
+  const [payoutHeld, setPayoutHeld] = useState("");
   const [userId, setUserId] = useState<string>("");
+  const [mode, setMode] = useState("elimination");
+  const [pool, setPool] = useState<PoolUpdate | null>(null);
+  const [review, setReview] = useState<QuestionReview | null>(null);
+  const [points, setPoints] = useState(0);
+  const [lives, setLives] = useState(0);
+  const [leaderboard, setLeaderboard] = useState<{ all_time: LeaderboardEntry[]; weekly: LeaderboardEntry[] } | null>(null);
+  const [leaderboardPeriod, setLeaderboardPeriod] = useState<"all_time" | "weekly">("weekly");
   const timerRef = useRef<NodeJS.Timeout | null>(null);
+  // Local end time, corrected by the server's tick messages
+  const deadlineRef = useRef(0);
+  const pausedRef = useRef(false);
+  const [paused, setPaused] = useState(false);
+  const [betsLocked, setBetsLocked] = useState(false);
+  // Numeric and hotspot questions take one stake plus an answer
+  const [estimate, setEstimate] = useState("");
+  const [point, setPoint] = useState<{ x: number; y: number } | null>(null);
 
   useEffect(() => {
     // Get user info from session
@@ -72,13 +193,9 @@ export function QuizPanel() {
         
         setUserId(user._id || user.userId);
         
-        // Connect to quiz WebSocket
-        const username = user.name || user.email;
-        const email = user.email;
-        const userIdParam = user._id || user.userId;
-        
+        // Connect to quiz WebSocket; the session cookie identifies the player
         const websocket = new WebSocket(
-          `ws://localhost:8080/quiz-viewer?userId=${encodeURIComponent(userIdParam)}&username=${encodeURIComponent(username)}&email=${encodeURIComponent(email)}`
+          `ws://localhost:8080/quiz-viewer?device=${encodeURIComponent(deviceId())}`
         );
         
         websocket.onopen = () => {
@@ -93,21 +210,88 @@ export function QuizPanel() {
             
             switch (data.type) {
               case "game_state":
-                setTokens(data.tokens || 50);
-                setIsActive(data.is_active);
+                // Also sent on reconnect, restoring balance, elimination and bets
+                setSpectating(!!data.spectating);
+                setTokens(data.tokens ?? (data.spectating ? 0 : 50));
+                setIsActive(data.is_active === true);
+                setIsEliminated(data.is_active === false);
                 setJackpot(data.jackpot || 0);
+                setGameEnded(data.phase === "ended");
+                setMode(data.rules?.mode ?? "elimination");
+                setPoints(data.points ?? 0);
+                setLives(data.lives ?? 0);
+                setReview(data.review ?? null);
                 if (data.current_question) {
                   handleNewQuestion(data.current_question);
+                  if (data.clock) {
+                    handleTick(data.clock);
+                  }
+                  if (data.current_bets) {
+                    setBets(data.current_bets);
+                    setStaked((data.current_bets as number[]).reduce((sum, bet) => sum + bet, 0));
+                    setBetSubmitted(true);
+                  }
                 }
                 break;
                 
               case "new_question":
+                setReview(null);
                 handleNewQuestion(data.question);
                 break;
+
+              case "review":
+                setReview(data);
+                break;
+
+              case "review_ended":
+                setReview(null);
+                break;
                 
+              case "pool_update":
+                setPool(data);
+                break;
+
+              case "tick":
+                handleTick(data);
+                break;
+
               case "bet_confirmed":
                 setBetSubmitted(true);
+                setBetError("");
+                setStaked((data.bets as number[]).reduce((sum, bet) => sum + bet, 0));
+                setTokens(data.new_balance);
+                break;
+
+              case "bet_cancelled":
+                setBetSubmitted(false);
+                setBetError("");
+                setStaked(0);
+                setBets([]);
+                setTokens(data.new_balance);
+                break;
+
+              case "bet_rejected":
+                setBetError(data.message);
+                break;
+
+              case "bet_refunded":
+              case "balance_adjusted":
                 setTokens(data.new_balance);
+                if (data.type === "bet_refunded") {
+                  setBetSubmitted(false);
+                  setStaked(0);
+                }
+                break;
+
+              case "question_voided":
+                setCurrentQuestion(null);
+                setBets([]);
+                break;
+
+              case "kicked":
+                setIsActive(false);
+                setIsEliminated(true);
+                alert(data.banned ? "You have been banned from this quiz" : "The host removed you from the quiz");
                 break;
                 
               case "results":
@@ -117,6 +301,7 @@ export function QuizPanel() {
               case "eliminated":
                 setIsEliminated(true);
                 setIsActive(false);
+                setSpectating(true);
                 break;
                 
               case "game_ended":
@@ -126,6 +311,14 @@ export function QuizPanel() {
                   handleResults(data.results);
                 }
                 break;
+
+              case "payout_held":
+                setPayoutHeld(data.message);
+                break;
+
+              case "leaderboard":
+                setLeaderboard({ all_time: data.all_time ?? [], weekly: data.weekly ?? [] });
+                break;
             }
           } catch (err) {
             console.error("Failed to parse quiz message:", err);
@@ -170,31 +363,43 @@ export function QuizPanel() {
     console.log("============================");
     
     setCurrentQuestion(question);
-    setBets(new Array(question.options.length).fill(0));
+    const singleStake = question.type === "numeric" || question.type === "hotspot";
+    setBets(new Array(singleStake ? 1 : question.options.length).fill(0));
+    setEstimate("");
+    setPoint(null);
     setBetSubmitted(false);
+    setStaked(0);
+    setBetError("");
     setLastResult(null);
     
-    // Start countdown timer
-    const startTime = question.start_time;
-    const endTime = startTime + (question.time_limit * 1000);
+    // Start countdown timer. The server's deadline is authoritative: ticks
+    // correct it, and the host can pause or extend the question.
+    deadlineRef.current = Date.now() + (question.deadline - question.start_time);
+    pausedRef.current = false;
+    setPaused(false);
+    setBetsLocked(false);
     
     if (timerRef.current) {
       clearInterval(timerRef.current);
     }
     
     timerRef.current = setInterval(() => {
-      const now = Date.now();
-      const remaining = Math.max(0, Math.ceil((endTime - now) / 1000));
-      setTimeRemaining(remaining);
-      
-      if (remaining <= 0) {
-        if (timerRef.current) {
-          clearInterval(timerRef.current);
-        }
+      if (pausedRef.current) {
+        return;
       }
+      const remaining = Math.max(0, Math.ceil((deadlineRef.current - Date.now()) / 1000));
+      setTimeRemaining(remaining);
     }, 100);
   };
 
+  const handleTick = (tick: { question_id: string; remaining_ms: number; paused: boolean; locked: boolean }) => {
+    deadlineRef.current = Date.now() + tick.remaining_ms;
+    setTimeRemaining(Math.ceil(tick.remaining_ms / 1000));
+    pausedRef.current = tick.paused;
+    setPaused(tick.paused);
+    setBetsLocked(tick.locked);
+  };
+
   const handleResults = (results: QuizResults) => {
     setJackpot(results.jackpot);
     setRemainingPlayers(results.remaining_players);
@@ -203,10 +408,12 @@ export function QuizPanel() {
       const result = results.player_results[userId];
       setLastResult(result);
       setTokens(result.new_balance);
-      
-      if (!result.won) {
-        setIsActive(false);
-      }
+      setPoints(result.points ?? 0);
+      setLives(result.lives ?? 0);
+    }
+    // Only elimination-style modes knock players out for a wrong answer
+    if (userId && results.eliminated_players?.includes(userId)) {
+      setIsActive(false);
     }
     
     // Clear current question after delay
@@ -233,7 +440,8 @@ export function QuizPanel() {
     
     const totalBet = getTotalBet();
     
-    if (totalBet > tokens) {
+    // A new bet replaces the confirmed one, so its stake is available again
+    if (totalBet > tokens + staked) {
       alert("Insufficient tokens!");
       return;
     }
@@ -244,25 +452,46 @@ export function QuizPanel() {
       alert("You must place at least one bet!");
       return;
     }
+    if (currentQuestion.type === "numeric" && estimate === "") {
+      alert("Enter your estimate first!");
+      return;
+    }
+    if (currentQuestion.type === "hotspot" && !point) {
+      alert("Click on the image first!");
+      return;
+    }
     
     ws.send(JSON.stringify({
       type: "submit_bet",
       question_id: currentQuestion.id,
-      bets: bets
+      bets: bets,
+      ...(currentQuestion.type === "numeric" && { value: parseFloat(estimate) }),
+      ...(currentQuestion.type === "hotspot" && { point }),
     }));
   };
 
-  if (isEliminated) {
-    return (
-      <div className="flex flex-col items-center justify-center h-full p-6 text-center">
-        <div className="text-6xl mb-4">💀</div>
-        <h2 className="text-2xl font-bold text-red-600 mb-2">You've Been Eliminated!</h2>
-        <p className="text-muted-foreground">
-          You didn't bet on the correct answer. Better luck next time!
-        </p>
-      </div>
-    );
-  }
+  // Hotspot clicks are sent in the image's own pixels
+  const handleHotspotClick = (e: React.MouseEvent<HTMLImageElement>) => {
+    if (betSubmitted || spectating) {
+      return;
+    }
+    const img = e.currentTarget;
+    const rect = img.getBoundingClientRect();
+    setPoint({
+      x: Math.round((e.clientX - rect.left) * (img.naturalWidth / rect.width)),
+      y: Math.round((e.clientY - rect.top) * (img.naturalHeight / rect.height)),
+    });
+  };
+
+  const handleCancelBet = () => {
+    if (!ws || ws.readyState !== WebSocket.OPEN || !currentQuestion) {
+      return;
+    }
+    ws.send(JSON.stringify({
+      type: "cancel_bet",
+      question_id: currentQuestion.id,
+    }));
+  };
 
   if (gameEnded) {
     return (
@@ -276,7 +505,12 @@ export function QuizPanel() {
             <p className="text-lg text-foreground">Final Balance: {tokens.toFixed(2)} tokens</p>
           </>
         ) : (
-          <p className="text-muted-foreground">Thanks for playing!</p>
+          <p className="text-muted-foreground">
+            {spectating && !isEliminated ? "Thanks for watching! Join the next game to play." : "Thanks for playing!"}
+          </p>
+        )}
+        {payoutHeld && (
+          <p className="mt-4 text-sm text-amber-600">{payoutHeld}</p>
         )}
       </div>
     );
@@ -295,16 +529,36 @@ export function QuizPanel() {
         </div>
       </div>
 
+      {/* Watching without betting */}
+      {spectating && (
+        <Card className={`p-3 ${isEliminated ? "bg-red-50 border-red-200" : "bg-muted"}`}>
+          <p className={`text-sm font-medium ${isEliminated ? "text-red-700" : "text-foreground"}`}>
+            {isEliminated
+              ? "💀 You've been eliminated. You can keep watching the questions and results."
+              : "👀 This game is already running, so you're watching. Join the next game to play."}
+          </p>
+        </Card>
+      )}
+
       {/* Stats */}
       <div className="grid grid-cols-3 gap-2">
         <Card className="p-3 bg-muted">
           <div className="text-xs text-muted-foreground mb-1">Your Tokens</div>
           <div className="text-lg font-bold text-foreground">{tokens.toFixed(2)}</div>
         </Card>
-        <Card className="p-3 bg-muted">
-          <div className="text-xs text-muted-foreground mb-1">Jackpot</div>
-          <div className="text-lg font-bold text-yellow-600">{jackpot.toFixed(2)}</div>
-        </Card>
+        {mode === "points" ? (
+          <Card className="p-3 bg-muted">
+            <div className="text-xs text-muted-foreground mb-1">Points</div>
+            <div className="text-lg font-bold text-yellow-600">{points.toFixed(0)}</div>
+          </Card>
+        ) : (
+          <Card className="p-3 bg-muted">
+            <div className="text-xs text-muted-foreground mb-1">
+              Jackpot{mode === "lives" && ` • ${lives} ${lives === 1 ? "life" : "lives"} left`}
+            </div>
+            <div className="text-lg font-bold text-yellow-600">{jackpot.toFixed(2)}</div>
+          </Card>
+        )}
         <Card className="p-3 bg-muted">
           <div className="text-xs text-muted-foreground mb-1">Players</div>
           <div className="text-lg font-bold text-foreground">{remainingPlayers}</div>
@@ -325,16 +579,60 @@ export function QuizPanel() {
               <p className="text-green-700">
                 Returned: {lastResult.tokens_returned.toFixed(2)} tokens
                 {lastResult.tokens_lost > 0 && ` • Lost: ${lastResult.tokens_lost.toFixed(2)} tokens`}
+                {!!lastResult.points_earned && ` • +${lastResult.points_earned.toFixed(0)} points`}
+                {!!lastResult.odds && ` • Odds ${lastResult.odds.toFixed(2)}x (+${(lastResult.winnings ?? 0).toFixed(2)})`}
+                {!!lastResult.credit && lastResult.credit < 1 && ` • ${(lastResult.credit * 100).toFixed(0)}% credit`}
               </p>
             ) : (
               <p className="text-red-700">
-                Lost: {lastResult.tokens_lost.toFixed(2)} tokens to jackpot
+                Lost: {lastResult.tokens_lost.toFixed(2)} tokens{mode === "parimutuel" ? "" : " to jackpot"}
               </p>
             )}
           </div>
         </Card>
       )}
 
+      {/* Review before the next question */}
+      {review && !currentQuestion && (
+        <Card className="p-4 space-y-3">
+          <div>
+            <h3 className="font-semibold text-foreground">Review: {review.question}</h3>
+            {review.answer !== undefined && (
+              <p className="text-sm text-green-700">Answer: {review.answer}</p>
+            )}
+          </div>
+          {review.options.length > 0 && (
+            <div className="space-y-2">
+              {review.options.map((option, index) => {
+                const correct = review.correct_indices ? review.correct_indices.includes(index) : index === review.correct_index;
+                const share = review.total > 0 ? (review.distribution[index]?.total ?? 0) / review.total : 0;
+                return (
+                  <div key={index} className="text-sm">
+                    <div className="flex justify-between">
+                      <span className={correct ? "font-semibold text-green-700" : "text-foreground"}>
+                        {String.fromCharCode(65 + index)}. {option} {correct && "✓"}
+                      </span>
+                      <span className="text-muted-foreground">
+                        {(share * 100).toFixed(0)}% • {review.distribution[index]?.bettors ?? 0} bettors
+                      </span>
+                    </div>
+                    <div className="w-full h-1.5 bg-muted rounded-full overflow-hidden">
+                      <div className={`h-full ${correct ? "bg-green-500" : "bg-primary"}`} style={{ width: `${share * 100}%` }} />
+                    </div>
+                  </div>
+                );
+              })}
+            </div>
+          )}
+          {review.explanation && <p className="text-sm text-foreground">{review.explanation}</p>}
+          {review.reference_url && (
+            <a href={review.reference_url} target="_blank" rel="noopener noreferrer" className="text-sm text-primary underline">
+              Read more
+            </a>
+          )}
+        </Card>
+      )}
+
       {/* Question or Waiting */}
       {currentQuestion ? (
         <Card className="p-4 flex-1 flex flex-col">
@@ -343,7 +641,7 @@ export function QuizPanel() {
             <div className="flex justify-between items-center mb-2">
               <span className="text-sm font-medium text-muted-foreground">Time Remaining</span>
               <span className={`text-2xl font-bold ${timeRemaining <= 5 ? 'text-red-600' : 'text-foreground'}`}>
-                {timeRemaining}s
+                {paused ? 'Paused' : `${timeRemaining}s`}
               </span>
             </div>
             <div className="w-full h-2 bg-muted rounded-full overflow-hidden">
@@ -357,8 +655,81 @@ export function QuizPanel() {
           {/* Question */}
           <div className="mb-4">
             <h3 className="text-lg font-semibold text-foreground mb-4">{currentQuestion.question}</h3>
+            {currentQuestion.type === "multi_select" && (
+              <p className="text-sm text-muted-foreground">More than one answer can be right: stakes on any correct option count.</p>
+            )}
+            {currentQuestion.frame && currentQuestion.type !== "hotspot" && (
+              <FrameImage frame={currentQuestion.frame} />
+            )}
           </div>
 
+          {/* Numeric and hotspot answers with one stake */}
+          {(currentQuestion.type === "numeric" || currentQuestion.type === "hotspot") && (
+            <div className="space-y-3 flex-1">
+              {currentQuestion.type === "numeric" && currentQuestion.numeric && (
+                <div className="flex items-center gap-3 p-3 bg-muted rounded-lg">
+                  <div className="flex-1 text-sm font-medium text-foreground">
+                    Your estimate ({currentQuestion.numeric.min}-{currentQuestion.numeric.max}{currentQuestion.numeric.unit && ` ${currentQuestion.numeric.unit}`})
+                    <div className="text-xs text-muted-foreground">
+                      Full credit on the answer, none {currentQuestion.numeric.tolerance} away
+                    </div>
+                  </div>
+                  <Input
+                    type="number"
+                    min={currentQuestion.numeric.min}
+                    max={currentQuestion.numeric.max}
+                    value={estimate}
+                    onChange={(e) => setEstimate(e.target.value)}
+                    disabled={spectating || betSubmitted || timeRemaining <= 0 || paused || betsLocked}
+                    className="w-24 text-right"
+                  />
+                </div>
+              )}
+              {currentQuestion.type === "hotspot" && currentQuestion.image_url && (
+                <div className="relative">
+                  <img
+                    src={currentQuestion.image_url}
+                    alt="Click the answer"
+                    onClick={handleHotspotClick}
+                    className="w-full rounded-lg cursor-crosshair"
+                  />
+                  {point && (
+                    <div className="text-xs text-muted-foreground mt-1">Selected point: {point.x}, {point.y}</div>
+                  )}
+                </div>
+              )}
+              {currentQuestion.type === "hotspot" && !currentQuestion.image_url && currentQuestion.frame && (
+                <div>
+                  <FrameImage frame={currentQuestion.frame} onClick={handleHotspotClick} />
+                  {point && (
+                    <div className="text-xs text-muted-foreground mt-1">Selected point: {point.x}, {point.y}</div>
+                  )}
+                </div>
+              )}
+              <div className="flex items-center gap-3 p-3 bg-muted rounded-lg">
+                <div className="flex-1 text-sm font-medium text-foreground">
+                  Stake
+                  {pool?.question_id === currentQuestion.id && pool.options[0] && (
+                    <div className="text-xs text-muted-foreground">
+                      {pool.total.toFixed(2)} tokens • {pool.bettors} bettors
+                    </div>
+                  )}
+                </div>
+                <Input
+                  type="number"
+                  min="0"
+                  step="0.1"
+                  max={tokens + staked}
+                  placeholder="0"
+                  value={bets[0] || ""}
+                  onChange={(e) => updateBet(0, e.target.value)}
+                  disabled={spectating || betSubmitted || timeRemaining <= 0 || paused || betsLocked}
+                  className="w-24 text-right"
+                />
+              </div>
+            </div>
+          )}
+
           {/* Options with Betting */}
           <div className="space-y-3 flex-1">
             {currentQuestion.options.map((option, index) => (
@@ -366,16 +737,24 @@ export function QuizPanel() {
                 <div className="flex-shrink-0 w-8 h-8 flex items-center justify-center bg-primary text-primary-foreground rounded-full font-semibold">
                   {String.fromCharCode(65 + index)}
                 </div>
-                <div className="flex-1 text-sm font-medium text-foreground">{option}</div>
+                <div className="flex-1 text-sm font-medium text-foreground">
+                  {option}
+                  {pool?.question_id === currentQuestion.id && pool.options[index] && (
+                    <div className="text-xs text-muted-foreground">
+                      {pool.options[index].total.toFixed(2)} tokens • {pool.options[index].bettors} bettors
+                      {pool.options[index].odds > 0 && ` • ${pool.options[index].odds.toFixed(2)}x`}
+                    </div>
+                  )}
+                </div>
                 <Input
                   type="number"
                   min="0"
                   step="0.1"
-                  max={tokens}
+                  max={tokens + staked}
                   placeholder="0"
                   value={bets[index] || ""}
                   onChange={(e) => updateBet(index, e.target.value)}
-                  disabled={betSubmitted || timeRemaining <= 0}
+                  disabled={spectating || betSubmitted || timeRemaining <= 0 || paused || betsLocked}
                   className="w-24 text-right"
                 />
               </div>
@@ -386,20 +765,44 @@ export function QuizPanel() {
           <div className="mt-4 p-3 bg-muted rounded-lg">
             <div className="flex justify-between text-sm">
               <span className="text-muted-foreground">Total Bet:</span>
-              <span className={`font-semibold ${getTotalBet() > tokens ? 'text-red-600' : 'text-foreground'}`}>
-                {getTotalBet().toFixed(2)} / {tokens.toFixed(2)} tokens
+              <span className={`font-semibold ${getTotalBet() > tokens + staked ? 'text-red-600' : 'text-foreground'}`}>
+                {getTotalBet().toFixed(2)} / {(tokens + staked).toFixed(2)} tokens
               </span>
             </div>
           </div>
 
+          {betsLocked && !paused && <p className="mt-2 text-sm text-muted-foreground">Bets are locked in</p>}
+          {betError && <p className="mt-2 text-sm text-red-600">{betError}</p>}
+
           {/* Submit Button */}
-          <Button
-            onClick={handleSubmitBet}
-            disabled={betSubmitted || timeRemaining <= 0 || getTotalBet() > tokens || getTotalBet() === 0}
-            className="w-full mt-4"
-          >
-            {betSubmitted ? 'Bet Submitted ✓' : 'Submit Bet'}
-          </Button>
+          {spectating ? null : betSubmitted ? (
+            <div className="flex gap-2 mt-4">
+              <Button
+                onClick={() => setBetSubmitted(false)}
+                disabled={timeRemaining <= 0 || paused || betsLocked}
+                variant="outline"
+                className="flex-1"
+              >
+                Change Bet
+              </Button>
+              <Button
+                onClick={handleCancelBet}
+                disabled={timeRemaining <= 0 || paused || betsLocked}
+                variant="outline"
+                className="flex-1"
+              >
+                Cancel Bet
+              </Button>
+            </div>
+          ) : (
+            <Button
+              onClick={handleSubmitBet}
+              disabled={timeRemaining <= 0 || paused || betsLocked || getTotalBet() > tokens + staked || getTotalBet() === 0}
+              className="w-full mt-4"
+            >
+              {staked > 0 ? 'Replace Bet' : 'Submit Bet'}
+            </Button>
+          )}
         </Card>
       ) : (
         <Card className="p-8 flex-1 flex flex-col items-center justify-center text-center">
@@ -410,6 +813,37 @@ export function QuizPanel() {
           </p>
         </Card>
       )}
+
+      {/* Leaderboard, pushed after each game ends */}
+      {leaderboard && !currentQuestion && (
+        <Card className="p-4">
+          <div className="flex items-center justify-between mb-2">
+            <span className="font-semibold text-foreground">Leaderboard</span>
+            <div className="flex gap-1">
+              <Button variant={leaderboardPeriod === "weekly" ? "default" : "outline"} onClick={() => setLeaderboardPeriod("weekly")}>
+                This Week
+              </Button>
+              <Button variant={leaderboardPeriod === "all_time" ? "default" : "outline"} onClick={() => setLeaderboardPeriod("all_time")}>
+                All Time
+              </Button>
+            </div>
+          </div>
+          {leaderboard[leaderboardPeriod].length === 0 ? (
+            <p className="text-sm text-muted-foreground">No finished games yet.</p>
+          ) : (
+            <div className="space-y-1 text-sm">
+              {leaderboard[leaderboardPeriod].map((entry) => (
+                <div key={entry.user_id} className={`flex justify-between ${entry.user_id === userId ? 'font-semibold' : ''}`}>
+                  <span>#{entry.rank} {entry.username}</span>
+                  <span className={entry.net_tokens >= 0 ? 'text-green-700' : 'text-red-700'}>
+                    {entry.net_tokens >= 0 ? '+' : ''}{entry.net_tokens.toFixed(2)} • {entry.wins}W / {entry.games}G
+                  </span>
+                </div>
+              ))}
+            </div>
+          )}
+        </Card>
+      )}
     </div>
   );
 }
@@ -45,8 +45,12 @@ function parseCookie(req: Request, name: string): string | null {
   return null;
 }
 
+export function getSessionToken(req: Request): string | null {
+  return parseCookie(req, cookieName);
+}
+
 export async function getUserFromRequest(req: Request): Promise<SessionUser | null> {
-  const token = parseCookie(req, cookieName);
+  const token = getSessionToken(req);
   if (!token) return null;
   return verifySession(token);
 }